@@ -0,0 +1,275 @@
+// This file contains the validation of the requests against the OpenAPI specification.
+package apispec
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/labstack/echo/v4"
+)
+
+// Reasons of a RequestError.
+const (
+	// ReasonUnsupportedMediaType rejects a body whose content type is not documented for the operation.
+	ReasonUnsupportedMediaType = "unsupported_media_type"
+	// ReasonMalformedBody rejects a missing body, or a body that can not be decoded.
+	ReasonMalformedBody = "malformed_body"
+	// ReasonInvalidBody rejects a body that does not match its schema.
+	ReasonInvalidBody = "invalid_body"
+	// ReasonInvalidParameter rejects a path, query or header parameter that does not match its schema.
+	ReasonInvalidParameter = "invalid_parameter"
+)
+
+// RequestError reports a request rejected by the specification.
+type RequestError struct {
+	Reason     string
+	Detail     string
+	Violations []Violation
+}
+
+// Violation describes why a field of the request is rejected.
+type Violation struct {
+	// Field is the name of the parameter, or the dotted path of the property of the body.
+	Field string
+	// Rule is the failed rule, named after the struct tags of go-playground/validator when there is
+	// an equivalent, e.g. min, max, required, oneof, or after the schema keyword otherwise.
+	Rule    string
+	Param   string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Detail
+}
+
+// RequestValidator rejects the requests that do not match the OpenAPI specification before they
+// reach the handlers: the parameters, the content type of the body and, for JSON, the body itself.
+// The other bodies, e.g. the import files, are left to the handlers, which parse them anyway.
+type RequestValidator struct {
+	router routers.Router
+}
+
+type NewRequestValidatorOptions struct {
+	// Spec defaults to the specification embedded in the generated package.
+	Spec *openapi3.T
+}
+
+// NewRequestValidator creates a new RequestValidator with the provided options.
+func NewRequestValidator(opts NewRequestValidatorOptions) (*RequestValidator, error) {
+	router, err := newRouter(opts.Spec)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestValidator{router: router}, nil
+}
+
+// Validate checks req, it returns a *RequestError when req does not match the specification.
+// The body of req is read and replaced, so that it can still be read by the handler.
+func (v *RequestValidator) Validate(req *http.Request) error {
+	route, pathParams, err := v.router.FindRoute(req)
+	if err != nil {
+		return fmt.Errorf("finding the operation of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+
+	options := &openapi3filter.Options{
+		MultiError: true,
+		// The handlers apply the defaults, the request is validated as it is sent.
+		SkipSettingDefaults: true,
+	}
+	if requestBody := route.Operation.RequestBody; requestBody != nil && requestBody.Value != nil && req.ContentLength != 0 {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+		if requestBody.Value.Content.Get(mediaType) == nil {
+			return &RequestError{
+				Reason: ReasonUnsupportedMediaType,
+				Detail: fmt.Sprintf("The content type %q is not supported, expected one of %s.", mediaType, strings.Join(contentTypes(requestBody.Value.Content), ", ")),
+			}
+		}
+		if mediaType != echo.MIMEApplicationJSON {
+			options.ExcludeRequestBody = true
+		}
+	}
+
+	err = openapi3filter.ValidateRequest(req.Context(), &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    options,
+	})
+	if err == nil {
+		return nil
+	}
+	return newRequestError(err)
+}
+
+func contentTypes(content openapi3.Content) []string {
+	mediaTypes := make([]string, 0, len(content))
+	for mediaType := range content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	return mediaTypes
+}
+
+// Middleware rejects the requests to the operations of the specification that do not match it, by
+// returning a *RequestError to the error handler. The other routes, e.g. /metrics, are ignored.
+func (v *RequestValidator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if _, _, err := v.router.FindRoute(ctx.Request()); err != nil {
+				return next(ctx)
+			}
+			if err := v.Validate(ctx.Request()); err != nil {
+				return err
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// newRequestError translates the errors of openapi3filter into a RequestError. The parameters are
+// reported before the body, a body that can not be decoded is reported alone.
+func newRequestError(err error) *RequestError {
+	var parameterViolations, bodyViolations []Violation
+	for _, e := range flattenErrors(err) {
+		var requestError *openapi3filter.RequestError
+		if !errors.As(e, &requestError) {
+			continue
+		}
+
+		if parameter := requestError.Parameter; parameter != nil {
+			parameterViolations = append(parameterViolations, newParameterViolations(parameter, requestError.Err)...)
+			continue
+		}
+
+		if errors.Is(requestError.Err, openapi3filter.ErrInvalidRequired) {
+			return &RequestError{Reason: ReasonMalformedBody, Detail: "The request body is required."}
+		}
+		bodyErrors := schemaErrors(requestError.Err)
+		if len(bodyErrors) == 0 {
+			return &RequestError{Reason: ReasonMalformedBody, Detail: "The request body is not valid JSON."}
+		}
+		for _, schemaError := range bodyErrors {
+			bodyViolations = append(bodyViolations, schemaViolation(strings.Join(schemaError.JSONPointer(), "."), schemaError))
+		}
+	}
+
+	switch {
+	case len(parameterViolations) > 0:
+		return &RequestError{
+			Reason:     ReasonInvalidParameter,
+			Detail:     "One or more parameters are invalid.",
+			Violations: append(parameterViolations, bodyViolations...),
+		}
+	case len(bodyViolations) > 0:
+		return &RequestError{
+			Reason:     ReasonInvalidBody,
+			Detail:     "One or more fields are invalid.",
+			Violations: bodyViolations,
+		}
+	}
+	return &RequestError{Reason: ReasonInvalidParameter, Detail: err.Error()}
+}
+
+// flattenErrors lists the errors of nested MultiErrors. The errors wrapping a MultiError, e.g. a
+// RequestError, are not unwrapped.
+func flattenErrors(err error) []error {
+	multiError, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range multiError {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
+
+func schemaErrors(err error) []*openapi3.SchemaError {
+	var schemaErrs []*openapi3.SchemaError
+	for _, e := range flattenErrors(err) {
+		var schemaError *openapi3.SchemaError
+		if errors.As(e, &schemaError) {
+			schemaErrs = append(schemaErrs, schemaError)
+		}
+	}
+	return schemaErrs
+}
+
+func newParameterViolations(parameter *openapi3.Parameter, err error) []Violation {
+	if errors.Is(err, openapi3filter.ErrInvalidRequired) {
+		return []Violation{{Field: parameter.Name, Rule: "required", Message: parameter.Name + " is required"}}
+	}
+
+	var parseError *openapi3filter.ParseError
+	if errors.As(err, &parseError) {
+		schemaType := ""
+		if parameter.Schema != nil && parameter.Schema.Value != nil {
+			schemaType = parameter.Schema.Value.Type
+		}
+		return []Violation{{Field: parameter.Name, Rule: "type", Param: schemaType, Message: fmt.Sprintf("%s must be a valid %s", parameter.Name, schemaType)}}
+	}
+
+	var violations []Violation
+	for _, schemaError := range schemaErrors(err) {
+		violations = append(violations, schemaViolation(parameter.Name, schemaError))
+	}
+	if len(violations) == 0 {
+		violations = append(violations, Violation{Field: parameter.Name, Rule: "invalid", Message: fmt.Sprintf("%s is invalid: %s", parameter.Name, err)})
+	}
+	return violations
+}
+
+// schemaViolation describes a schema error of the given field, using the rule names and the messages of
+// the violations reported by the handlers.
+func schemaViolation(field string, schemaError *openapi3.SchemaError) Violation {
+	schema := schemaError.Schema
+	switch schemaError.SchemaField {
+	case "required":
+		return Violation{Field: field, Rule: "required", Message: field + " is required"}
+	case "properties":
+		// An unknown property, which is rejected by additionalProperties: false.
+		var property string
+		if _, err := fmt.Sscanf(schemaError.Reason, "property %q is unsupported", &property); err == nil {
+			field = joinField(field, property)
+		}
+		return Violation{Field: field, Rule: "unknown", Message: field + " is not a known field"}
+	case "minimum":
+		param := formatNumber(*schema.Min)
+		return Violation{Field: field, Rule: "min", Param: param, Message: fmt.Sprintf("%s must be at least %s", field, param)}
+	case "maximum":
+		param := formatNumber(*schema.Max)
+		return Violation{Field: field, Rule: "max", Param: param, Message: fmt.Sprintf("%s must be at most %s", field, param)}
+	case "enum":
+		values := make([]string, 0, len(schema.Enum))
+		for _, value := range schema.Enum {
+			values = append(values, fmt.Sprint(value))
+		}
+		param := strings.Join(values, " ")
+		return Violation{Field: field, Rule: "oneof", Param: param, Message: fmt.Sprintf("%s must be one of %s", field, strings.Join(values, ", "))}
+	case "type":
+		return Violation{Field: field, Rule: "type", Param: schema.Type, Message: fmt.Sprintf("%s must be a JSON %s", field, schema.Type)}
+	case "format":
+		return Violation{Field: field, Rule: "format", Param: schema.Format, Message: fmt.Sprintf("%s must be a valid %s", field, schema.Format)}
+	}
+	return Violation{Field: field, Rule: schemaError.SchemaField, Message: fmt.Sprintf("%s is invalid: %s", field, schemaError.Reason)}
+}
+
+// formatNumber formats a bound of a schema without an exponent, e.g. 1000000000 rather than 1e+09.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func joinField(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
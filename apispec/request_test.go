@@ -0,0 +1,359 @@
+package apispec
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const treeId = "018f49a0-9c1d-7b2e-8f3a-4d5e6f708192"
+
+// TestRequestValidatorValidate tests the validation of the requests of every endpoint, with a valid
+// request and the ways each endpoint can be misused.
+func TestRequestValidatorValidate(t *testing.T) {
+	t.Parallel()
+
+	v, err := NewRequestValidator(NewRequestValidatorOptions{})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name               string
+		method             string
+		target             string
+		contentType        string
+		body               string
+		expectedReason     string
+		expectedViolations []Violation
+	}{
+		// POST /estate
+		{
+			name:        "Create estate",
+			method:      http.MethodPost,
+			target:      "/estate",
+			contentType: echo.MIMEApplicationJSON,
+			body:        `{"length": 10, "width": 20}`,
+		},
+		{
+			name:           "Create estate - unknown field",
+			method:         http.MethodPost,
+			target:         "/estate",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"length": 10, "width": 20, "height": 5}`,
+			expectedReason: ReasonInvalidBody,
+			expectedViolations: []Violation{
+				{Field: "height", Rule: "unknown", Message: "height is not a known field"},
+			},
+		},
+		{
+			name:           "Create estate - missing and out of range fields",
+			method:         http.MethodPost,
+			target:         "/estate",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"width": 50001}`,
+			expectedReason: ReasonInvalidBody,
+			expectedViolations: []Violation{
+				{Field: "width", Rule: "max", Param: "50000", Message: "width must be at most 50000"},
+				{Field: "length", Rule: "required", Message: "length is required"},
+			},
+		},
+		{
+			name:           "Create estate - wrong type",
+			method:         http.MethodPost,
+			target:         "/estate",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"length": "10", "width": 20}`,
+			expectedReason: ReasonInvalidBody,
+			expectedViolations: []Violation{
+				{Field: "length", Rule: "type", Param: "integer", Message: "length must be a JSON integer"},
+			},
+		},
+		{
+			name:           "Create estate - wrong content type",
+			method:         http.MethodPost,
+			target:         "/estate",
+			contentType:    "text/plain",
+			body:           `{"length": 10, "width": 20}`,
+			expectedReason: ReasonUnsupportedMediaType,
+		},
+		{
+			name:           "Create estate - malformed JSON",
+			method:         http.MethodPost,
+			target:         "/estate",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"length": 10,`,
+			expectedReason: ReasonMalformedBody,
+		},
+		{
+			name:           "Create estate - missing body",
+			method:         http.MethodPost,
+			target:         "/estate",
+			expectedReason: ReasonMalformedBody,
+		},
+		// GET /estate/{estate_id}
+		{
+			name:   "Get estate",
+			method: http.MethodGet,
+			target: "/estate/" + estateId,
+		},
+		{
+			name:           "Get estate - invalid estate ID",
+			method:         http.MethodGet,
+			target:         "/estate/abc",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "estate_id", Rule: "format", Param: "uuid", Message: "estate_id must be a valid uuid"},
+			},
+		},
+		// POST /estate/{estate_id}/tree
+		{
+			name:        "Create tree",
+			method:      http.MethodPost,
+			target:      "/estate/" + estateId + "/tree",
+			contentType: echo.MIMEApplicationJSON,
+			body:        `{"x": 1, "y": 2, "height": 30}`,
+		},
+		{
+			name:           "Create tree - height out of range and unknown field",
+			method:         http.MethodPost,
+			target:         "/estate/" + estateId + "/tree",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"x": 1, "y": 2, "height": 31, "species": "palm"}`,
+			expectedReason: ReasonInvalidBody,
+			expectedViolations: []Violation{
+				{Field: "height", Rule: "max", Param: "30", Message: "height must be at most 30"},
+				{Field: "species", Rule: "unknown", Message: "species is not a known field"},
+			},
+		},
+		// GET /estate/{estate_id}/tree/{tree_id}
+		{
+			name:   "Get tree",
+			method: http.MethodGet,
+			target: "/estate/" + estateId + "/tree/" + treeId,
+		},
+		{
+			name:           "Get tree - invalid tree ID",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/tree/1",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "tree_id", Rule: "format", Param: "uuid", Message: "tree_id must be a valid uuid"},
+			},
+		},
+		// POST /estate/{estate_id}/tree/import
+		{
+			name:        "Import trees",
+			method:      http.MethodPost,
+			target:      "/estate/" + estateId + "/tree/import",
+			contentType: "text/csv",
+			body:        "x,y,height\n1,1,10\n",
+		},
+		{
+			name:           "Import trees - unsupported content type",
+			method:         http.MethodPost,
+			target:         "/estate/" + estateId + "/tree/import",
+			contentType:    "application/vnd.ms-excel",
+			body:           "x,y,height\n1,1,10\n",
+			expectedReason: ReasonUnsupportedMediaType,
+		},
+		// GET /estate/{estate_id}/stats
+		{
+			name:   "Get stats",
+			method: http.MethodGet,
+			target: "/estate/" + estateId + "/stats?include=distribution&percentiles=50&interval=month",
+		},
+		{
+			name:           "Get stats - invalid parameters",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/stats?histogram_buckets=0&interval=hour",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "histogram_buckets", Rule: "min", Param: "1", Message: "histogram_buckets must be at least 1"},
+				{Field: "interval", Rule: "oneof", Param: "day week month quarter year", Message: "interval must be one of day, week, month, quarter, year"},
+			},
+		},
+		// GET /estate/{estate_id}/drone-plan
+		{
+			name:   "Get drone plan",
+			method: http.MethodGet,
+			target: "/estate/" + estateId + "/drone-plan?max-distance=100",
+		},
+		{
+			name:           "Get drone plan - zero max distance",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/drone-plan?max-distance=0",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "max-distance", Rule: "min", Param: "1", Message: "max-distance must be at least 1"},
+			},
+		},
+		{
+			name:           "Get drone plan - max distance too large",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/drone-plan?max-distance=1000000001",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "max-distance", Rule: "max", Param: "1000000000", Message: "max-distance must be at most 1000000000"},
+			},
+		},
+		{
+			name:           "Get drone plan - max distance is not a number",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/drone-plan?max-distance=far",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "max-distance", Rule: "type", Param: "integer", Message: "max-distance must be a valid integer"},
+			},
+		},
+		// GET /estate/{estate_id}/stats/grouped
+		{
+			name:   "Get grouped stats",
+			method: http.MethodGet,
+			target: "/estate/" + estateId + "/stats/grouped?group_by=block&block_length=5",
+		},
+		{
+			name:           "Get grouped stats - unknown grouping",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/stats/grouped?group_by=diagonal",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "group_by", Rule: "oneof", Param: "block row column", Message: "group_by must be one of block, row, column"},
+			},
+		},
+		// GET /estates/stats
+		{
+			name:   "Get portfolio stats",
+			method: http.MethodGet,
+			target: "/estates/stats?min_length=10&rank_by=density&rank_limit=3",
+		},
+		{
+			name:           "Get portfolio stats - rank limit out of range",
+			method:         http.MethodGet,
+			target:         "/estates/stats?rank_limit=101",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "rank_limit", Rule: "max", Param: "100", Message: "rank_limit must be at most 100"},
+			},
+		},
+		// GET /estate/{estate_id}/export
+		{
+			name:   "Export estate",
+			method: http.MethodGet,
+			target: "/estate/" + estateId + "/export?format=ndjson&compression=gzip",
+		},
+		{
+			name:           "Export estate - unknown format",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId + "/export?format=xml",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "format", Rule: "oneof", Param: "csv ndjson", Message: "format must be one of csv, ndjson"},
+			},
+		},
+		// GET /estates/export
+		{
+			name:   "Export estates",
+			method: http.MethodGet,
+			target: "/estates/export",
+		},
+		{
+			name:           "Export estates - unknown compression",
+			method:         http.MethodGet,
+			target:         "/estates/export?compression=zstd",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "compression", Rule: "oneof", Param: "none gzip", Message: "compression must be one of none, gzip"},
+			},
+		},
+		// GET /jobs/{job_id}
+		{
+			name:   "Get job",
+			method: http.MethodGet,
+			target: "/jobs/" + treeId,
+		},
+		{
+			name:           "Get job - invalid job ID",
+			method:         http.MethodGet,
+			target:         "/jobs/last",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "job_id", Rule: "format", Param: "uuid", Message: "job_id must be a valid uuid"},
+			},
+		},
+		// DELETE /jobs/{job_id}
+		{
+			name:   "Cancel job",
+			method: http.MethodDelete,
+			target: "/jobs/" + treeId,
+		},
+		{
+			name:           "Cancel job - invalid job ID",
+			method:         http.MethodDelete,
+			target:         "/jobs/last",
+			expectedReason: ReasonInvalidParameter,
+			expectedViolations: []Violation{
+				{Field: "job_id", Rule: "format", Param: "uuid", Message: "job_id must be a valid uuid"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tc.contentType)
+			}
+
+			err := v.Validate(req)
+
+			if tc.expectedReason == "" {
+				require.NoError(t, err)
+				// The body is still readable by the handler.
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.body, string(body))
+				return
+			}
+			var requestError *RequestError
+			require.ErrorAs(t, err, &requestError)
+			assert.Equal(t, tc.expectedReason, requestError.Reason)
+			assert.NotEmpty(t, requestError.Detail)
+			assert.ElementsMatch(t, tc.expectedViolations, requestError.Violations)
+		})
+	}
+}
+
+// TestRequestValidatorMiddleware tests that the middleware stops the invalid requests before the handlers,
+// and ignores the routes outside of the specification.
+func TestRequestValidatorMiddleware(t *testing.T) {
+	t.Parallel()
+
+	v, err := NewRequestValidator(NewRequestValidatorOptions{})
+	require.NoError(t, err)
+
+	var handled []string
+	e := echo.New()
+	e.Use(v.Middleware())
+	e.GET("/estate/:estate_id", func(ctx echo.Context) error {
+		handled = append(handled, ctx.Request().URL.Path)
+		return ctx.NoContent(http.StatusOK)
+	})
+	e.GET("/debug/vars", func(ctx echo.Context) error {
+		handled = append(handled, ctx.Request().URL.Path)
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	for _, target := range []string{"/estate/abc", "/estate/" + estateId, "/debug/vars"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	assert.Equal(t, []string{"/estate/" + estateId, "/debug/vars"}, handled)
+}
@@ -0,0 +1,167 @@
+// This file contains the validation of the responses against the OpenAPI specification.
+package apispec
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/labstack/echo/v4"
+)
+
+// maxValidatedBodySize bounds the part of a response body kept by the middleware. The body of a
+// larger response, e.g. an export, is not validated.
+const maxValidatedBodySize = 1 << 20
+
+// ResponseValidator checks the responses of the handlers against the OpenAPI specification: the
+// status must be documented for the operation, and the headers and the body must match the
+// documented response.
+type ResponseValidator struct {
+	router      routers.Router
+	onViolation func(ctx echo.Context, err error)
+}
+
+type NewResponseValidatorOptions struct {
+	// Spec defaults to the specification embedded in the generated package.
+	Spec *openapi3.T
+	// OnViolation is called by the middleware for every response that does not match the
+	// specification, once the response is sent. Defaults to logging the violation.
+	OnViolation func(ctx echo.Context, err error)
+}
+
+// NewResponseValidator creates a new ResponseValidator with the provided options.
+func NewResponseValidator(opts NewResponseValidatorOptions) (*ResponseValidator, error) {
+	router, err := newRouter(opts.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &ResponseValidator{
+		router:      router,
+		onViolation: opts.OnViolation,
+	}
+	if v.onViolation == nil {
+		v.onViolation = func(ctx echo.Context, err error) {
+			slog.ErrorContext(ctx.Request().Context(), "err response does not match the OpenAPI specification", "method", ctx.Request().Method, "path", ctx.Request().URL.Path, "error", err)
+		}
+	}
+	return v, nil
+}
+
+// Validate checks the response to req. The body is not validated when it is nil, or when its media
+// type can not be decoded, e.g. application/gzip, in which case only the media type is checked.
+func (v *ResponseValidator) Validate(req *http.Request, status int, header http.Header, body []byte) error {
+	route, pathParams, err := v.router.FindRoute(req)
+	if err != nil {
+		return fmt.Errorf("finding the operation of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+
+	options := &openapi3filter.Options{IncludeResponseStatus: true}
+	mediaType, _, _ := mime.ParseMediaType(header.Get(echo.HeaderContentType))
+	if body == nil || (len(body) > 0 && openapi3filter.RegisteredBodyDecoder(mediaType) == nil) {
+		options.ExcludeResponseBody = true
+		if err := validateMediaType(route, status, mediaType); err != nil {
+			return err
+		}
+	}
+
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status:  status,
+		Header:  header,
+		Options: options,
+	}
+	input.SetBodyBytes(body)
+	return openapi3filter.ValidateResponse(req.Context(), input)
+}
+
+// validateMediaType checks that the media type of a response whose body is not validated is
+// documented for its status.
+func validateMediaType(route *routers.Route, status int, mediaType string) error {
+	if mediaType == "" {
+		return nil
+	}
+	response := route.Operation.Responses.Get(status)
+	if response == nil || response.Value == nil || len(response.Value.Content) == 0 {
+		return nil
+	}
+	if response.Value.Content.Get(mediaType) == nil {
+		return fmt.Errorf("response header Content-Type has unexpected value: %q", mediaType)
+	}
+	return nil
+}
+
+// Middleware validates the responses to the operations of the specification once they are sent.
+// The other routes, e.g. /metrics, are ignored.
+func (v *ResponseValidator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if _, _, err := v.router.FindRoute(ctx.Request()); err != nil {
+				return next(ctx)
+			}
+
+			resp := ctx.Response()
+			recorder := &bodyRecorder{ResponseWriter: resp.Writer}
+			resp.Writer = recorder
+			if err := next(ctx); err != nil {
+				// Let the error handler write the response, so that it is validated as well.
+				ctx.Error(err)
+			}
+			resp.Writer = recorder.ResponseWriter
+
+			if !resp.Committed {
+				return nil
+			}
+			if err := v.Validate(ctx.Request(), resp.Status, resp.Header(), recorder.Body()); err != nil {
+				v.onViolation(ctx, err)
+			}
+			return nil
+		}
+	}
+}
+
+// bodyRecorder keeps a copy of the first maxValidatedBodySize bytes of the body written to a response.
+type bodyRecorder struct {
+	http.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	if !r.truncated {
+		if r.body.Len()+len(b) > maxValidatedBodySize {
+			r.truncated = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Body returns the recorded body, or nil when the body is too large to be recorded.
+func (r *bodyRecorder) Body() []byte {
+	if r.truncated {
+		return nil
+	}
+	return r.body.Bytes()
+}
+
+func (r *bodyRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *bodyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,179 @@
+package apispec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const estateId = "018f49a0-88be-7fd6-a964-4f9742dbc90e"
+
+func jsonHeader(values ...string) http.Header {
+	header := http.Header{}
+	header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for i := 0; i < len(values); i += 2 {
+		header.Set(values[i], values[i+1])
+	}
+	return header
+}
+
+// TestResponseValidatorValidate tests the checks of the status, the headers and the body of the responses.
+func TestResponseValidatorValidate(t *testing.T) {
+	t.Parallel()
+
+	v, err := NewResponseValidator(NewResponseValidatorOptions{})
+	require.NoError(t, err)
+
+	problemHeader := http.Header{}
+	problemHeader.Set(echo.HeaderContentType, "application/problem+json")
+	gzipHeader := http.Header{}
+	gzipHeader.Set(echo.HeaderContentType, "application/gzip")
+
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		header      http.Header
+		body        []byte
+		expectedErr string
+	}{
+		{
+			name:   "Created estate",
+			method: http.MethodPost,
+			path:   "/estate",
+			status: http.StatusCreated,
+			header: jsonHeader(echo.HeaderLocation, "/estate/"+estateId),
+			body:   []byte(`{"id":"` + estateId + `"}`),
+		},
+		{
+			name:        "Undocumented status",
+			method:      http.MethodPost,
+			path:        "/estate",
+			status:      http.StatusOK,
+			header:      jsonHeader(),
+			body:        []byte(`{"id":"` + estateId + `"}`),
+			expectedErr: "status is not supported",
+		},
+		{
+			name:        "Missing Location header",
+			method:      http.MethodPost,
+			path:        "/estate",
+			status:      http.StatusCreated,
+			header:      jsonHeader(),
+			body:        []byte(`{"id":"` + estateId + `"}`),
+			expectedErr: `response header "Location" missing`,
+		},
+		{
+			name:        "Body does not match the schema",
+			method:      http.MethodGet,
+			path:        "/estate/" + estateId + "/drone-plan",
+			status:      http.StatusOK,
+			header:      jsonHeader(),
+			body:        []byte(`{"distance":"far"}`),
+			expectedErr: "response body doesn't match schema",
+		},
+		{
+			name:   "Problem",
+			method: http.MethodGet,
+			path:   "/estate/" + estateId + "/stats",
+			status: http.StatusNotFound,
+			header: problemHeader,
+			body:   []byte(`{"type":"/problems/estate_not_found","title":"Estate not found","status":404,"code":"estate_not_found"}`),
+		},
+		{
+			name:        "Error without a problem",
+			method:      http.MethodGet,
+			path:        "/estate/" + estateId + "/stats",
+			status:      http.StatusNotFound,
+			header:      jsonHeader(),
+			body:        []byte(`{"error":"Estate not found"}`),
+			expectedErr: "response header Content-Type has unexpected value",
+		},
+		{
+			name:   "Compressed export",
+			method: http.MethodGet,
+			path:   "/estates/export",
+			status: http.StatusOK,
+			header: gzipHeader,
+			body:   []byte{0x1f, 0x8b},
+		},
+		{
+			name:        "Undocumented media type of a body which is not validated",
+			method:      http.MethodGet,
+			path:        "/estates/export",
+			status:      http.StatusOK,
+			header:      jsonHeader(echo.HeaderContentType, "application/zstd"),
+			body:        []byte{0x28, 0xb5},
+			expectedErr: `response header Content-Type has unexpected value: "application/zstd"`,
+		},
+		{
+			name:        "Unknown route",
+			method:      http.MethodGet,
+			path:        "/debug/vars",
+			status:      http.StatusOK,
+			header:      jsonHeader(),
+			body:        []byte(`{}`),
+			expectedErr: "finding the operation of GET /debug/vars",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+
+			err := v.Validate(req, tc.status, tc.header, tc.body)
+
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// TestResponseValidatorMiddleware tests that the middleware reports the responses of the handlers, including
+// the ones written by the error handler, and ignores the routes outside of the specification.
+func TestResponseValidatorMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var violations []error
+	v, err := NewResponseValidator(NewResponseValidatorOptions{
+		OnViolation: func(ctx echo.Context, err error) {
+			violations = append(violations, err)
+		},
+	})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(v.Middleware())
+	e.POST("/estate", func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"id": estateId})
+	})
+	e.GET("/estate/:estate_id", func(ctx echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot)
+	})
+	e.GET("/debug/vars", func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{})
+	})
+
+	for _, target := range []string{"/estate", "/estate/" + estateId, "/debug/vars"} {
+		method := http.MethodGet
+		if target == "/estate" {
+			method = http.MethodPost
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	}
+
+	require.Len(t, violations, 2)
+	assert.ErrorContains(t, violations[0], "status is not supported")
+	assert.ErrorContains(t, violations[1], "status is not supported")
+}
@@ -0,0 +1,32 @@
+// Package apispec checks the traffic of the service against its OpenAPI specification, as embedded
+// in the generated package.
+package apispec
+
+import (
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+)
+
+func init() {
+	// The uuid format is not validated by default. Any version is accepted, the service creates v4 UUIDs
+	// but the clients may send others.
+	openapi3.DefineStringFormat("uuid", `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+}
+
+// newRouter matches the requests with the operations of the specification. The servers of the
+// specification are dropped, so that the paths are matched whatever the host the service runs on.
+func newRouter(spec *openapi3.T) (routers.Router, error) {
+	if spec == nil {
+		var err error
+		spec, err = generated.GetSwagger()
+		if err != nil {
+			return nil, fmt.Errorf("loading the OpenAPI specification: %w", err)
+		}
+	}
+	spec.Servers = nil
+	return legacy.NewRouter(spec)
+}
@@ -0,0 +1,26 @@
+// This file contains the config command, which shows the configuration the other commands run with.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// runConfig prints the effective configuration, read from the environment, the configuration file and the
+// defaults, with the passwords of the connection strings masked. It fails like the other commands when the
+// configuration is invalid.
+func runConfig(c *cli, args []string) error {
+	flags := c.flagSet("config", " print")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || flags.Arg(0) != "print" {
+		flags.Usage()
+		return fmt.Errorf("expected print, got %q", strings.Join(flags.Args(), " "))
+	}
+	config, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	return c.printJSON(config.Settings())
+}
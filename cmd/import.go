@@ -0,0 +1,184 @@
+// This file contains the import and export commands, which move estates and trees in and out of files.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/export"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+// importFormats maps the formats of the -format flags to the content types of the import files.
+var importFormats = map[string]string{
+	export.FormatCSV:    job.ContentTypeCSV,
+	export.FormatNDJSON: job.ContentTypeNDJSON,
+}
+
+// readImportFile reads an import file, - being the standard input, and returns its content type.
+// The format defaults to the extension of the file.
+func readImportFile(path, format string) (payload []byte, contentType string, err error) {
+	if format == "" {
+		format = filepath.Ext(path)
+		if len(format) > 0 {
+			format = format[1:]
+		}
+	}
+	contentType, ok := importFormats[format]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown format %q, expected csv or ndjson", format)
+	}
+
+	if path == "-" {
+		payload, err = io.ReadAll(os.Stdin)
+	} else {
+		payload, err = os.ReadFile(path)
+	}
+	return payload, contentType, err
+}
+
+// runImport creates the trees of a file in an existing estate, or in the estate of the given dimensions,
+// applying the rules of the import jobs. Rows which cannot be imported are reported and skipped.
+func runImport(c *cli, args []string) error {
+	flags := c.flagSet("import", " <file>")
+	estateId := flags.String("estate", "", "ID of the estate the trees are planted in")
+	length := flags.Int("length", 0, "length of the estate the trees are planted in, created when it does not exist, instead of -estate")
+	width := flags.Int("width", 0, "width of the estate the trees are planted in, created when it does not exist, instead of -estate")
+	format := flags.String("format", "", "format of the file, csv or ndjson, defaults to the extension of the file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected the file to import, or - for the standard input")
+	}
+	if (*estateId == "") == (*length == 0 && *width == 0) {
+		return errors.New("expected either -estate or -length and -width")
+	}
+	payload, contentType, err := readImportFile(flags.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *estateId == "" {
+		if *length < 1 || *length > repository.MaxEstateDimension || *width < 1 || *width > repository.MaxEstateDimension {
+			return fmt.Errorf("-length and -width must be between 1 and %d", repository.MaxEstateDimension)
+		}
+		output, err := repo.CreateEstate(ctx, &repository.CreateEstateInput{Id: uuid.New().String(), Length: uint16(*length), Width: uint16(*width)})
+		if err != nil {
+			return err
+		}
+		*estateId = output.Id
+	}
+	estate, err := repo.GetEstateByEstateId(ctx, &repository.GetEstateByEstateIdInput{Id: *estateId})
+	if err != nil {
+		return err
+	}
+	if estate == nil {
+		return fmt.Errorf("estate %s not found", *estateId)
+	}
+
+	type rowError struct {
+		Row     int    `json:"row"`
+		Message string `json:"message"`
+	}
+	output := struct {
+		EstateId      string     `json:"estate_id"`
+		ProcessedRows int        `json:"processed_rows"`
+		SucceededRows int        `json:"succeeded_rows"`
+		FailedRows    int        `json:"failed_rows"`
+		Errors        []rowError `json:"errors,omitempty"`
+	}{EstateId: *estateId}
+	err = job.ParseImportRows(contentType, payload, func(rowNumber int, row *job.ImportRow, rowErr error) error {
+		if rowErr == nil {
+			rowErr = job.ValidateImportRow(row, estate.Estate)
+		}
+		if rowErr == nil {
+			var err error
+			if rowErr, err = job.ImportTree(ctx, repo, *estateId, row); err != nil {
+				return err
+			}
+		}
+		output.ProcessedRows++
+		if rowErr != nil {
+			output.FailedRows++
+			output.Errors = append(output.Errors, rowError{Row: rowNumber, Message: rowErr.Error()})
+		} else {
+			output.SucceededRows++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.printJSON(output)
+}
+
+// runExport writes the trees of an estate, or of all estates, in the format of the export endpoints.
+func runExport(c *cli, args []string) error {
+	flags := c.flagSet("export", "")
+	estateId := flags.String("estate", "", "ID of the exported estate, all estates are exported when empty")
+	format := flags.String("format", export.FormatCSV, "format of the export, csv or ndjson")
+	outputPath := flags.String("o", "-", "file the export is written to, - for the standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *estateId != "" {
+		estate, err := repo.GetEstateByEstateId(ctx, &repository.GetEstateByEstateIdInput{Id: *estateId})
+		if err != nil {
+			return err
+		}
+		if estate == nil {
+			return fmt.Errorf("estate %s not found", *estateId)
+		}
+	}
+
+	out := c.stdout
+	var file *os.File
+	if *outputPath != "-" {
+		if file, err = os.Create(*outputPath); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	rowWriter, err := export.NewRowWriter(out, *format)
+	if err != nil {
+		return err
+	}
+	_, err = repo.ExportEstateTrees(ctx, &repository.ExportEstateTreesInput{
+		EstateId: *estateId,
+		OnRow:    rowWriter.WriteRow,
+	})
+	if err != nil {
+		return err
+	}
+	if err = rowWriter.Flush(); err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// This file contains the loadtest command, which measures how much load an instance of the API sustains.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/loadtest"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+// runLoadTest runs the scenario file against a running instance, or against an instance started within the
+// command on the in-memory repository, and prints the report.
+func runLoadTest(c *cli, args []string) error {
+	flags := c.flagSet("loadtest", " <scenario>")
+	url := flags.String("url", "http://localhost:1323", "URL of the tested instance")
+	memory := flags.Bool("memory", false, "test an instance started on the in-memory repository instead of -url")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a scenario file, got %q", flags.Args())
+	}
+	scenario, err := loadtest.LoadScenario(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *memory {
+		var stop func()
+		*url, stop, err = c.startMemoryServer()
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	slog.Info("running scenario", "scenario", scenario.Name, "url", *url)
+	report, err := loadtest.NewRunner(loadtest.NewRunnerOptions{BaseURL: *url, Scenario: scenario}).Run(ctx)
+	if report != nil {
+		// An interrupted run still reports its completed stages.
+		if err := c.printJSON(report); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// startMemoryServer serves the API on a free local port, backed by a new in-memory repository, and returns its
+// URL with the function stopping it.
+func (c *cli) startMemoryServer() (string, func(), error) {
+	if _, err := c.loadConfig(); err != nil {
+		return "", nil, err
+	}
+	c.repo = repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{})
+	app, err := newApp(c)
+	if err != nil {
+		return "", nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	// The request log would drown the report, which shares the standard output.
+	httpServer := &http.Server{Handler: newEcho(app, false)}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("err serving the load test", "error", err)
+		}
+	}()
+	stop := func() {
+		httpServer.Close()
+		app.tracing.Shutdown(context.Background())
+	}
+	return "http://" + listener.Addr().String(), stop, nil
+}
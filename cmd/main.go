@@ -1,62 +1,192 @@
+// This file contains the entry point of the binary, which dispatches to its subcommands.
 package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
-	"os/signal"
-	"time"
+	"strings"
 
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
-	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
-	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/handler"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/logging"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/migration"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
-	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/validator"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	gommonlog "github.com/labstack/gommon/log"
 )
 
+// command is a subcommand of the binary, run with the arguments following its name.
+type command struct {
+	name    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands = []command{
+	{name: "serve", summary: "start the HTTP server", run: runServe},
+	{name: "migrate", summary: "apply, revert or show the database migrations", run: runMigrate},
+	{name: "import", summary: "import the trees of an estate from a CSV or NDJSON file", run: runImport},
+	{name: "export", summary: "export the trees of an estate or of all estates as CSV or NDJSON", run: runExport},
+	{name: "plan", summary: "compute the drone plan of an estate, or of the trees of a file, and print it", run: runPlan},
+	{name: "stats", summary: "print the tree statistics of an estate or of all estates", run: runStats},
+	{name: "seed", summary: "generate synthetic estates and trees", run: runSeed},
+	{name: "loadtest", summary: "run a load test scenario against the HTTP API and report its latencies", run: runLoadTest},
+	{name: "config", summary: "print the effective configuration, with its secrets masked", run: runConfig},
+}
+
+// defaultConfigPath is the configuration file read unless -config tells another one.
+const defaultConfigPath = ".env"
+
+// cli holds what the subcommands share. The configuration and the repository are loaded on first use,
+// so that the commands which do not need them also work without a database.
+type cli struct {
+	stdout, stderr io.Writer
+	configPath     string
+
+	config *config.Config
+	repo   repository.RepositoryInterface
+}
+
 func main() {
-	e := echo.New()
+	// Echo logs to the standard output by default, which the commands keep for their results.
+	gommonlog.SetOutput(os.Stderr)
+	c := &cli{stdout: os.Stdout, stderr: os.Stderr, configPath: defaultConfigPath}
+	err := c.run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		// Like the flag package, asking for help is not a failure.
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(c.stderr, "Error:", err)
+		os.Exit(2)
+	}
+}
 
-	e.Validator = validator.NewRequestValidator()
+// run dispatches args to their subcommand. Without a subcommand, or with flags only, the server is started,
+// like before the subcommands existed.
+func (c *cli) run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" {
+		return runServe(c, args)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	c.usage()
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
 
-	var server generated.ServerInterface = newServer()
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(c.stderr, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+}
+
+// flagSet returns the flags of a subcommand, including the -config flag shared by all of them.
+func (c *cli) flagSet(name, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&c.configPath, "config", c.configPath, "path of the configuration file")
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: %s %s [flags]%s\n\nFlags:\n", os.Args[0], name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
 
-	generated.RegisterHandlers(e, server)
-	e.Use(middleware.Logger())
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
-	// Start server
-	go func() {
-		if err := e.Start(":1323"); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
+// loadConfig reads the configuration from the environment and the configuration file, and configures the logs of
+// the commands accordingly. The default configuration file is optional, the configuration may come from the
+// environment only.
+func (c *cli) loadConfig() (*config.Config, error) {
+	if c.config == nil {
+		path := c.configPath
+		if _, err := os.Stat(path); path == defaultConfigPath && errors.Is(err, fs.ErrNotExist) {
+			path = ""
+		}
+		config, err := config.NewConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("err loading config: %w", err)
 		}
-	}()
-	<-ctx.Done()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // 10 seconds wait for graceful shutdown
-	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+		// The logs go to the standard error, which keeps the standard output for the results of the commands.
+		logger, err := logging.NewLogger(logging.NewLoggerOptions{
+			Level:  config.LogLevel,
+			Format: config.LogFormat,
+			Writer: c.stderr,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("err loading config: %w", err)
+		}
+		slog.SetDefault(logger)
+		c.config = config
 	}
+	return c.config, nil
 }
 
-func newServer() *handler.Server {
-	config, err := config.NewConfig(".env")
-	if err != nil {
-		log.Fatalf("Error loading config: %s", err.Error())
+// repository connects to the repository of the backend selected by the configuration.
+func (c *cli) repository() (repository.RepositoryInterface, error) {
+	if c.repo == nil {
+		config, err := c.loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		repo, err := newRepository(config)
+		if err != nil {
+			return nil, err
+		}
+		c.repo = repo
+		slog.Info("successfully initialized repository", "backend", c.config.RepositoryBackend)
+	}
+	return c.repo, nil
+}
+
+// printJSON writes v to the standard output as indented JSON.
+func (c *cli) printJSON(v any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// newRepository creates the repository of the backend selected by the configuration.
+func newRepository(config *config.Config) (repository.RepositoryInterface, error) {
+	switch config.RepositoryBackend {
+	case "", repository.BackendPostgres:
+		ctx, cancel := context.WithTimeout(context.Background(), config.DBConnectTimeout)
+		defer cancel()
+		return repository.Connect(ctx, repository.NewRepositoryOptions{
+			Dsn:             config.DatabaseURL,
+			MaxOpenConns:    config.DBMaxOpenConns,
+			MaxIdleConns:    config.DBMaxIdleConns,
+			ConnMaxLifetime: config.DBConnMaxLifetime,
+		})
+	case repository.BackendMemory:
+		slog.Warn("using the in-memory repository, the data is lost when the server stops")
+		return repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{}), nil
+	case repository.BackendSQLite:
+		return repository.NewSQLiteRepository(repository.NewSQLiteRepositoryOptions{
+			Path: config.SQLitePath,
+		})
 	}
+	return nil, fmt.Errorf("err loading config: unknown repository backend %q", config.RepositoryBackend)
+}
 
-	dbDsn := config.DatabaseURL
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
-		Dsn: dbDsn,
-	})
-	log.Println("Successfully initialized repository")
-	opts := handler.NewServerOptions{
-		Repository: repo,
-		Config:     config,
+// newMigrator returns the migrator of the PostgreSQL database of repo.
+// The other backends create their schema when they are opened, so they have no migrations.
+func newMigrator(repo repository.RepositoryInterface) (*migration.Migrator, error) {
+	postgres, ok := repo.(*repository.Repository)
+	if !ok {
+		return nil, errors.New("migrations only apply to the postgres backend")
 	}
-	return handler.NewServer(opts)
+	return migration.NewMigrator(migration.NewMigratorOptions{Db: postgres.Db})
 }
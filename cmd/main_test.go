@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generator"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generator/generatortest"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/loadtest"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/logging"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/tracing"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestCLI returns a cli backed by an in-memory repository, whose results are written to the returned buffer.
+func setupTestCLI(t *testing.T) (*cli, *bytes.Buffer) {
+	t.Helper()
+	stdout := &bytes.Buffer{}
+	return &cli{
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		config: &config.Config{ScaleFactor: 10},
+		repo:   repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{}),
+	}, stdout
+}
+
+// runTestCommand runs a command and decodes its JSON result into result.
+func runTestCommand(t *testing.T, c *cli, stdout *bytes.Buffer, result any, args ...string) {
+	t.Helper()
+	stdout.Reset()
+	require.NoError(t, c.run(args))
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), result), stdout.String())
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	assert.EqualError(t, c.run([]string{"plant"}), `unknown command "plant"`)
+	assert.Contains(t, c.stderr.(*bytes.Buffer).String(), "seed")
+}
+
+func TestImportPlanExport(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+	file := writeTestFile(t, "trees.csv", "x,y,height\n5,1,5\n6,1,5\n5,1,7\n")
+
+	var imported struct {
+		EstateId      string `json:"estate_id"`
+		ProcessedRows int    `json:"processed_rows"`
+		SucceededRows int    `json:"succeeded_rows"`
+		FailedRows    int    `json:"failed_rows"`
+		Errors        []struct {
+			Row     int    `json:"row"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	runTestCommand(t, c, stdout, &imported, "import", "-length", "5", "-width", "1", file)
+	assert.NotEmpty(t, imported.EstateId)
+	assert.Equal(t, 3, imported.ProcessedRows)
+	assert.Equal(t, 1, imported.SucceededRows)
+	assert.Equal(t, 2, imported.FailedRows)
+	require.Len(t, imported.Errors, 2)
+	assert.Equal(t, 2, imported.Errors[0].Row)
+	assert.Equal(t, "plot (6, 1) is outside of the estate", imported.Errors[0].Message)
+	assert.Equal(t, "a tree already exists at plot (5, 1)", imported.Errors[1].Message)
+
+	var plan planOutput
+	runTestCommand(t, c, stdout, &plan, "plan", "-estate", imported.EstateId)
+	assert.Equal(t, 52, plan.Distance)
+	require.NotNil(t, plan.HorizontalDistance)
+	assert.Equal(t, 40, *plan.HorizontalDistance)
+	assert.Nil(t, plan.Rest)
+
+	runTestCommand(t, c, stdout, &plan, "plan", "-estate", imported.EstateId, "-max-distance", "46")
+	assert.Equal(t, 46, plan.Distance)
+	assert.Equal(t, &plotOutput{X: 4, Y: 1}, plan.Rest)
+	assert.Equal(t, "partial", plan.Outcome)
+
+	var stats heightStatsOutput
+	runTestCommand(t, c, stdout, &stats, "stats", "-estate", imported.EstateId)
+	assert.Equal(t, heightStatsOutput{Count: 1, Max: 5, Min: 5, Median: 5, Mean: 5}, stats)
+
+	stdout.Reset()
+	require.NoError(t, c.run([]string{"export", "-estate", imported.EstateId, "-format", "ndjson"}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"height":5`)
+
+	// A single estate export can be imported again.
+	exported := filepath.Join(t.TempDir(), "estate.csv")
+	require.NoError(t, c.run([]string{"export", "-estate", imported.EstateId, "-o", exported}))
+	runTestCommand(t, c, stdout, &imported, "import", "-estate", imported.EstateId, exported)
+	assert.Equal(t, 1, imported.FailedRows)
+	assert.Equal(t, "a tree already exists at plot (5, 1)", imported.Errors[0].Message)
+}
+
+func TestPlanFile(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+	c.config = nil
+
+	t.Run("Offline", func(t *testing.T) {
+		file := writeTestFile(t, "trees.ndjson", `{"x":5,"y":1,"height":5}`+"\n"+`{"x":5,"y":2,"height":10}`+"\n")
+		var plan planOutput
+		runTestCommand(t, c, stdout, &plan, "plan", "-file", file, "-length", "5", "-width", "2", "-scale-factor", "10", "-max-distance", "112")
+		assert.Equal(t, &plotOutput{X: 1, Y: 2}, plan.Rest)
+	})
+
+	t.Run("Grounded", func(t *testing.T) {
+		file := writeTestFile(t, "trees.csv", "x,y,height\n")
+		var plan planOutput
+		runTestCommand(t, c, stdout, &plan, "plan", "-file", file, "-length", "5", "-width", "2", "-scale-factor", "10", "-max-distance", "1")
+		assert.Nil(t, plan.Rest)
+		assert.Equal(t, "grounded", plan.Outcome)
+	})
+
+	t.Run("Invalid row", func(t *testing.T) {
+		file := writeTestFile(t, "trees.csv", "x,y,height\n1,1,31\n")
+		err := c.run([]string{"plan", "-file", file, "-length", "5", "-width", "2", "-scale-factor", "10"})
+		assert.EqualError(t, err, "row 1: height 31 is not between 1 and 30")
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		file := writeTestFile(t, "trees.txt", "")
+		err := c.run([]string{"plan", "-file", file, "-length", "5", "-width", "2", "-scale-factor", "10"})
+		assert.EqualError(t, err, `unknown format "txt", expected csv or ndjson`)
+	})
+}
+
+func TestSeedAndPortfolioStats(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+
+	var seeded struct {
+		Seed      int64    `json:"seed"`
+		EstateIds []string `json:"estate_ids"`
+		Trees     int      `json:"trees"`
+	}
+	runTestCommand(t, c, stdout, &seeded, "seed", "-estates", "3", "-max-length", "20", "-max-width", "20", "-density", "1", "-seed", "7")
+	assert.Equal(t, int64(7), seeded.Seed)
+	require.Len(t, seeded.EstateIds, 3)
+	assert.Positive(t, seeded.Trees)
+
+	var stats struct {
+		Estates int                `json:"estates"`
+		Plots   int                `json:"plots"`
+		Count   int                `json:"count"`
+		Top     []estateRankOutput `json:"top"`
+	}
+	runTestCommand(t, c, stdout, &stats, "stats", "-rank-limit", "1")
+	// With a density of 1 every plot is planted.
+	assert.Equal(t, seeded.Trees, stats.Count)
+	assert.Equal(t, stats.Plots, stats.Count)
+	assert.Len(t, stats.Top, 1)
+}
+
+func TestSeedFiles(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+	dir := t.TempDir()
+
+	var seeded struct {
+		Seed  int64    `json:"seed"`
+		Trees int      `json:"trees"`
+		Files []string `json:"files"`
+	}
+	args := []string{"seed", "-estates", "2", "-min-length", "5", "-max-length", "10", "-pattern", "grid", "-row-spacing", "2", "-density", "0.8", "-heights", "normal", "-seed", "3", "-format", "ndjson", "-o", dir}
+	runTestCommand(t, c, stdout, &seeded, args...)
+	require.Len(t, seeded.Files, 2)
+	first, err := os.ReadFile(seeded.Files[0])
+	require.NoError(t, err)
+
+	// The same seed writes the same files.
+	runTestCommand(t, c, stdout, &seeded, args...)
+	again, err := os.ReadFile(seeded.Files[0])
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// The repository is untouched, and the files can be imported.
+	estates := generatortest.Generate(t, generator.Options{Seed: 3, Estates: 2, MinLength: 5, MaxLength: 10, MinWidth: 1, MaxWidth: 100, Pattern: generator.PatternGrid, RowSpacing: 2, Density: 0.8, Heights: generator.HeightsNormal})
+	var imported struct {
+		SucceededRows int `json:"succeeded_rows"`
+	}
+	runTestCommand(t, c, stdout, &imported, "import", "-length", strconv.Itoa(estates[0].Length), "-width", strconv.Itoa(estates[0].Width), seeded.Files[0])
+	assert.Equal(t, len(estates[0].Trees), imported.SucceededRows)
+}
+
+func TestStatsOfGeneratedEstates(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+	estates := generatortest.Seed(t, c.repo, generator.Options{Seed: 5, Estates: 4, MaxLength: 20, MaxWidth: 20, Density: 0.5})
+
+	var stats heightStatsOutput
+	runTestCommand(t, c, stdout, &stats, "stats", "-estate", estates[0].Id)
+	assert.Equal(t, len(estates[0].Trees), stats.Count)
+}
+
+func TestLoadTestMemory(t *testing.T) {
+	c, stdout := setupTestCLI(t)
+	scenario := writeTestFile(t, "scenario.json", `{
+		"name": "smoke",
+		"setup": [{"action": "create_estate", "length": 10, "width": 10}],
+		"stages": [{"concurrency": 2, "duration": "200ms"}],
+		"cases": [{"name": "read", "steps": [{"action": "get_stats"}, {"action": "get_drone_plan"}]}]
+	}`)
+
+	var report loadtest.Report
+	runTestCommand(t, c, stdout, &report, "loadtest", "-memory", scenario)
+	assert.Equal(t, "smoke", report.Scenario)
+	require.Len(t, report.Stages, 1)
+	assert.Positive(t, report.Stages[0].Total.Requests)
+	assert.Zero(t, report.Stages[0].Total.Errors, report.Stages[0].Total.Statuses)
+}
+
+func TestServeMetrics(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	c.config.PlanCacheSize = 10
+	url, stop, err := c.startMemoryServer()
+	require.NoError(t, err)
+	defer stop()
+
+	response, err := http.Post(url+"/estate", "application/json", strings.NewReader(`{"length": 10, "width": 10}`))
+	require.NoError(t, err)
+	var estate struct {
+		Id string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&estate))
+	response.Body.Close()
+	for _, path := range []string{"/estate/" + estate.Id + "/drone-plan", "/estate/" + estate.Id + "/drone-plan?max-distance=0"} {
+		response, err = http.Get(url + path)
+		require.NoError(t, err)
+		response.Body.Close()
+	}
+
+	response, err = http.Get(url + "/metrics")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	for _, line := range []string{
+		`http_requests_total{method="POST",route="/estate",status="201"} 1`,
+		`http_requests_total{method="GET",route="/estate/:estate_id/drone-plan",status="200"} 1`,
+		`http_requests_total{method="GET",route="/estate/:estate_id/drone-plan",status="400"} 1`,
+		`db_query_duration_seconds_count{method="GetEstateTreesByEstateId",outcome="ok"} 1`,
+		`drone_planner_plots_visited_sum 100`,
+		`drone_planner_estate_plots_count 1`,
+		`estates_created_total 1`,
+		`trees_created_total 0`,
+		`drone_plan_cache_misses_total 1`,
+		`drone_plan_cache_size 1`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
+
+func TestServeProbes(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	url, stop, err := c.startMemoryServer()
+	require.NoError(t, err)
+	defer stop()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		response, err := http.Get(url + path)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode, path)
+		response.Body.Close()
+	}
+}
+
+func TestServeRequestID(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	url, stop, err := c.startMemoryServer()
+	require.NoError(t, err)
+	defer stop()
+
+	request, err := http.NewRequest(http.MethodGet, url+"/estate/8d5a0a55-8b1f-4c9b-9d31-bd1d8f0b3f47/stats", nil)
+	require.NoError(t, err)
+	request.Header.Set("X-Request-ID", "req-42")
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, "req-42", response.Header.Get("X-Request-ID"))
+
+	// The requests without an ID are given one.
+	response, err = http.Get(url + "/healthz")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.NotEmpty(t, response.Header.Get("X-Request-ID"))
+}
+
+func TestReadinessChecks(t *testing.T) {
+	// The in-memory repository has no database to wait for.
+	assert.Empty(t, readinessChecks(repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{})))
+
+	sqlite, err := repository.NewSQLiteRepository(repository.NewSQLiteRepositoryOptions{Path: filepath.Join(t.TempDir(), "test.db")})
+	require.NoError(t, err)
+	checks := readinessChecks(sqlite)
+	require.Contains(t, checks, "database")
+	assert.NotContains(t, checks, "migrations")
+	assert.NoError(t, checks["database"](context.Background()))
+	require.NoError(t, sqlite.Db.Close())
+	assert.Error(t, checks["database"](context.Background()))
+}
+
+// blockingRepository blocks the creation of the trees until the job is interrupted.
+type blockingRepository struct {
+	repository.RepositoryInterface
+	creating chan struct{}
+}
+
+func (r *blockingRepository) CreateTree(ctx context.Context, input *repository.CreateTreeInput) (*repository.CreateTreeOutput, error) {
+	close(r.creating)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestShutdownApp(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	memory := c.repo
+	repo := &blockingRepository{RepositoryInterface: memory, creating: make(chan struct{})}
+	c.repo = repo
+	app, err := newApp(c)
+	require.NoError(t, err)
+	e := newEcho(app, false)
+	// A request outliving the shutdown, like a streamed export.
+	streaming, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	e.GET("/stream", func(ctx echo.Context) error {
+		close(streaming)
+		<-release
+		return nil
+	})
+	e.Listener, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go e.Start("")
+	go http.Get("http://" + e.Listener.Addr().String() + "/stream")
+	<-streaming
+
+	ctx := context.Background()
+	estate, err := memory.CreateEstate(ctx, &repository.CreateEstateInput{Id: "8d5a0a55-8b1f-4c9b-9d31-bd1d8f0b3f47", Length: 10, Width: 10})
+	require.NoError(t, err)
+	created, err := memory.CreateJob(ctx, &repository.CreateJobInput{
+		Id:          "53c6b5a1-0b8e-4ac0-8f6e-3a5a7c2d4b9e",
+		Kind:        repository.JobKindTreeImport,
+		EstateId:    estate.Id,
+		ContentType: job.ContentTypeCSV,
+		Payload:     []byte("x,y,height\n1,1,5\n"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, app.server.JobManager.Start(ctx))
+	app.server.JobManager.Notify()
+	<-repo.creating
+
+	// The server misses the deadline, the running job is checkpointed regardless.
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, shutdownApp(ctx, e, app), context.DeadlineExceeded)
+	stored, err := memory.GetJobByJobId(context.Background(), &repository.GetJobByJobIdInput{Id: created.Job.Id})
+	require.NoError(t, err)
+	assert.Equal(t, repository.JobStateQueued, stored.Job.State)
+}
+
+// TestConfigNames tests that the names accepted by the configuration are the names of the packages owning them.
+func TestConfigNames(t *testing.T) {
+	assert.Equal(t, []string{repository.BackendPostgres, repository.BackendSQLite, repository.BackendMemory},
+		[]string{config.BackendPostgres, config.BackendSQLite, config.BackendMemory})
+	assert.Equal(t, []string{tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP},
+		[]string{config.TracingExporterNone, config.TracingExporterStdout, config.TracingExporterOTLP})
+	assert.Equal(t, []string{logging.FormatJSON, logging.FormatText}, []string{config.LogFormatJSON, config.LogFormatText})
+}
+
+func TestConfigPrint(t *testing.T) {
+	// loadConfig configures the default logger.
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	c, stdout := setupTestCLI(t)
+	c.config = nil
+	c.configPath = filepath.Join(t.TempDir(), "test.env")
+	require.NoError(t, os.WriteFile(c.configPath, []byte("DATABASE_URL=postgres://postgres:s3cr3t@db:5432/database\nSCALE_FACTOR=5\n"), 0o600))
+	t.Setenv("PORT", "8080")
+
+	var settings map[string]any
+	runTestCommand(t, c, stdout, &settings, "config", "print")
+	assert.Equal(t, "postgres://postgres:REDACTED@db:5432/database", settings["DATABASE_URL"])
+	assert.Equal(t, 5.0, settings["SCALE_FACTOR"])
+	assert.Equal(t, 8080.0, settings["PORT"])
+	assert.Equal(t, "10s", settings["SHUTDOWN_TIMEOUT"])
+	assert.NotContains(t, stdout.String(), "s3cr3t")
+
+	t.Run("Invalid", func(t *testing.T) {
+		c, _ := setupTestCLI(t)
+		c.config = nil
+		c.configPath = filepath.Join(t.TempDir(), "test.env")
+		require.NoError(t, os.WriteFile(c.configPath, []byte("REPOSITORY_BACKEND=memory\nSCALE_FACTOR=0\n"), 0o600))
+		assert.EqualError(t, c.run([]string{"config", "print"}), "err loading config: invalid configuration: SCALE_FACTOR must be at least 1, got 0")
+	})
+}
+
+func TestMigrateWithoutPostgres(t *testing.T) {
+	c, _ := setupTestCLI(t)
+	assert.EqualError(t, c.run([]string{"migrate", "version"}), "migrations only apply to the postgres backend")
+	assert.EqualError(t, c.run([]string{"migrate", "sideways"}), `expected one of up, down or version, got "sideways"`)
+}
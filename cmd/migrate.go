@@ -0,0 +1,78 @@
+// This file contains the migrate command, which manages the schema of the PostgreSQL database.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+type migrationOutput struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// runMigrate applies the pending migrations, reverts the newest ones, or shows the current version.
+func runMigrate(c *cli, args []string) error {
+	flags := c.flagSet("migrate", " [up | down | version]")
+	steps := flags.Int("steps", 1, "number of migrations reverted by down")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	action := "up"
+	if flags.NArg() > 0 {
+		action = flags.Arg(0)
+	}
+	if flags.NArg() > 1 || action != "up" && action != "down" && action != "version" {
+		flags.Usage()
+		return fmt.Errorf("expected one of up, down or version, got %q", strings.Join(flags.Args(), " "))
+	}
+	if *steps < 1 {
+		return fmt.Errorf("-steps must be at least 1")
+	}
+
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	migrator, err := newMigrator(repo)
+	if err != nil {
+		return err
+	}
+
+	// The migrations wait for the other instances migrating the database, until an interrupt or the timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, c.config.MigrationTimeout)
+	defer cancel()
+	output := struct {
+		Applied  []migrationOutput `json:"applied,omitempty"`
+		Reverted []migrationOutput `json:"reverted,omitempty"`
+		Version  int               `json:"version"`
+		Latest   int               `json:"latest"`
+	}{Latest: migrator.Latest()}
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			output.Applied = append(output.Applied, migrationOutput{Version: migration.Version, Name: migration.Name})
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		for _, migration := range reverted {
+			output.Reverted = append(output.Reverted, migrationOutput{Version: migration.Version, Name: migration.Name})
+		}
+	}
+	if output.Version, err = migrator.Version(ctx); err != nil {
+		return err
+	}
+	return c.printJSON(output)
+}
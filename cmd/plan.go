@@ -0,0 +1,233 @@
+// This file contains the plan and stats commands, which print what the API computes for the estates.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/planner"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+type plotOutput struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type planOutput struct {
+	// Distance is the total distance of the plan, or the budget when it is planned with a max distance.
+	Distance           int         `json:"distance"`
+	VerticalDistance   *int        `json:"vertical_distance,omitempty"`
+	HorizontalDistance *int        `json:"horizontal_distance,omitempty"`
+	Rest               *plotOutput `json:"rest,omitempty"`
+	Outcome            string      `json:"outcome,omitempty"`
+}
+
+// planInput is the estate to plan with its trees.
+type planInput struct {
+	estate planner.Estate
+	trees  []planner.Tree
+}
+
+// runPlan computes the drone plan of an estate of the repository, or of the trees of an import file without
+// any repository, and prints it.
+func runPlan(c *cli, args []string) error {
+	flags := c.flagSet("plan", "")
+	estateId := flags.String("estate", "", "ID of the planned estate")
+	file := flags.String("file", "", "import file holding the trees of the planned estate, instead of -estate")
+	format := flags.String("format", "", "format of -file, csv or ndjson, defaults to the extension of the file")
+	length := flags.Int("length", 0, "length of the estate of -file")
+	width := flags.Int("width", 0, "width of the estate of -file")
+	maxDistance := flags.Int("max-distance", 0, "distance the drone can fly, the whole estate is planned when 0")
+	scaleFactor := flags.Int("scale-factor", 0, "distance between two plots, defaults to SCALE_FACTOR of the configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	if (*estateId == "") == (*file == "") {
+		return errors.New("expected either -estate or -file")
+	}
+	if *maxDistance < 0 {
+		return errors.New("-max-distance must not be negative")
+	}
+
+	opts := planner.Options{ScaleFactor: *scaleFactor}
+	if *scaleFactor == 0 {
+		config, err := c.loadConfig()
+		if err != nil {
+			return err
+		}
+		opts.ScaleFactor = config.ScaleFactor
+	}
+	if *maxDistance > 0 {
+		opts.MaxDistance = maxDistance
+	}
+
+	var input *planInput
+	var err error
+	if *file != "" {
+		input, err = readPlanFile(*file, *format, *length, *width)
+	} else {
+		input, err = c.readPlanEstate(*estateId)
+	}
+	if err != nil {
+		return err
+	}
+
+	plan, err := planner.Compute(input.estate, input.trees, opts)
+	if err != nil {
+		return err
+	}
+
+	output := planOutput{Distance: plan.TotalDistance}
+	if opts.MaxDistance == nil {
+		output.VerticalDistance, output.HorizontalDistance = &plan.VerticalDistance, &plan.HorizontalDistance
+	} else {
+		output.Distance, output.Outcome = *opts.MaxDistance, string(plan.Outcome)
+		// A grounded drone never leaves the take off point, which is not a plot of the estate.
+		if plan.Outcome != planner.Grounded {
+			output.Rest = &plotOutput{X: plan.Rest.X, Y: plan.Rest.Y}
+		}
+	}
+	return c.printJSON(output)
+}
+
+// readPlanEstate reads the estate to plan and its trees from the repository.
+func (c *cli) readPlanEstate(estateId string) (*planInput, error) {
+	repo, err := c.repository()
+	if err != nil {
+		return nil, err
+	}
+	output, err := repo.GetEstateTreesByEstateId(context.Background(), &repository.GetEstateTreesByEstateIdInput{EstateId: estateId})
+	if err != nil {
+		return nil, err
+	}
+	if output == nil {
+		return nil, fmt.Errorf("estate %s not found", estateId)
+	}
+	input := &planInput{estate: planner.Estate{Length: output.Estate.Length, Width: output.Estate.Width}}
+	for _, tree := range output.Trees {
+		input.trees = append(input.trees, planner.Tree{X: tree.X, Y: tree.Y, Height: tree.Height})
+	}
+	return input, nil
+}
+
+// readPlanFile reads the trees to plan from an import file. Unlike an import, the plan is not computed when a
+// row is invalid.
+func readPlanFile(path, format string, length, width int) (*planInput, error) {
+	if length < 1 || length > repository.MaxEstateDimension || width < 1 || width > repository.MaxEstateDimension {
+		return nil, fmt.Errorf("-length and -width must be between 1 and %d", repository.MaxEstateDimension)
+	}
+	payload, contentType, err := readImportFile(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &planInput{estate: planner.Estate{Length: length, Width: width}}
+	planted := map[[2]int]bool{}
+	err = job.ParseImportRows(contentType, payload, func(rowNumber int, row *job.ImportRow, rowErr error) error {
+		if rowErr == nil {
+			rowErr = job.ValidateImportRow(row, repository.Estate{Length: length, Width: width})
+		}
+		if rowErr == nil && planted[[2]int{row.X, row.Y}] {
+			rowErr = fmt.Errorf("a tree already exists at plot (%d, %d)", row.X, row.Y)
+		}
+		if rowErr != nil {
+			return fmt.Errorf("row %d: %w", rowNumber, rowErr)
+		}
+		planted[[2]int{row.X, row.Y}] = true
+		input.trees = append(input.trees, planner.Tree{X: row.X, Y: row.Y, Height: row.Height})
+		return nil
+	})
+	return input, err
+}
+
+type heightStatsOutput struct {
+	Count  int     `json:"count"`
+	Max    int     `json:"max"`
+	Min    int     `json:"min"`
+	Median float32 `json:"median"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+}
+
+type estateRankOutput struct {
+	EstateId string  `json:"estate_id"`
+	Length   int     `json:"length"`
+	Width    int     `json:"width"`
+	Count    int     `json:"count"`
+	Median   float32 `json:"median"`
+}
+
+// runStats prints the statistics of the tree heights of an estate, or of all estates with their rankings.
+func runStats(c *cli, args []string) error {
+	flags := c.flagSet("stats", "")
+	estateId := flags.String("estate", "", "ID of the estate, all estates are described when empty")
+	rankBy := flags.String("rank-by", repository.PortfolioRankByMedian, "ranking of all estates, median or density")
+	rankLimit := flags.Int("rank-limit", 5, "number of estates in the top and in the bottom rankings")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	if *rankBy != repository.PortfolioRankByMedian && *rankBy != repository.PortfolioRankByDensity {
+		return fmt.Errorf("-rank-by must be one of %s or %s", repository.PortfolioRankByMedian, repository.PortfolioRankByDensity)
+	}
+	if *rankLimit < 0 {
+		return errors.New("-rank-limit must not be negative")
+	}
+
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *estateId != "" {
+		estate, err := repo.GetEstateByEstateId(ctx, &repository.GetEstateByEstateIdInput{Id: *estateId})
+		if err != nil {
+			return err
+		}
+		if estate == nil {
+			return fmt.Errorf("estate %s not found", *estateId)
+		}
+		stats, err := repo.GetEstateStatsByEstateId(ctx, &repository.GetEstateStatsByEstateIdInput{EstateId: *estateId, IncludeDistribution: true})
+		if err != nil {
+			return err
+		}
+		return c.printJSON(heightStatsOutput{Count: stats.Count, Max: stats.Max, Min: stats.Min, Median: stats.Median, Mean: stats.Mean, StdDev: stats.StdDev})
+	}
+
+	stats, err := repo.GetPortfolioStats(ctx, &repository.GetPortfolioStatsInput{RankBy: *rankBy, RankLimit: *rankLimit})
+	if err != nil {
+		return err
+	}
+	output := struct {
+		Estates int `json:"estates"`
+		Plots   int `json:"plots"`
+		heightStatsOutput
+		Top    []estateRankOutput `json:"top"`
+		Bottom []estateRankOutput `json:"bottom"`
+	}{
+		Estates:           stats.Estates,
+		Plots:             stats.Plots,
+		heightStatsOutput: heightStatsOutput{Count: stats.Count, Max: stats.Max, Min: stats.Min, Median: stats.Median, Mean: stats.Mean, StdDev: stats.StdDev},
+		Top:               newEstateRankOutputs(stats.Top),
+		Bottom:            newEstateRankOutputs(stats.Bottom),
+	}
+	return c.printJSON(output)
+}
+
+func newEstateRankOutputs(ranks []repository.EstateRank) []estateRankOutput {
+	outputs := []estateRankOutput{}
+	for _, rank := range ranks {
+		outputs = append(outputs, estateRankOutput{EstateId: rank.EstateId, Length: rank.Length, Width: rank.Width, Count: rank.Count, Median: rank.Median})
+	}
+	return outputs
+}
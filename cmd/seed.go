@@ -0,0 +1,105 @@
+// This file contains the seed command, which fills the repository with synthetic estates.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/export"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generator"
+)
+
+// runSeed generates synthetic estates, see generator.Generate, and creates them in the repository or writes
+// them as import files.
+func runSeed(c *cli, args []string) error {
+	flags := c.flagSet("seed", "")
+	opts := generator.Options{}
+	flags.IntVar(&opts.Estates, "estates", 10, "number of estates generated")
+	flags.IntVar(&opts.MinLength, "min-length", 1, "smallest length of an estate")
+	flags.IntVar(&opts.MaxLength, "max-length", 100, "largest length of an estate")
+	flags.IntVar(&opts.MinWidth, "min-width", 1, "smallest width of an estate")
+	flags.IntVar(&opts.MaxWidth, "max-width", 100, "largest width of an estate")
+	flags.StringVar(&opts.Pattern, "pattern", generator.PatternRandom, "planting pattern, random or grid")
+	flags.Float64Var(&opts.Density, "density", 0.3, "probability of a plot of the pattern being planted")
+	flags.IntVar(&opts.RowSpacing, "row-spacing", 1, "plots between two rows of the grid pattern")
+	flags.IntVar(&opts.TreeSpacing, "tree-spacing", 1, "plots between two trees of a row of the grid pattern")
+	flags.StringVar(&opts.Heights, "heights", generator.HeightsUniform, "height distribution, uniform or normal")
+	flags.IntVar(&opts.MinHeight, "min-height", 0, "smallest height of a tree, defaults to the smallest height allowed")
+	flags.IntVar(&opts.MaxHeight, "max-height", 0, "largest height of a tree, defaults to the largest height allowed")
+	flags.Float64Var(&opts.MeanHeight, "mean-height", 0, "mean of the normal heights, defaults to the middle of the heights")
+	flags.Float64Var(&opts.StdDevHeight, "stddev-height", 0, "standard deviation of the normal heights, defaults to a sixth of the heights")
+	flags.Int64Var(&opts.Seed, "seed", 0, "seed of the generated estates, defaults to the current time")
+	dir := flags.String("o", "", "directory of the import files written instead of seeding the repository")
+	format := flags.String("format", export.FormatCSV, "format of the import files of -o, csv or ndjson")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	if *format != export.FormatCSV && *format != export.FormatNDJSON {
+		return fmt.Errorf("-format must be one of %s or %s", export.FormatCSV, export.FormatNDJSON)
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	estates, err := generator.Generate(opts)
+	if err != nil {
+		return err
+	}
+	output := struct {
+		Seed         int64    `json:"seed"`
+		EstateIds    []string `json:"estate_ids"`
+		Trees        int      `json:"trees"`
+		SkippedTrees int      `json:"skipped_trees,omitempty"`
+		Files        []string `json:"files,omitempty"`
+	}{Seed: opts.Seed, EstateIds: []string{}}
+
+	if *dir != "" {
+		for i, estate := range estates {
+			// The name of a file holds the dimensions of its estate, which an import needs.
+			path := filepath.Join(*dir, fmt.Sprintf("estate-%03d-%dx%d.%s", i+1, estate.Length, estate.Width, *format))
+			if err := writeSeedFile(path, estate, *format); err != nil {
+				return err
+			}
+			output.EstateIds = append(output.EstateIds, estate.Id)
+			output.Trees += len(estate.Trees)
+			output.Files = append(output.Files, path)
+		}
+		return c.printJSON(output)
+	}
+
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	summary, err := generator.WriteRepository(context.Background(), repo, estates)
+	if err != nil {
+		return err
+	}
+	for _, estate := range estates {
+		output.EstateIds = append(output.EstateIds, estate.Id)
+	}
+	output.Trees, output.SkippedTrees = summary.Trees, summary.SkippedTrees
+	return c.printJSON(output)
+}
+
+func writeSeedFile(path string, estate generator.Estate, format string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := generator.WriteImportFile(file, estate, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
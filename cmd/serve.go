@@ -0,0 +1,236 @@
+// This file contains the serve command, which runs the HTTP server.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/apispec"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/handler"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/health"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/logging"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/metrics"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/tracing"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+// runServe starts the HTTP server and the job workers, until an interrupt signal shuts them down gracefully.
+func runServe(c *cli, args []string) error {
+	flags := c.flagSet("serve", "")
+	// -migrate is meant for the deployments without a separate migration step.
+	migrate := flags.Bool("migrate", false, "apply the pending database migrations before starting the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *migrate {
+		if err := migrateDatabase(ctx, c); err != nil {
+			return err
+		}
+	}
+	app, err := newApp(c)
+	if err != nil {
+		return err
+	}
+	e := newEcho(app, true)
+	// Start the background job workers, resuming the jobs interrupted by a previous run.
+	if err := app.server.JobManager.Start(ctx); err != nil {
+		return fmt.Errorf("err starting job manager: %w", err)
+	}
+	// Start server
+	e.Server.ReadTimeout = app.server.Config.ReadTimeout
+	e.Server.WriteTimeout = app.server.Config.WriteTimeout
+	go func() {
+		if err := e.Start(fmt.Sprintf(":%d", app.server.Config.Port)); err != nil && err != http.ErrServerClosed {
+			slog.Error("shutting down the server", "error", err)
+			os.Exit(1)
+		}
+	}()
+	<-ctx.Done()
+	// Stop routing new traffic to the instance while the requests in flight complete.
+	app.health.SetShuttingDown()
+	ctx, cancel := context.WithTimeout(context.Background(), app.server.Config.ShutdownTimeout)
+	defer cancel()
+	return shutdownApp(ctx, e, app)
+}
+
+// shutdownApp stops the server, then the job workers, then the tracing, within ctx. Every step runs even when
+// the previous ones fail, e.g. when a streamed export keeps the server past ctx, so that the running jobs are
+// still checkpointed and the remaining spans still exported.
+func shutdownApp(ctx context.Context, e *echo.Echo, app *app) error {
+	var errs []error
+	if err := e.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("err shutting down the server: %w", err))
+	}
+	// Let the running jobs finish within the remaining time, the unfinished ones are checkpointed.
+	if err := app.server.JobManager.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("err shutting down the job manager, the running jobs are checkpointed: %w", err))
+	}
+	// Export the spans of the last requests.
+	if err := app.tracing.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("err exporting the remaining spans: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// app holds the handlers of the API with their metrics, their probes and their tracing.
+type app struct {
+	server  *handler.Server
+	metrics *metrics.Metrics
+	health  *health.Checker
+	tracing *tracing.Tracing
+}
+
+// newEcho routes the requests to the handlers of the app, behind the middlewares of the API, and serves the
+// metrics on /metrics and the probes on /healthz and /readyz. logRequests logs every request to the standard output.
+func newEcho(app *app, logRequests bool) *echo.Echo {
+	e := echo.New()
+
+	e.Validator = validator.NewRequestValidator()
+	e.HTTPErrorHandler = handler.ProblemHTTPErrorHandler
+
+	// Every request has an ID, carried by its context down to the logs of the repository.
+	e.Use(logging.RequestIDMiddleware())
+	// The metrics and the tracing middlewares come next, so that they also cover the requests rejected by the
+	// other middlewares. Both handle the errors of the handlers, the tracing one comes last to record them.
+	e.Use(app.metrics.Middleware())
+	e.Use(app.tracing.Middleware())
+	generated.RegisterHandlers(e, app.server)
+	e.GET("/metrics", echo.WrapHandler(app.metrics.Handler()))
+	app.health.Register(e)
+	if logRequests {
+		e.Use(logging.RequestLogger(slog.Default()))
+	}
+	if app.server.Config.ResponseValidation {
+		// Log the responses which break the contract of the generated clients.
+		responseValidator, err := apispec.NewResponseValidator(apispec.NewResponseValidatorOptions{})
+		if err != nil {
+			slog.Error("err loading response validator", "error", err)
+			os.Exit(1)
+		}
+		e.Use(responseValidator.Middleware())
+	}
+	// Reject the requests which do not match the OpenAPI specification before they reach the handlers.
+	requestValidator, err := apispec.NewRequestValidator(apispec.NewRequestValidatorOptions{})
+	if err != nil {
+		slog.Error("err loading request validator", "error", err)
+		os.Exit(1)
+	}
+	e.Use(requestValidator.Middleware())
+	return e
+}
+
+// newApp creates the handlers of the API, whose repository is instrumented by the metrics of the app.
+func newApp(c *cli) (*app, error) {
+	backend, err := c.repository()
+	if err != nil {
+		return nil, err
+	}
+	config := c.config
+	serverTracing, err := tracing.NewTracing(tracing.NewTracingOptions{
+		Exporter: config.TracingExporter,
+		Endpoint: config.TracingEndpoint,
+	})
+	if err != nil {
+		return nil, err
+	}
+	serverMetrics := metrics.NewMetrics(metrics.NewMetricsOptions{})
+	var repo repository.RepositoryInterface = tracing.NewRepository(tracing.NewRepositoryOptions{
+		Repository: backend,
+		Tracing:    serverTracing,
+		Backend:    config.RepositoryBackend,
+	})
+	repo = metrics.NewRepository(metrics.NewRepositoryOptions{Repository: repo, Metrics: serverMetrics})
+	jobManager := job.NewManager(job.NewManagerOptions{
+		Repository: repo,
+		Workers:    config.JobWorkers,
+	})
+	var planCache *plancache.Cache
+	if config.PlanCacheSize > 0 {
+		planCacheOpts := plancache.NewCacheOptions{Size: config.PlanCacheSize}
+		if config.PlanCachePersistent {
+			planCacheOpts.Repository = repo
+		}
+		planCache = plancache.NewCache(planCacheOpts)
+		serverMetrics.ObservePlanCache(planCache)
+	}
+	opts := handler.NewServerOptions{
+		Repository: repo,
+		Config:     config,
+		JobManager: jobManager,
+		PlanCache:  planCache,
+
+		PlanObserver: serverMetrics,
+		Tracer:       serverTracing.Tracer(),
+	}
+	return &app{
+		server:  handler.NewServer(opts),
+		metrics: serverMetrics,
+		health: health.NewChecker(health.NewCheckerOptions{
+			Checks:  readinessChecks(backend),
+			Timeout: config.ReadinessTimeout,
+		}),
+		tracing: serverTracing,
+	}, nil
+}
+
+// readinessChecks checks that the database of repo is reachable and, for PostgreSQL, that it is migrated to
+// the latest version, since the server does not migrate it without -migrate.
+func readinessChecks(repo repository.RepositoryInterface) map[string]health.Check {
+	checks := map[string]health.Check{}
+	if pinger, ok := repo.(repository.Pinger); ok {
+		checks["database"] = pinger.Ping
+	}
+	if migrator, err := newMigrator(repo); err == nil {
+		checks["migrations"] = func(ctx context.Context) error {
+			// The probes run often, and during the migrations of the other instances, so they do not lock.
+			version, err := migrator.AppliedVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if version != migrator.Latest() {
+				return fmt.Errorf("database at version %d, expected %d", version, migrator.Latest())
+			}
+			return nil
+		}
+	}
+	return checks
+}
+
+// migrateDatabase applies the pending migrations to the PostgreSQL database of the cli, until ctx is done or
+// MIGRATION_TIMEOUT expires. The other backends create their schema when they are opened.
+func migrateDatabase(ctx context.Context, c *cli) error {
+	repo, err := c.repository()
+	if err != nil {
+		return err
+	}
+	if _, ok := repo.(*repository.Repository); !ok {
+		slog.Info("skipping the migrations, they only apply to the postgres backend")
+		return nil
+	}
+	migrator, err := newMigrator(repo)
+	if err != nil {
+		return fmt.Errorf("err loading migrations: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.MigrationTimeout)
+	defer cancel()
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("err migrating database: %w", err)
+	}
+	slog.Info("successfully migrated database", "version", migrator.Latest(), "applied", len(applied))
+	return nil
+}
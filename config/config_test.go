@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes content to a configuration file of its own and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.env")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestNewConfigDefaults(t *testing.T) {
+	// The environment alone is enough, the settings it does not set take their defaults.
+	t.Setenv("DATABASE_URL", "postgres://postgres:postgres@db:5432/database")
+	cfg, err := NewConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, &Config{
+		Port:              1323,
+		ReadTimeout:       time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+		ReadinessTimeout:  2 * time.Second,
+		DatabaseURL:       "postgres://postgres:postgres@db:5432/database",
+		DBConnectTimeout:  time.Minute,
+		DBMaxOpenConns:    10,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30 * time.Minute,
+		MigrationTimeout:  5 * time.Minute,
+		RepositoryBackend: "postgres",
+		SQLitePath:        "plantation.db",
+		ScaleFactor:       10,
+		JobWorkers:        2,
+		PlanCacheSize:     1000,
+		TracingExporter:   "none",
+		TracingEndpoint:   "http://localhost:4318",
+		LogLevel:          "info",
+		LogFormat:         "json",
+	}, cfg)
+}
+
+func TestNewConfigFileAndEnvironment(t *testing.T) {
+	path := writeConfigFile(t, "REPOSITORY_BACKEND=memory\nPORT=8080\nSCALE_FACTOR=5\nSHUTDOWN_TIMEOUT=30s\n")
+	// The environment overrides the file.
+	t.Setenv("PORT", "9090")
+	cfg, err := NewConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, 5, cfg.ScaleFactor)
+	assert.Equal(t, 30*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, "memory", cfg.RepositoryBackend)
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := NewConfig(filepath.Join(t.TempDir(), "missing.env"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Repository file", func(t *testing.T) {
+		cfg, err := NewConfig("../.env")
+		require.NoError(t, err)
+		assert.Equal(t, 10, cfg.ScaleFactor)
+	})
+}
+
+func TestNewConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []string
+	}{
+		{
+			name: "Missing database URL",
+			file: "REPOSITORY_BACKEND=postgres\n",
+			want: []string{"DATABASE_URL is required by the postgres backend"},
+		},
+		{
+			name: "Zero scale factor",
+			file: "REPOSITORY_BACKEND=memory\nSCALE_FACTOR=0\n",
+			want: []string{"SCALE_FACTOR must be at least 1, got 0"},
+		},
+		{
+			name: "Pool",
+			file: "DATABASE_URL=postgres://db/database\nDB_MAX_OPEN_CONNS=4\nDB_MAX_IDLE_CONNS=8\nMIGRATION_TIMEOUT=0s\n",
+			want: []string{
+				"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (4), got 8",
+				"MIGRATION_TIMEOUT must be positive, got 0s",
+			},
+		},
+		{
+			name: "Every invalid setting at once",
+			file: "REPOSITORY_BACKEND=mongo\nPORT=70000\nHTTP_READ_TIMEOUT=0s\nJOB_WORKERS=0\nPLAN_CACHE_SIZE=-1\n" +
+				"TRACING_EXPORTER=zipkin\nLOG_LEVEL=verbose\nLOG_FORMAT=xml\n",
+			want: []string{
+				"PORT must be between 1 and 65535, got 70000",
+				"HTTP_READ_TIMEOUT must be positive, got 0s",
+				`REPOSITORY_BACKEND must be one of postgres, sqlite or memory, got "mongo"`,
+				"JOB_WORKERS must be at least 1, got 0",
+				"PLAN_CACHE_SIZE must not be negative, got -1",
+				`TRACING_EXPORTER must be one of none, stdout or otlp, got "zipkin"`,
+				`LOG_LEVEL must be one of debug, info, warn or error, got "verbose"`,
+				`LOG_FORMAT must be json or text, got "xml"`,
+			},
+		},
+		{
+			name: "OTLP without endpoint",
+			file: "REPOSITORY_BACKEND=memory\nTRACING_EXPORTER=otlp\nTRACING_ENDPOINT=localhost\n",
+			want: []string{`TRACING_ENDPOINT must be the URL of the collector of the otlp exporter, got "localhost"`},
+		},
+		{
+			name: "Malformed duration",
+			file: "REPOSITORY_BACKEND=memory\nSHUTDOWN_TIMEOUT=10\n",
+			want: []string{"invalid configuration", `time: missing unit in duration "10"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConfig(writeConfigFile(t, tt.file))
+			require.Error(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, err.Error(), want)
+			}
+			assert.ErrorIs(t, err, ErrInvalid)
+			if tt.name == "Every invalid setting at once" {
+				assert.Len(t, strings.Split(err.Error(), "\n"), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := &Config{
+		Port:            1323,
+		ShutdownTimeout: 10 * time.Second,
+		DatabaseURL:     "postgres://postgres:s3cr3t@db:5432/database?sslmode=disable",
+		LogFormat:       "json",
+	}
+	settings := cfg.Settings()
+	assert.Equal(t, 1323, settings["PORT"])
+	assert.Equal(t, "10s", settings["SHUTDOWN_TIMEOUT"])
+	assert.Equal(t, "postgres://postgres:REDACTED@db:5432/database?sslmode=disable", settings["DATABASE_URL"])
+	assert.Equal(t, "json", settings["LOG_FORMAT"])
+	assert.Len(t, settings, len(keys()))
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{dsn: "postgres://postgres:postgres@db:5432/database?sslmode=disable", want: "postgres://postgres:REDACTED@db:5432/database?sslmode=disable"},
+		{dsn: "postgres://postgres@db:5432/database", want: "postgres://postgres@db:5432/database"},
+		{dsn: "host=db user=postgres password='my secret' dbname=database", want: "host=db user=postgres password=REDACTED dbname=database"},
+		{dsn: "host=db PASSWORD = secret", want: "host=db PASSWORD = REDACTED"},
+		{dsn: "plantation.db", want: "plantation.db"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RedactDSN(tt.dsn))
+	}
+}
@@ -0,0 +1,122 @@
+// This file contains the encoders used to export estates and trees.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported export format, expected csv or ndjson")
+
+// csvHeader is the header of CSV exports. The x, y and height columns make a single estate
+// export importable again through the tree import endpoint.
+var csvHeader = []string{"estate_id", "estate_length", "estate_width", "tree_id", "x", "y", "height", "created_at"}
+
+type RowWriter interface {
+	// WriteRow encodes a single row. The row may stay buffered until Flush is called.
+	WriteRow(row *repository.ExportRow) error
+	// Flush writes the buffered rows to the underlying writer.
+	Flush() error
+}
+
+// NewRowWriter returns a RowWriter encoding rows in the given format to w.
+func NewRowWriter(w io.Writer, format string) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvRowWriter{writer: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonRowWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// ContentType returns the media type of the given format.
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+type csvRowWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvRowWriter) WriteRow(row *repository.ExportRow) error {
+	if !w.headerWritten {
+		if err := w.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+
+	record := []string{row.EstateId, strconv.Itoa(row.Length), strconv.Itoa(row.Width), "", "", "", "", ""}
+	if row.TreeId != "" {
+		record[3] = row.TreeId
+		record[4] = strconv.Itoa(row.X)
+		record[5] = strconv.Itoa(row.Y)
+		record[6] = strconv.Itoa(row.Height)
+		record[7] = row.TreeCreatedAt.UTC().Format(time.RFC3339)
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvRowWriter) Flush() error {
+	if !w.headerWritten {
+		if err := w.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonRow struct {
+	EstateId     string     `json:"estate_id"`
+	EstateLength int        `json:"estate_length"`
+	EstateWidth  int        `json:"estate_width"`
+	TreeId       *string    `json:"tree_id"`
+	X            *int       `json:"x"`
+	Y            *int       `json:"y"`
+	Height       *int       `json:"height"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+type ndjsonRowWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonRowWriter) WriteRow(row *repository.ExportRow) error {
+	encoded := ndjsonRow{
+		EstateId:     row.EstateId,
+		EstateLength: row.Length,
+		EstateWidth:  row.Width,
+	}
+	if row.TreeId != "" {
+		createdAt := row.TreeCreatedAt.UTC()
+		encoded.TreeId = &row.TreeId
+		encoded.X, encoded.Y, encoded.Height = &row.X, &row.Y, &row.Height
+		encoded.CreatedAt = &createdAt
+	}
+	return w.encoder.Encode(encoded)
+}
+
+func (w *ndjsonRowWriter) Flush() error {
+	return w.buffered.Flush()
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRowWriter tests that trees and estates without trees are encoded in both formats.
+func TestRowWriter(t *testing.T) {
+	t.Parallel()
+
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rows := []repository.ExportRow{
+		{EstateId: "e1", Length: 5, Width: 2, TreeId: "t1", X: 1, Y: 2, Height: 7, TreeCreatedAt: createdAt},
+		{EstateId: "e2", Length: 3, Width: 3},
+	}
+
+	testCases := []struct {
+		name     string
+		format   string
+		rows     []repository.ExportRow
+		expected string
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			rows:   rows,
+			expected: "estate_id,estate_length,estate_width,tree_id,x,y,height,created_at\n" +
+				"e1,5,2,t1,1,2,7,2024-05-01T10:00:00Z\n" +
+				"e2,3,3,,,,,\n",
+		},
+		{
+			name:     "CSV without rows still has a header",
+			format:   FormatCSV,
+			expected: "estate_id,estate_length,estate_width,tree_id,x,y,height,created_at\n",
+		},
+		{
+			name:   "NDJSON",
+			format: FormatNDJSON,
+			rows:   rows,
+			expected: `{"estate_id":"e1","estate_length":5,"estate_width":2,"tree_id":"t1","x":1,"y":2,"height":7,"created_at":"2024-05-01T10:00:00Z"}` + "\n" +
+				`{"estate_id":"e2","estate_length":3,"estate_width":3,"tree_id":null,"x":null,"y":null,"height":null,"created_at":null}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewRowWriter(&buf, tc.format)
+			require.NoError(t, err)
+			for i := range tc.rows {
+				require.NoError(t, writer.WriteRow(&tc.rows[i]))
+			}
+			require.NoError(t, writer.Flush())
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+
+	_, err := NewRowWriter(&bytes.Buffer{}, "parquet")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
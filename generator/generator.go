@@ -0,0 +1,267 @@
+// This file contains the generator of synthetic estates, used to benchmark the planner and the queries.
+package generator
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/export"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+const (
+	// PatternRandom plants every plot with a probability of Density.
+	PatternRandom = "random"
+	// PatternGrid plants the plots of every RowSpacing-th row and of every TreeSpacing-th column, each with a
+	// probability of Density, like the rows of a plantation with a few missing trees.
+	PatternGrid = "grid"
+)
+
+const (
+	// HeightsUniform draws the heights uniformly between MinHeight and MaxHeight.
+	HeightsUniform = "uniform"
+	// HeightsNormal draws the heights from a normal distribution of MeanHeight and StdDevHeight, rounded and
+	// clamped between MinHeight and MaxHeight.
+	HeightsNormal = "normal"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported import format, expected csv or ndjson")
+
+// maxDimensionAttempts is the number of draws of the dimensions of an estate before giving up, since every
+// estate of a run needs distinct dimensions.
+const maxDimensionAttempts = 100
+
+type Options struct {
+	// Seed makes the generated estates, including their IDs, the same on every run.
+	Seed int64
+	// Estates is the number of generated estates.
+	Estates int
+	// MinLength, MaxLength, MinWidth and MaxWidth bound the dimensions of the estates, both inclusive.
+	// They default to 10 and 100.
+	MinLength, MaxLength int
+	MinWidth, MaxWidth   int
+
+	// Pattern is one of the Pattern constants, defaults to PatternRandom.
+	Pattern string
+	// Density is the probability of a plot of the pattern being planted, between 0 and 1.
+	Density float64
+	// RowSpacing and TreeSpacing are the number of plots between two rows and between two trees of a row of
+	// PatternGrid. They default to 1.
+	RowSpacing, TreeSpacing int
+
+	// Heights is one of the Heights constants, defaults to HeightsUniform.
+	Heights string
+	// MinHeight and MaxHeight bound the heights, they default to the bounds of the trees table.
+	MinHeight, MaxHeight int
+	// MeanHeight and StdDevHeight shape HeightsNormal, they default to the middle of the bounds and to a sixth
+	// of their range.
+	MeanHeight, StdDevHeight float64
+}
+
+// Estate is a generated estate and its trees.
+type Estate struct {
+	Id            string
+	Length, Width int
+	Trees         []Tree
+}
+
+// Tree is a generated tree, sorted by Y and then by X within its estate.
+type Tree struct {
+	Id           string
+	X, Y, Height int
+}
+
+// withDefaults returns the options with the defaults applied, or an error when they are inconsistent.
+func (o Options) withDefaults() (Options, error) {
+	defaultInt := func(value *int, fallback int) {
+		if *value == 0 {
+			*value = fallback
+		}
+	}
+	defaultInt(&o.MinLength, 10)
+	defaultInt(&o.MaxLength, 100)
+	defaultInt(&o.MinWidth, 10)
+	defaultInt(&o.MaxWidth, 100)
+	defaultInt(&o.RowSpacing, 1)
+	defaultInt(&o.TreeSpacing, 1)
+	defaultInt(&o.MinHeight, repository.MinTreeHeight)
+	defaultInt(&o.MaxHeight, repository.MaxTreeHeight)
+	if o.Pattern == "" {
+		o.Pattern = PatternRandom
+	}
+	if o.Heights == "" {
+		o.Heights = HeightsUniform
+	}
+	if o.MeanHeight == 0 {
+		o.MeanHeight = float64(o.MinHeight+o.MaxHeight) / 2
+	}
+	if o.StdDevHeight == 0 {
+		o.StdDevHeight = float64(o.MaxHeight-o.MinHeight) / 6
+	}
+
+	switch {
+	case o.Estates < 0:
+		return o, errors.New("the number of estates must not be negative")
+	case o.MinLength < 1 || o.MaxLength > repository.MaxEstateDimension || o.MinLength > o.MaxLength:
+		return o, fmt.Errorf("the lengths must be between 1 and %d, the minimum first", repository.MaxEstateDimension)
+	case o.MinWidth < 1 || o.MaxWidth > repository.MaxEstateDimension || o.MinWidth > o.MaxWidth:
+		return o, fmt.Errorf("the widths must be between 1 and %d, the minimum first", repository.MaxEstateDimension)
+	case o.Estates > (o.MaxLength-o.MinLength+1)*(o.MaxWidth-o.MinWidth+1):
+		return o, errors.New("there are not enough distinct dimensions for the number of estates")
+	case o.Pattern != PatternRandom && o.Pattern != PatternGrid:
+		return o, fmt.Errorf("unknown pattern %q, expected %s or %s", o.Pattern, PatternRandom, PatternGrid)
+	case o.Density < 0 || o.Density > 1:
+		return o, errors.New("the density must be between 0 and 1")
+	case o.RowSpacing < 1 || o.TreeSpacing < 1:
+		return o, errors.New("the spacings must be at least 1")
+	case o.Heights != HeightsUniform && o.Heights != HeightsNormal:
+		return o, fmt.Errorf("unknown height distribution %q, expected %s or %s", o.Heights, HeightsUniform, HeightsNormal)
+	case o.MinHeight < repository.MinTreeHeight || o.MaxHeight > repository.MaxTreeHeight || o.MinHeight > o.MaxHeight:
+		return o, fmt.Errorf("the heights must be between %d and %d, the minimum first", repository.MinTreeHeight, repository.MaxTreeHeight)
+	case o.StdDevHeight < 0:
+		return o, errors.New("the standard deviation of the heights must not be negative")
+	}
+	return o, nil
+}
+
+// Generate returns the estates described by opts. The same options always generate the same estates.
+// The estates of a run have distinct dimensions, since the repository merges the estates of the same dimensions.
+func Generate(opts Options) ([]Estate, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	random := rand.New(rand.NewSource(opts.Seed))
+	newId := func() string {
+		// Drawing the IDs from the seeded source keeps them deterministic.
+		return uuid.Must(uuid.NewRandomFromReader(random)).String()
+	}
+
+	estates := make([]Estate, 0, opts.Estates)
+	dimensions := map[[2]int]bool{}
+	for len(estates) < opts.Estates {
+		estate := Estate{Id: newId()}
+		for attempt := 0; ; attempt++ {
+			estate.Length = opts.MinLength + random.Intn(opts.MaxLength-opts.MinLength+1)
+			estate.Width = opts.MinWidth + random.Intn(opts.MaxWidth-opts.MinWidth+1)
+			if !dimensions[[2]int{estate.Length, estate.Width}] {
+				break
+			}
+			if attempt == maxDimensionAttempts {
+				return nil, errors.New("there are not enough distinct dimensions left for the number of estates")
+			}
+		}
+		dimensions[[2]int{estate.Length, estate.Width}] = true
+
+		for y := 1; y <= estate.Width; y++ {
+			for x := 1; x <= estate.Length; x++ {
+				if opts.Pattern == PatternGrid && ((y-1)%opts.RowSpacing != 0 || (x-1)%opts.TreeSpacing != 0) {
+					continue
+				}
+				if random.Float64() >= opts.Density {
+					continue
+				}
+				estate.Trees = append(estate.Trees, Tree{Id: newId(), X: x, Y: y, Height: opts.height(random)})
+			}
+		}
+		estates = append(estates, estate)
+	}
+	return estates, nil
+}
+
+// height draws the height of a tree.
+func (o Options) height(random *rand.Rand) int {
+	if o.Heights == HeightsUniform {
+		return o.MinHeight + random.Intn(o.MaxHeight-o.MinHeight+1)
+	}
+	height := int(math.Round(o.MeanHeight + random.NormFloat64()*o.StdDevHeight))
+	return min(max(height, o.MinHeight), o.MaxHeight)
+}
+
+// Summary counts what WriteRepository created.
+type Summary struct {
+	Estates, Trees int
+	// SkippedTrees counts the trees of plots planted already, e.g. by an earlier run with the same seed.
+	SkippedTrees int
+}
+
+// WriteRepository creates the estates and their trees in repo.
+// An estate whose dimensions exist already is merged into the existing estate, see RepositoryInterface.CreateEstate,
+// so the Id of such an estate is updated to the ID of the existing estate.
+func WriteRepository(ctx context.Context, repo repository.RepositoryInterface, estates []Estate) (Summary, error) {
+	var summary Summary
+	for i := range estates {
+		estate := &estates[i]
+		output, err := repo.CreateEstate(ctx, &repository.CreateEstateInput{
+			Id:     estate.Id,
+			Length: uint16(estate.Length),
+			Width:  uint16(estate.Width),
+		})
+		if err != nil {
+			return summary, err
+		}
+		estate.Id = output.Id
+		summary.Estates++
+
+		for _, tree := range estate.Trees {
+			exists, err := repo.IsTreeExist(ctx, &repository.IsTreeExistInput{EstateId: estate.Id, X: tree.X, Y: tree.Y})
+			if err != nil {
+				return summary, err
+			}
+			if exists.IsExist {
+				summary.SkippedTrees++
+				continue
+			}
+			_, err = repo.CreateTree(ctx, &repository.CreateTreeInput{
+				Id:       tree.Id,
+				EstateId: estate.Id,
+				X:        tree.X,
+				Y:        tree.Y,
+				Height:   tree.Height,
+			})
+			if err != nil {
+				return summary, err
+			}
+			summary.Trees++
+		}
+	}
+	return summary, nil
+}
+
+// WriteImportFile writes the trees of an estate as an import file of the tree import endpoint, in the format
+// export.FormatCSV or export.FormatNDJSON. The file only holds the x, y and height columns of the import.
+func WriteImportFile(w io.Writer, estate Estate, format string) error {
+	switch format {
+	case export.FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"x", "y", "height"}); err != nil {
+			return err
+		}
+		for _, tree := range estate.Trees {
+			if err := writer.Write([]string{strconv.Itoa(tree.X), strconv.Itoa(tree.Y), strconv.Itoa(tree.Height)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case export.FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, tree := range estate.Trees {
+			if err := encoder.Encode(job.ImportRow{X: tree.X, Y: tree.Y, Height: tree.Height}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrUnsupportedFormat
+}
@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/export"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDeterministic(t *testing.T) {
+	opts := Options{Seed: 42, Estates: 5, MaxLength: 30, MaxWidth: 30, Density: 0.5, Heights: HeightsNormal}
+	first, err := Generate(opts)
+	require.NoError(t, err)
+	second, err := Generate(opts)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	opts.Seed = 43
+	other, err := Generate(opts)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		opts  Options
+		check func(t *testing.T, estate Estate)
+	}{
+		{
+			name: "Fully planted",
+			opts: Options{Estates: 3, MinLength: 5, MaxLength: 8, MinWidth: 5, MaxWidth: 8, Density: 1},
+			check: func(t *testing.T, estate Estate) {
+				assert.Len(t, estate.Trees, estate.Length*estate.Width)
+			},
+		},
+		{
+			name: "Empty",
+			opts: Options{Estates: 3, Density: 0},
+			check: func(t *testing.T, estate Estate) {
+				assert.Empty(t, estate.Trees)
+			},
+		},
+		{
+			name: "Grid",
+			opts: Options{Estates: 3, MinLength: 10, MaxLength: 20, MinWidth: 10, MaxWidth: 20, Pattern: PatternGrid, Density: 1, RowSpacing: 3, TreeSpacing: 2},
+			check: func(t *testing.T, estate Estate) {
+				assert.Len(t, estate.Trees, ((estate.Length+1)/2)*((estate.Width+2)/3))
+				for _, tree := range estate.Trees {
+					assert.Zero(t, (tree.X-1)%2, "tree at x %d", tree.X)
+					assert.Zero(t, (tree.Y-1)%3, "tree at y %d", tree.Y)
+				}
+			},
+		},
+		{
+			name: "Normal heights",
+			opts: Options{Estates: 1, MinLength: 50, MaxLength: 50, MinWidth: 50, MaxWidth: 50, Density: 1, Heights: HeightsNormal, MinHeight: 5, MaxHeight: 25, MeanHeight: 20, StdDevHeight: 2},
+			check: func(t *testing.T, estate Estate) {
+				sum := 0
+				for _, tree := range estate.Trees {
+					assert.GreaterOrEqual(t, tree.Height, 5)
+					assert.LessOrEqual(t, tree.Height, 25)
+					sum += tree.Height
+				}
+				assert.InDelta(t, 20, float64(sum)/float64(len(estate.Trees)), 0.5)
+			},
+		},
+		{
+			name: "Uniform heights",
+			opts: Options{Estates: 1, MinLength: 50, MaxLength: 50, MinWidth: 50, MaxWidth: 50, Density: 1, MinHeight: 7, MaxHeight: 9},
+			check: func(t *testing.T, estate Estate) {
+				seen := map[int]bool{}
+				for _, tree := range estate.Trees {
+					seen[tree.Height] = true
+				}
+				assert.Equal(t, map[int]bool{7: true, 8: true, 9: true}, seen)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			estates, err := Generate(tc.opts)
+			require.NoError(t, err)
+			require.Len(t, estates, tc.opts.Estates)
+			dimensions := map[[2]int]bool{}
+			for _, estate := range estates {
+				assert.False(t, dimensions[[2]int{estate.Length, estate.Width}], "duplicate dimensions")
+				dimensions[[2]int{estate.Length, estate.Width}] = true
+				tc.check(t, estate)
+			}
+		})
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts Options
+		err  string
+	}{
+		{name: "Negative estates", opts: Options{Estates: -1}, err: "the number of estates must not be negative"},
+		{name: "Inverted lengths", opts: Options{MinLength: 20, MaxLength: 10}, err: "the lengths must be between 1 and 50000, the minimum first"},
+		{name: "Too wide", opts: Options{MaxWidth: 50001}, err: "the widths must be between 1 and 50000, the minimum first"},
+		{name: "Too many estates", opts: Options{Estates: 5, MinLength: 1, MaxLength: 2, MinWidth: 1, MaxWidth: 2}, err: "there are not enough distinct dimensions for the number of estates"},
+		{name: "Unknown pattern", opts: Options{Pattern: "spiral"}, err: `unknown pattern "spiral", expected random or grid`},
+		{name: "Density", opts: Options{Density: 1.5}, err: "the density must be between 0 and 1"},
+		{name: "Spacing", opts: Options{RowSpacing: -1}, err: "the spacings must be at least 1"},
+		{name: "Unknown heights", opts: Options{Heights: "zipf"}, err: `unknown height distribution "zipf", expected uniform or normal`},
+		{name: "Too high", opts: Options{MaxHeight: 31}, err: "the heights must be between 1 and 30, the minimum first"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Generate(tc.opts)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestWriteRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{})
+	estates, err := Generate(Options{Seed: 1, Estates: 3, MaxLength: 20, MaxWidth: 20, Density: 0.4})
+	require.NoError(t, err)
+
+	summary, err := WriteRepository(ctx, repo, estates)
+	require.NoError(t, err)
+	trees := 0
+	for _, estate := range estates {
+		trees += len(estate.Trees)
+		output, err := repo.GetEstateTreesByEstateId(ctx, &repository.GetEstateTreesByEstateIdInput{EstateId: estate.Id})
+		require.NoError(t, err)
+		require.NotNil(t, output)
+		assert.Len(t, output.Trees, len(estate.Trees))
+	}
+	assert.Equal(t, Summary{Estates: 3, Trees: trees}, summary)
+
+	// Seeding the same estates again plants nothing new.
+	summary, err = WriteRepository(ctx, repo, estates)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Estates: 3, SkippedTrees: trees}, summary)
+}
+
+func TestWriteImportFile(t *testing.T) {
+	estates, err := Generate(Options{Seed: 1, Estates: 1, MaxLength: 10, MaxWidth: 10, Density: 0.5})
+	require.NoError(t, err)
+	estate := estates[0]
+
+	for _, format := range []string{export.FormatCSV, export.FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			require.NoError(t, WriteImportFile(&buffer, estate, format))
+
+			var trees []Tree
+			err := job.ParseImportRows(export.ContentType(format), buffer.Bytes(), func(rowNumber int, row *job.ImportRow, rowErr error) error {
+				require.NoError(t, rowErr)
+				trees = append(trees, Tree{Id: estate.Trees[rowNumber-1].Id, X: row.X, Y: row.Y, Height: row.Height})
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, estate.Trees, trees)
+		})
+	}
+
+	assert.ErrorIs(t, WriteImportFile(&bytes.Buffer{}, estate, "xml"), ErrUnsupportedFormat)
+}
@@ -0,0 +1,45 @@
+// Package generatortest provides helpers to fill the repositories of the tests with synthetic estates.
+package generatortest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generator"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+// Generate returns the estates described by opts and fails the test when the options are invalid.
+func Generate(t testing.TB, opts generator.Options) []generator.Estate {
+	t.Helper()
+	estates, err := generator.Generate(opts)
+	if err != nil {
+		t.Fatalf("generate estates: %v", err)
+	}
+	return estates
+}
+
+// Seed generates the estates described by opts and creates them in repo. The returned estates hold the IDs
+// of the repository.
+func Seed(t testing.TB, repo repository.RepositoryInterface, opts generator.Options) []generator.Estate {
+	t.Helper()
+	estates := Generate(t, opts)
+	if _, err := generator.WriteRepository(context.Background(), repo, estates); err != nil {
+		t.Fatalf("seed estates: %v", err)
+	}
+	return estates
+}
+
+// Estate generates a single estate of the given dimensions, planted at random with the given density.
+func Estate(t testing.TB, seed int64, length, width int, density float64) generator.Estate {
+	t.Helper()
+	return Generate(t, generator.Options{
+		Seed:      seed,
+		Estates:   1,
+		MinLength: length,
+		MaxLength: length,
+		MinWidth:  width,
+		MaxWidth:  width,
+		Density:   density,
+	})[0]
+}
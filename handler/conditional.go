@@ -0,0 +1,72 @@
+// This file contains the helpers for conditional GET requests.
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contentETag derives a strong entity tag from the content of a representation.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches the entity tag, using the weak
+// comparison required for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified evaluates the conditional headers of a GET request. If-Modified-Since is ignored when
+// If-None-Match is present, or when lastModified is zero.
+func isNotModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a one second precision.
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// conditionalJSON sends resp as JSON with a 200 status, tagged with a strong ETag computed from its content
+// and with lastModified as Last-Modified, unless lastModified is zero.
+// When the conditional headers of the request match, a 304 status is sent without the body instead.
+// Clients are asked to revalidate on every use, since the representation changes with every new tree.
+func conditionalJSON(ctx echo.Context, resp any, lastModified time.Time) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	etag := contentETag(body)
+	header := ctx.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "no-cache")
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(ctx.Request(), etag, lastModified) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+	return ctx.JSONBlob(http.StatusOK, body)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIsNotModified tests the evaluation of the If-None-Match and If-Modified-Since headers.
+func TestIsNotModified(t *testing.T) {
+	t.Parallel()
+
+	etag := `"abc"`
+	lastModified := time.Date(2024, time.March, 4, 10, 15, 0, 500, time.UTC)
+
+	testCases := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{name: "No conditional header", expected: false},
+		{name: "Matching ETag", headers: map[string]string{"If-None-Match": `"abc"`}, expected: true},
+		{name: "Matching ETag in a list", headers: map[string]string{"If-None-Match": `"xyz", W/"abc"`}, expected: true},
+		{name: "Wildcard", headers: map[string]string{"If-None-Match": "*"}, expected: true},
+		{name: "Other ETag", headers: map[string]string{"If-None-Match": `"xyz"`}, expected: false},
+		{name: "Unmodified since", headers: map[string]string{"If-Modified-Since": "Mon, 04 Mar 2024 10:15:00 GMT"}, expected: true},
+		{name: "Modified since", headers: map[string]string{"If-Modified-Since": "Mon, 04 Mar 2024 10:14:59 GMT"}, expected: false},
+		{name: "Invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}, expected: false},
+		{
+			name:     "If-None-Match takes precedence over If-Modified-Since",
+			headers:  map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": "Mon, 04 Mar 2024 10:15:00 GMT"},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tc.expected, isNotModified(req, etag, lastModified))
+		})
+	}
+
+	t.Run("If-Modified-Since without last modification time", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-Modified-Since", "Mon, 04 Mar 2024 10:15:00 GMT")
+		assert.False(t, isNotModified(req, etag, time.Time{}))
+	})
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/apispec"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// TestResponsesConformToSpec sends requests through the request validation and the generated routes, and
+// checks every response, including the problems written on failure, against the OpenAPI specification.
+func TestResponsesConformToSpec(t *testing.T) {
+	estateId := uuid.New()
+	treeId := uuid.New()
+	jobId := uuid.New()
+	estate := &repository.GetEstateByEstateIdOutput{
+		Estate: repository.Estate{Length: 10, Width: 10, LastModified: time.Date(2024, time.March, 4, 10, 15, 0, 0, time.UTC)},
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		mock           func(mockRepo *repository.MockRepositoryInterface)
+		expectedStatus int
+	}{
+		{
+			name:   "Create estate",
+			method: http.MethodPost,
+			target: "/estate",
+			body:   `{"length": 10, "width": 10}`,
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().CreateEstate(gomock.Any(), gomock.Any()).Return(&repository.CreateEstateOutput{Id: estateId.String()}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Create estate - invalid body",
+			method:         http.MethodPost,
+			target:         "/estate",
+			body:           `{"length": 0}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Create estate - unknown field",
+			method:         http.MethodPost,
+			target:         "/estate",
+			body:           `{"length": 10, "width": 10, "owner": "me"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Get estate",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String(),
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Get estate - invalid estate ID",
+			method:         http.MethodGet,
+			target:         "/estate/abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Create tree",
+			method: http.MethodPost,
+			target: "/estate/" + estateId.String() + "/tree",
+			body:   `{"x": 1, "y": 1, "height": 10}`,
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+				mockRepo.EXPECT().IsTreeExist(gomock.Any(), gomock.Any()).Return(&repository.IsTreeExistOutput{}, nil)
+				mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(&repository.CreateTreeOutput{Id: treeId.String()}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "Create tree - plot out of bounds",
+			method: http.MethodPost,
+			target: "/estate/" + estateId.String() + "/tree",
+			body:   `{"x": 11, "y": 1, "height": 10}`,
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Create tree - estate not found",
+			method: http.MethodPost,
+			target: "/estate/" + estateId.String() + "/tree",
+			body:   `{"x": 1, "y": 1, "height": 10}`,
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "Get tree",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/tree/" + treeId.String(),
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetTreeByTreeId(gomock.Any(), gomock.Any()).Return(&repository.GetTreeByTreeIdOutput{
+					Tree: repository.Tree{X: 1, Y: 1, Height: 10},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Get tree - not found",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/tree/" + treeId.String(),
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetTreeByTreeId(gomock.Any(), gomock.Any()).Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "Get stats",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/stats",
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+				mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{
+					Count: 2, Max: 12, Min: 8, Median: 10,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Get stats - invalid parameter",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId.String() + "/stats?histogram_buckets=31",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Get drone plan",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/drone-plan",
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateTreesByEstateIdOutput{
+					Trees:  []repository.Tree{{X: 1, Y: 1, Height: 10}},
+					Estate: estate.Estate,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Get drone plan - grounded",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/drone-plan?max-distance=1",
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateTreesByEstateIdOutput{
+					Trees:  []repository.Tree{{X: 1, Y: 1, Height: 10}},
+					Estate: estate.Estate,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Get drone plan - internal error",
+			method: http.MethodGet,
+			target: "/estate/" + estateId.String() + "/drone-plan",
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Get drone plan - negative max distance",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId.String() + "/drone-plan?max-distance=-5",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Get drone plan - max distance too large",
+			method:         http.MethodGet,
+			target:         "/estate/" + estateId.String() + "/drone-plan?max-distance=1000000001",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Get job - not found",
+			method: http.MethodGet,
+			target: "/jobs/" + jobId.String(),
+			mock: func(mockRepo *repository.MockRepositoryInterface) {
+				mockRepo.EXPECT().GetJobByJobId(gomock.Any(), gomock.Any()).Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Get portfolio stats - invalid rank limit",
+			method:         http.MethodGet,
+			target:         "/estates/stats?rank_limit=101",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Export - unsupported format",
+			method:         http.MethodGet,
+			target:         "/estates/export?format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server, mockRepo, e := setupTestServer(t)
+			if tc.mock != nil {
+				tc.mock(mockRepo)
+			}
+			e.Validator = validator.NewRequestValidator()
+			e.HTTPErrorHandler = ProblemHTTPErrorHandler
+			responseValidator, err := apispec.NewResponseValidator(apispec.NewResponseValidatorOptions{
+				OnViolation: func(ctx echo.Context, err error) {
+					t.Errorf("response does not match the OpenAPI specification: %s", err)
+				},
+			})
+			require.NoError(t, err)
+			e.Use(responseValidator.Middleware())
+			requestValidator, err := apispec.NewRequestValidator(apispec.NewRequestValidatorOptions{})
+			require.NoError(t, err)
+			e.Use(requestValidator.Middleware())
+			generated.RegisterHandlers(e, server)
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -1,17 +1,28 @@
 package handler
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
-	"math"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/export"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/planner"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/gommon/log"
 	openapi_types "github.com/oapi-codegen/runtime/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PostEstate is an HTTP handler that creates a new estate.
@@ -21,20 +32,20 @@ import (
 //   - Width: the width of the estate
 //
 // If the request is valid, it creates a new estate in the repository and returns
-// a JSON response with the ID of the new estate.
+// a JSON response with the ID of the new estate, with a 201 status and a Location header.
 // If the request is invalid or there is an error creating the estate, it returns
 // an appropriate HTTP error response.
 func (s *Server) PostEstate(ctx echo.Context) error {
 	var req generated.PostEstateJSONRequestBody
 	err := json.NewDecoder(ctx.Request().Body).Decode(&req)
 	if err != nil {
-		log.Print("err decoding request: ", err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		slog.WarnContext(ctx.Request().Context(), "err decoding request", "error", err)
+		return writeProblem(ctx, NewBodyProblem(err))
 	}
 
 	if err := ctx.Validate(req); err != nil {
-		log.Print("err validating request: ", err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		slog.WarnContext(ctx.Request().Context(), "err validating request", "error", err)
+		return writeProblem(ctx, NewBodyProblem(err))
 	}
 
 	createEstateInput := &repository.CreateEstateInput{
@@ -45,34 +56,59 @@ func (s *Server) PostEstate(ctx echo.Context) error {
 
 	output, err := s.Repository.CreateEstate(ctx.Request().Context(), createEstateInput)
 	if err != nil {
-		log.Print("err when creating estate: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err when creating estate", "error", err)
+		return writeInternalError(ctx)
 	}
 	var resp generated.EstateResponse
 	resp.Id, err = uuid.Parse(output.Id)
 	if err != nil {
-		log.Print("err when parsing estate UUID: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err when parsing estate UUID", "error", err)
+		return writeInternalError(ctx)
 	}
-	return ctx.JSON(http.StatusOK, resp)
+	ctx.Response().Header().Set(echo.HeaderLocation, "/estate/"+resp.Id.String())
+	return ctx.JSON(http.StatusCreated, resp)
+}
+
+// GetEstateEstateId retrieves the dimensions of an estate and the time of its newest change.
+func (s *Server) GetEstateEstateId(ctx echo.Context, estateId openapi_types.UUID) error {
+	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
+		Id: estateId.String(),
+	}
+	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if estate == nil {
+		return writeEstateNotFound(ctx)
+	}
+
+	resp := generated.EstateDetailResponse{
+		Id:        estateId,
+		Length:    estate.Estate.Length,
+		Width:     estate.Estate.Width,
+		UpdatedAt: estate.Estate.LastModified,
+	}
+	return conditionalJSON(ctx, resp, estate.Estate.LastModified)
 }
 
 // PostEstateEstateIdTree creates a new tree for the specified estate.
 // It validates the request body, checks if the estate exists, ensures the requested
 // coordinates are within the estate's boundaries, and checks if a tree already exists
 // at the specified coordinates. If all checks pass, it creates a new tree and returns
-// the tree's ID in the response.
+// the tree's ID in the response, with a 201 status and a Location header.
 func (s *Server) PostEstateEstateIdTree(ctx echo.Context, estateId openapi_types.UUID) error {
 	var req generated.PostEstateEstateIdTreeJSONRequestBody
 	err := json.NewDecoder(ctx.Request().Body).Decode(&req)
 	if err != nil {
-		log.Print("err decoding request: ", err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		slog.WarnContext(ctx.Request().Context(), "err decoding request", "error", err)
+		return writeProblem(ctx, NewBodyProblem(err))
 	}
 
 	if err := ctx.Validate(req); err != nil {
-		log.Print("err validating request: ", err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		slog.WarnContext(ctx.Request().Context(), "err validating request", "error", err)
+		return writeProblem(ctx, NewBodyProblem(err))
 	}
 
 	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
@@ -81,16 +117,16 @@ func (s *Server) PostEstateEstateIdTree(ctx echo.Context, estateId openapi_types
 	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
 
 	if err != nil {
-		log.Error("err getting estate by estate id: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
 	}
 
 	if estate == nil {
-		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "Estate not found"})
+		return writeEstateNotFound(ctx)
 	}
 
 	if (req.X > int(estate.Estate.Length) || req.X < 0) || (req.Y > int(estate.Estate.Width) || req.Y < 0) {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return writeProblem(ctx, newPlotOutOfBoundsProblem(req.X, req.Y, estate.Estate))
 	}
 
 	isTreeExistInput := &repository.IsTreeExistInput{
@@ -100,12 +136,12 @@ func (s *Server) PostEstateEstateIdTree(ctx echo.Context, estateId openapi_types
 	}
 	isTreeExistOutput, err := s.Repository.IsTreeExist(ctx.Request().Context(), isTreeExistInput)
 	if err != nil {
-		log.Error("err checking whether tree is exist or not: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err checking whether tree is exist or not", "error", err)
+		return writeInternalError(ctx)
 	}
 
 	if isTreeExistOutput.IsExist {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeTreeAlreadyExists, fmt.Sprintf("A tree already exists at plot (%d, %d).", req.X, req.Y)))
 	}
 
 	createTreeInput := &repository.CreateTreeInput{
@@ -118,42 +154,78 @@ func (s *Server) PostEstateEstateIdTree(ctx echo.Context, estateId openapi_types
 
 	output, err := s.Repository.CreateTree(ctx.Request().Context(), createTreeInput)
 	if err != nil {
-		log.Error("err creating tree: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err creating tree", "error", err)
+		return writeInternalError(ctx)
 	}
 	var resp generated.TreeResponse
 	resp.Id, err = uuid.Parse(output.Id)
 	if err != nil {
-		log.Print("err when parsing tree UUID: ", err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		slog.ErrorContext(ctx.Request().Context(), "err when parsing tree UUID", "error", err)
+		return writeInternalError(ctx)
+	}
+	ctx.Response().Header().Set(echo.HeaderLocation, "/estate/"+estateId.String()+"/tree/"+resp.Id.String())
+	return ctx.JSON(http.StatusCreated, resp)
+}
+
+// GetEstateEstateIdTreeTreeId retrieves a tree of an estate.
+func (s *Server) GetEstateEstateIdTreeTreeId(ctx echo.Context, estateId openapi_types.UUID, treeId openapi_types.UUID) error {
+	output, err := s.Repository.GetTreeByTreeId(ctx.Request().Context(), &repository.GetTreeByTreeIdInput{
+		Id:       treeId.String(),
+		EstateId: estateId.String(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting tree by tree id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if output == nil {
+		return writeProblem(ctx, NewProblem(http.StatusNotFound, CodeTreeNotFound, "Tree not found"))
+	}
+
+	resp := generated.TreeDetailResponse{
+		Id:       treeId,
+		EstateId: estateId,
+		X:        output.Tree.X,
+		Y:        output.Tree.Y,
+		Height:   output.Tree.Height,
 	}
 	return ctx.JSON(http.StatusOK, resp)
 }
 
+// defaultStatsPercentiles and defaultHistogramBuckets are used when the distribution or the histogram
+// section is requested without its parameter.
+var defaultStatsPercentiles = []float64{10, 25, 75, 90}
+
+const defaultHistogramBuckets = 6
+
 // GetEstateEstateIdStats retrieves the statistics for an estate based on the provided estate ID.
 // It returns the count, maximum, minimum, and median values for the estate.
-func (s *Server) GetEstateEstateIdStats(ctx echo.Context, estateId openapi_types.UUID) error {
+// The distribution (mean, standard deviation and percentiles), histogram and density sections
+// are opt-in, so that the response stays the same for existing clients.
+func (s *Server) GetEstateEstateIdStats(ctx echo.Context, estateId openapi_types.UUID, params generated.GetEstateEstateIdStatsParams) error {
+	options, problem := newEstateStatsOptions(estateId.String(), params)
+	if problem != nil {
+		return writeProblem(ctx, problem)
+	}
+
 	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
 		Id: estateId.String(),
 	}
 	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
 
 	if err != nil {
-		log.Error("err getting estate by estate id: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
 	}
 
 	if estate == nil {
-		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "Estate not found"})
+		return writeEstateNotFound(ctx)
 	}
 
-	getEstateStatsByEstateIdInput := &repository.GetEstateStatsByEstateIdInput{
-		EstateId: estateId.String(),
-	}
-	output, err := s.Repository.GetEstateStatsByEstateId(ctx.Request().Context(), getEstateStatsByEstateIdInput)
+	output, err := s.Repository.GetEstateStatsByEstateId(ctx.Request().Context(), options.input)
 	if err != nil {
-		log.Error("err getting estate stats by estate id: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate stats by estate id", "error", err)
+		return writeInternalError(ctx)
 	}
 
 	var resp generated.EstateStatsResponse
@@ -162,24 +234,444 @@ func (s *Server) GetEstateEstateIdStats(ctx echo.Context, estateId openapi_types
 	resp.Min = output.Min
 	resp.Median = output.Median
 
+	if options.input.IncludeDistribution {
+		resp.Distribution = &generated.EstateStatsDistribution{
+			Mean:        output.Mean,
+			Stddev:      output.StdDev,
+			Percentiles: []generated.EstateStatsPercentile{},
+		}
+		for i, percentile := range options.percentiles {
+			resp.Distribution.Percentiles = append(resp.Distribution.Percentiles, generated.EstateStatsPercentile{
+				Percentile: percentile,
+				Value:      output.Percentiles[i],
+			})
+		}
+	}
+
+	if options.input.HistogramBuckets > 0 {
+		histogram := []generated.EstateStatsHistogramBucket{}
+		for _, bucket := range output.Histogram {
+			histogram = append(histogram, generated.EstateStatsHistogramBucket{
+				Min:   bucket.Min,
+				Max:   bucket.Max,
+				Count: bucket.Count,
+			})
+		}
+		resp.Histogram = &histogram
+	}
+
+	if options.includeDensity {
+		resp.Density = s.newEstateStatsDensity(estate.Estate, output.Count)
+	}
+
+	if options.series != nil {
+		seriesOutput, err := s.Repository.GetEstateStatsSeriesByEstateId(ctx.Request().Context(), options.series)
+		if err != nil {
+			slog.ErrorContext(ctx.Request().Context(), "err getting estate stats series by estate id", "error", err)
+			return writeInternalError(ctx)
+		}
+		if len(seriesOutput.Points) > maxStatsSeriesPoints {
+			return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeTooManyResults, fmt.Sprintf("The series has more than %d points, use a longer interval or a later since.", maxStatsSeriesPoints)))
+		}
+
+		resp.Series = &generated.EstateStatsSeries{
+			Interval: generated.EstateStatsSeriesInterval(options.series.Interval),
+			Points:   []generated.EstateStatsSeriesPoint{},
+		}
+		for _, point := range seriesOutput.Points {
+			resp.Series.Points = append(resp.Series.Points, generated.EstateStatsSeriesPoint{
+				PeriodStart: point.PeriodStart,
+				PeriodEnd:   point.PeriodEnd,
+				NewTrees:    point.NewTrees,
+				Count:       point.Count,
+				Median:      point.Median,
+				Mean:        point.Mean,
+			})
+		}
+	}
+
+	lastModified := estate.Estate.LastModified
+	if options.series != nil && params.AsOf == nil {
+		// The last point of the series ends now, so the response changes even when no tree is added.
+		lastModified = time.Time{}
+	}
+	return conditionalJSON(ctx, resp, lastModified)
+}
+
+// maxStatsSeriesPoints caps the number of points of the series section.
+const maxStatsSeriesPoints = 1000
+
+// estateStatsOptions holds the sections requested from the stats endpoint.
+type estateStatsOptions struct {
+	input *repository.GetEstateStatsByEstateIdInput
+	// percentiles are the requested percentiles, between 0 and 100.
+	percentiles    []float64
+	includeDensity bool
+	// series is nil when no series is requested.
+	series *repository.GetEstateStatsSeriesByEstateIdInput
+}
+
+// newEstateStatsOptions translates the query parameters of the stats endpoint into a repository input.
+// A section is included when it is listed in params.Include or when one of its parameters is set.
+// It returns a Problem when a parameter is out of range.
+func newEstateStatsOptions(estateId string, params generated.GetEstateEstateIdStatsParams) (*estateStatsOptions, *Problem) {
+	input := &repository.GetEstateStatsByEstateIdInput{
+		EstateId: estateId,
+		AsOf:     params.AsOf,
+	}
+	options := &estateStatsOptions{input: input}
+	if params.Include != nil {
+		for _, section := range *params.Include {
+			switch section {
+			case generated.GetEstateEstateIdStatsParamsIncludeDistribution:
+				input.IncludeDistribution = true
+			case generated.GetEstateEstateIdStatsParamsIncludeHistogram:
+				input.HistogramBuckets = defaultHistogramBuckets
+			case generated.GetEstateEstateIdStatsParamsIncludeDensity:
+				options.includeDensity = true
+			default:
+				return nil, newParameterProblem("include", "oneof", "distribution histogram density", "include must only list distribution, histogram or density")
+			}
+		}
+	}
+
+	percentiles := defaultStatsPercentiles
+	if params.Percentiles != nil {
+		input.IncludeDistribution = true
+		percentiles = *params.Percentiles
+	}
+	if input.IncludeDistribution {
+		for _, percentile := range percentiles {
+			if percentile < 0 || percentile > 100 {
+				return nil, newPercentileProblem()
+			}
+			input.Percentiles = append(input.Percentiles, percentile/100)
+		}
+		options.percentiles = percentiles
+	}
+
+	if params.HistogramBuckets != nil {
+		maxBuckets := repository.MaxTreeHeight - repository.MinTreeHeight + 1
+		if *params.HistogramBuckets < 1 || *params.HistogramBuckets > maxBuckets {
+			return nil, newParameterProblem("histogram_buckets", "range", fmt.Sprintf("1 %d", maxBuckets), fmt.Sprintf("histogram_buckets must be between 1 and %d", maxBuckets))
+		}
+		input.HistogramBuckets = *params.HistogramBuckets
+	}
+
+	if params.Interval != nil {
+		switch *params.Interval {
+		case generated.GetEstateEstateIdStatsParamsIntervalDay, generated.GetEstateEstateIdStatsParamsIntervalWeek,
+			generated.GetEstateEstateIdStatsParamsIntervalMonth, generated.GetEstateEstateIdStatsParamsIntervalQuarter,
+			generated.GetEstateEstateIdStatsParamsIntervalYear:
+		default:
+			return nil, newParameterProblem("interval", "oneof", "day week month quarter year", "interval must be one of day, week, month, quarter or year")
+		}
+		options.series = &repository.GetEstateStatsSeriesByEstateIdInput{
+			EstateId: estateId,
+			Interval: string(*params.Interval),
+			AsOf:     time.Now(),
+			Since:    params.Since,
+			// One more point than allowed is requested to detect a series that is too long.
+			MaxPoints: maxStatsSeriesPoints + 1,
+		}
+		if params.AsOf != nil {
+			options.series.AsOf = *params.AsOf
+		}
+		if params.Since != nil && params.Since.After(options.series.AsOf) {
+			return nil, newParameterProblem("since", "before", "as_of", "since must not be after as_of")
+		}
+	} else if params.Since != nil {
+		return nil, newParameterProblem("since", "required_with", "interval", "since can only be used with interval")
+	}
+	return options, nil
+}
+
+// newEstateStatsDensity computes the planting density of an estate.
+// A plot is a square whose side is the scale factor, in meters.
+func (s *Server) newEstateStatsDensity(estate repository.Estate, count int) *generated.EstateStatsDensity {
+	plots := estate.Length * estate.Width
+	return &generated.EstateStatsDensity{
+		Plots:           plots,
+		AreaHectares:    s.areaHectares(plots),
+		TreesPerPlot:    float64(count) / float64(plots),
+		TreesPerHectare: s.treesPerHectare(count, plots),
+		EmptyPlotShare:  float64(plots-count) / float64(plots),
+	}
+}
+
+// maxStatsGroups caps the number of groups returned by GetEstateEstateIdStatsGrouped.
+const maxStatsGroups = 10000
+
+// GetEstateEstateIdStatsGrouped retrieves the statistics of every block, row or column of an estate.
+// Rows and columns are blocks as long or as wide as the estate, so the grouping is always done by block
+// in the repository.
+func (s *Server) GetEstateEstateIdStatsGrouped(ctx echo.Context, estateId openapi_types.UUID, params generated.GetEstateEstateIdStatsGroupedParams) error {
+	groupBy := generated.EstateGroupedStatsResponseGroupByBlock
+	if params.GroupBy != nil {
+		groupBy = generated.EstateGroupedStatsResponseGroupBy(*params.GroupBy)
+	}
+	blockLength, blockWidth := 10, 10
+	if params.BlockLength != nil {
+		blockLength = *params.BlockLength
+	}
+	if params.BlockWidth != nil {
+		blockWidth = *params.BlockWidth
+	}
+	if blockLength < 1 {
+		return writeProblem(ctx, newParameterProblem("block_length", "min", "1", "block_length must be at least 1"))
+	}
+	if blockWidth < 1 {
+		return writeProblem(ctx, newParameterProblem("block_width", "min", "1", "block_width must be at least 1"))
+	}
+
+	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
+		Id: estateId.String(),
+	}
+	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if estate == nil {
+		return writeEstateNotFound(ctx)
+	}
+
+	switch groupBy {
+	case generated.EstateGroupedStatsResponseGroupByBlock:
+	case generated.EstateGroupedStatsResponseGroupByRow:
+		blockLength, blockWidth = estate.Estate.Length, 1
+	case generated.EstateGroupedStatsResponseGroupByColumn:
+		blockLength, blockWidth = 1, estate.Estate.Width
+	default:
+		return writeProblem(ctx, newParameterProblem("group_by", "oneof", "block row column", "group_by must be one of block, row or column"))
+	}
+
+	groupsAlongX := (estate.Estate.Length + blockLength - 1) / blockLength
+	groupsAlongY := (estate.Estate.Width + blockWidth - 1) / blockWidth
+	if groupsAlongX*groupsAlongY > maxStatsGroups {
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeTooManyResults, fmt.Sprintf("The grouping yields more than %d groups, use larger blocks.", maxStatsGroups)))
+	}
+
+	getEstateGroupedStatsByEstateIdInput := &repository.GetEstateGroupedStatsByEstateIdInput{
+		EstateId:    estateId.String(),
+		BlockLength: blockLength,
+		BlockWidth:  blockWidth,
+	}
+	output, err := s.Repository.GetEstateGroupedStatsByEstateId(ctx.Request().Context(), getEstateGroupedStatsByEstateIdInput)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate grouped stats by estate id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	resp := generated.EstateGroupedStatsResponse{
+		GroupBy:     groupBy,
+		BlockLength: blockLength,
+		BlockWidth:  blockWidth,
+		Groups:      []generated.EstateStatsGroup{},
+	}
+	for _, group := range output.Groups {
+		resp.Groups = append(resp.Groups, generated.EstateStatsGroup{
+			BlockX: group.BlockX,
+			BlockY: group.BlockY,
+			MinX:   group.BlockX*blockLength + 1,
+			MaxX:   min((group.BlockX+1)*blockLength, estate.Estate.Length),
+			MinY:   group.BlockY*blockWidth + 1,
+			MaxY:   min((group.BlockY+1)*blockWidth, estate.Estate.Width),
+			Count:  group.Count,
+			Max:    group.Max,
+			Min:    group.Min,
+			Median: group.Median,
+			Mean:   group.Mean,
+		})
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+const defaultPortfolioRankLimit = 5
+
+// GetEstatesStats retrieves the statistics of the trees across all the estates matching the filters,
+// and the top and bottom estates by median height or density.
+func (s *Server) GetEstatesStats(ctx echo.Context, params generated.GetEstatesStatsParams) error {
+	input, percentiles, problem := newPortfolioStatsInput(params)
+	if problem != nil {
+		return writeProblem(ctx, problem)
+	}
+
+	output, err := s.Repository.GetPortfolioStats(ctx.Request().Context(), input)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting portfolio stats", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	resp := generated.PortfolioStatsResponse{
+		Estates:      output.Estates,
+		Plots:        output.Plots,
+		AreaHectares: s.areaHectares(output.Plots),
+		Count:        output.Count,
+		Max:          output.Max,
+		Min:          output.Min,
+		Median:       output.Median,
+		Distribution: generated.EstateStatsDistribution{
+			Mean:        output.Mean,
+			Stddev:      output.StdDev,
+			Percentiles: []generated.EstateStatsPercentile{},
+		},
+		RankBy: generated.PortfolioStatsResponseRankBy(input.RankBy),
+		Top:    s.newPortfolioEstateRanks(output.Top),
+		Bottom: s.newPortfolioEstateRanks(output.Bottom),
+	}
+	resp.TreesPerHectare = s.treesPerHectare(output.Count, output.Plots)
+	for i, percentile := range percentiles {
+		resp.Distribution.Percentiles = append(resp.Distribution.Percentiles, generated.EstateStatsPercentile{
+			Percentile: percentile,
+			Value:      output.Percentiles[i],
+		})
+	}
 	return ctx.JSON(http.StatusOK, resp)
 }
 
+// newPortfolioStatsInput translates the query parameters of the portfolio stats endpoint into a repository input,
+// and returns the requested percentiles, between 0 and 100.
+// It returns a Problem when a parameter is out of range or when a range is empty.
+func newPortfolioStatsInput(params generated.GetEstatesStatsParams) (*repository.GetPortfolioStatsInput, []float64, *Problem) {
+	input := &repository.GetPortfolioStatsInput{
+		Filter: repository.EstateFilter{
+			MinLength:     params.MinLength,
+			MaxLength:     params.MaxLength,
+			MinWidth:      params.MinWidth,
+			MaxWidth:      params.MaxWidth,
+			CreatedAfter:  params.CreatedAfter,
+			CreatedBefore: params.CreatedBefore,
+		},
+		RankBy:    repository.PortfolioRankByMedian,
+		RankLimit: defaultPortfolioRankLimit,
+	}
+	if params.MinLength != nil && params.MaxLength != nil && *params.MinLength > *params.MaxLength {
+		return nil, nil, newParameterProblem("min_length", "lte", "max_length", "min_length must not be greater than max_length")
+	}
+	if params.MinWidth != nil && params.MaxWidth != nil && *params.MinWidth > *params.MaxWidth {
+		return nil, nil, newParameterProblem("min_width", "lte", "max_width", "min_width must not be greater than max_width")
+	}
+	if params.CreatedAfter != nil && params.CreatedBefore != nil && !params.CreatedAfter.Before(*params.CreatedBefore) {
+		return nil, nil, newParameterProblem("created_after", "before", "created_before", "created_after must be before created_before")
+	}
+
+	percentiles := defaultStatsPercentiles
+	if params.Percentiles != nil {
+		percentiles = *params.Percentiles
+	}
+	for _, percentile := range percentiles {
+		if percentile < 0 || percentile > 100 {
+			return nil, nil, newPercentileProblem()
+		}
+		input.Percentiles = append(input.Percentiles, percentile/100)
+	}
+
+	if params.RankBy != nil {
+		switch *params.RankBy {
+		case generated.Median:
+			input.RankBy = repository.PortfolioRankByMedian
+		case generated.Density:
+			input.RankBy = repository.PortfolioRankByDensity
+		default:
+			return nil, nil, newParameterProblem("rank_by", "oneof", "median density", "rank_by must be one of median or density")
+		}
+	}
+	if params.RankLimit != nil {
+		if *params.RankLimit < 1 || *params.RankLimit > 100 {
+			return nil, nil, newParameterProblem("rank_limit", "range", "1 100", "rank_limit must be between 1 and 100")
+		}
+		input.RankLimit = *params.RankLimit
+	}
+	return input, percentiles, nil
+}
+
+func (s *Server) newPortfolioEstateRanks(ranks []repository.EstateRank) []generated.PortfolioEstateRank {
+	resp := []generated.PortfolioEstateRank{}
+	for _, rank := range ranks {
+		estateId, err := uuid.Parse(rank.EstateId)
+		if err != nil {
+			slog.Error("err parsing the estate id of a ranked estate", "error", err)
+			continue
+		}
+		resp = append(resp, generated.PortfolioEstateRank{
+			EstateId:        estateId,
+			Length:          rank.Length,
+			Width:           rank.Width,
+			Count:           rank.Count,
+			Median:          rank.Median,
+			TreesPerHectare: s.treesPerHectare(rank.Count, rank.Length*rank.Width),
+		})
+	}
+	return resp
+}
+
+// areaHectares converts a number of plots into hectares. A plot is a square whose side is the scale factor, in meters.
+func (s *Server) areaHectares(plots int) float64 {
+	return float64(plots) * float64(s.Config.ScaleFactor*s.Config.ScaleFactor) / 10000
+}
+
+// treesPerHectare is 0 when the area is unknown, i.e. when no scale factor is configured.
+func (s *Server) treesPerHectare(count, plots int) float64 {
+	area := s.areaHectares(plots)
+	if area <= 0 {
+		return 0
+	}
+	return float64(count) / area
+}
+
+// maxDroneDistance is the largest max-distance accepted by GetEstateEstateIdDronePlan.
+const maxDroneDistance = 1_000_000_000
+
 // GetEstateEstateIdDronePlan retrieves the estate and trees for the given estate ID,
 // calculates the total distance the drone needs to travel to cover the entire estate,
 // and returns the drone plan response with the total distance.
+// With max-distance, the response tells whether the drone is grounded, stops before the end of the plan, or completes it.
+// When the plan cache is enabled, the plan is only computed when the estate changed since the plan was cached.
 func (s *Server) GetEstateEstateIdDronePlan(ctx echo.Context, estateId openapi_types.UUID, params generated.GetEstateEstateIdDronePlanParams) error {
+	if params.MaxDistance != nil && (*params.MaxDistance < 1 || *params.MaxDistance > maxDroneDistance) {
+		return writeProblem(ctx, newParameterProblem("max-distance", "range", fmt.Sprintf("1 %d", maxDroneDistance),
+			fmt.Sprintf("max-distance must be between 1 and %d", maxDroneDistance)))
+	}
+
+	var cacheKey plancache.Key
+	if s.PlanCache != nil {
+		// The revision is read before the trees, so a plan is never cached under a revision later than its trees.
+		estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), &repository.GetEstateByEstateIdInput{
+			Id: estateId.String(),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+			return writeInternalError(ctx)
+		}
+
+		if estate == nil {
+			return writeEstateNotFound(ctx)
+		}
+
+		cacheKey = plancache.Key{
+			EstateId:    estateId.String(),
+			Revision:    estate.Estate.Revision,
+			ScaleFactor: s.Config.ScaleFactor,
+			MaxDistance: params.MaxDistance,
+		}
+		if plan, ok := s.PlanCache.Get(ctx.Request().Context(), cacheKey); ok {
+			return conditionalJSON(ctx, newDronePlanResponse(plan, estate.Estate, params), estate.Estate.LastModified)
+		}
+	}
+
 	getEstateEstateIdDronePlanInput := &repository.GetEstateTreesByEstateIdInput{
 		EstateId: estateId.String(),
 	}
 	output, err := s.Repository.GetEstateTreesByEstateId(ctx.Request().Context(), getEstateEstateIdDronePlanInput)
 	if err != nil {
-		log.Print("err getting estate trees by estate id: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Invalid request"})
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate trees by estate id", "error", err)
+		return writeInternalError(ctx)
 	}
 
 	if output == nil {
-		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "Estate not found"})
+		return writeEstateNotFound(ctx)
 	}
 
 	calculateDroneDistanceInput := &repository.CalculateDroneDistanceInput{
@@ -187,32 +679,324 @@ func (s *Server) GetEstateEstateIdDronePlan(ctx echo.Context, estateId openapi_t
 		Trees:  output.Trees,
 	}
 
-	calculateDroneDistanceOutput, err := s.CalculateDroneDistance(calculateDroneDistanceInput, params.MaxDistance)
+	calculateDroneDistanceOutput, err := s.traceDroneDistance(ctx.Request().Context(), calculateDroneDistanceInput, params.MaxDistance)
 	if err != nil {
-		log.Print("err calculating drone distance: ", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "Something happens in our end. Let us check."})
+		slog.ErrorContext(ctx.Request().Context(), "err calculating drone distance", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if s.PlanCache != nil {
+		s.PlanCache.Put(ctx.Request().Context(), cacheKey, *calculateDroneDistanceOutput)
 	}
 
+	return conditionalJSON(ctx, newDronePlanResponse(calculateDroneDistanceOutput, output.Estate, params), output.Estate.LastModified)
+}
+
+func newDronePlanResponse(plan *repository.CalculateDroneDistanceOutput, estate repository.Estate, params generated.GetEstateEstateIdDronePlanParams) generated.DronePlanResponse {
 	var resp generated.DronePlanResponse
-	resp.Distance = calculateDroneDistanceOutput.TotalDistance
-	if params.MaxDistance != nil {
-		resp.Distance = *params.MaxDistance
+	resp.Distance = plan.TotalDistance
+	if params.MaxDistance == nil {
+		return resp
+	}
+
+	resp.Distance = *params.MaxDistance
+	outcome := dronePlanOutcome(plan, estate)
+	resp.Outcome = &outcome
+	// A grounded drone never leaves the take off point, which is not a plot of the estate.
+	if outcome != generated.Grounded {
 		resp.Rest = &struct {
 			X *int `json:"x,omitempty"`
 			Y *int `json:"y,omitempty"`
 		}{
-			X: &calculateDroneDistanceOutput.LastAchievableXCoordinate,
-			Y: &calculateDroneDistanceOutput.LastAchievableYCoordinate,
+			X: &plan.LastAchievableXCoordinate,
+			Y: &plan.LastAchievableYCoordinate,
 		}
+	}
+	return resp
+}
+
+// dronePlanOutcome tells how far the drone gets within max-distance from the last plot it reaches, so that it
+// is also known for the plans computed before the outcome existed, e.g. the cached ones.
+func dronePlanOutcome(plan *repository.CalculateDroneDistanceOutput, estate repository.Estate) generated.DronePlanResponseOutcome {
+	rest := planner.Plot{X: plan.LastAchievableXCoordinate, Y: plan.LastAchievableYCoordinate}
+	return generated.DronePlanResponseOutcome(planner.NewOutcome(newPlannerEstate(estate), rest))
+}
+
+// maxImportSize is the largest import file accepted by PostEstateEstateIdTreeImport.
+const maxImportSize = 64 << 20
+
+// PostEstateEstateIdTreeImport accepts a CSV or NDJSON file of trees for the specified estate.
+// The file is stored in an import job that is processed in the background, and the job is
+// returned with a 202 status and a Location header pointing to it.
+func (s *Server) PostEstateEstateIdTreeImport(ctx echo.Context, estateId openapi_types.UUID) error {
+	contentType, err := job.NormalizeContentType(ctx.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return writeProblem(ctx, NewProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, err.Error()))
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(ctx.Request().Body, maxImportSize+1))
+	if err != nil {
+		slog.WarnContext(ctx.Request().Context(), "err reading import file", "error", err)
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeMalformedBody, "The import file cannot be read."))
+	}
+	if len(payload) == 0 {
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeMalformedBody, "The import file is empty."))
+	}
+	if len(payload) > maxImportSize {
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeMalformedBody, fmt.Sprintf("The import file is larger than %d bytes.", maxImportSize)))
+	}
+	if _, err := job.CountImportRows(contentType, payload); err != nil {
+		slog.WarnContext(ctx.Request().Context(), "err reading import file", "error", err)
+		return writeProblem(ctx, NewProblem(http.StatusBadRequest, CodeMalformedBody, err.Error()))
+	}
+
+	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
+		Id: estateId.String(),
+	}
+	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if estate == nil {
+		return writeEstateNotFound(ctx)
+	}
+
+	createJobInput := &repository.CreateJobInput{
+		Id:          uuid.New().String(),
+		Kind:        repository.JobKindTreeImport,
+		EstateId:    estateId.String(),
+		ContentType: contentType,
+		Payload:     payload,
+	}
+	output, err := s.Repository.CreateJob(ctx.Request().Context(), createJobInput)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err creating import job", "error", err)
+		return writeInternalError(ctx)
+	}
+	s.JobManager.Notify()
+
+	resp, err := newJobResponse(&output.Job)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err building job response", "error", err)
+		return writeInternalError(ctx)
+	}
+	ctx.Response().Header().Set(echo.HeaderLocation, "/jobs/"+output.Job.Id)
+	return ctx.JSON(http.StatusAccepted, resp)
+}
+
+// GetJobsJobId returns the state, the progress, the counters and a sample of the errors of a job.
+func (s *Server) GetJobsJobId(ctx echo.Context, jobId openapi_types.UUID) error {
+	output, err := s.Repository.GetJobByJobId(ctx.Request().Context(), &repository.GetJobByJobIdInput{
+		Id: jobId.String(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting job by job id", "error", err)
+		return writeInternalError(ctx)
+	}
 
+	if output == nil {
+		return writeProblem(ctx, NewProblem(http.StatusNotFound, CodeJobNotFound, "Job not found"))
 	}
 
+	resp, err := newJobResponse(&output.Job)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err building job response", "error", err)
+		return writeInternalError(ctx)
+	}
 	return ctx.JSON(http.StatusOK, resp)
 }
 
+// DeleteJobsJobId requests the cancellation of a job and returns the job with a 202 status.
+// Finished jobs are returned unchanged.
+func (s *Server) DeleteJobsJobId(ctx echo.Context, jobId openapi_types.UUID) error {
+	cancelledJob, err := s.JobManager.Cancel(ctx.Request().Context(), jobId.String())
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err cancelling job", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if cancelledJob == nil {
+		return writeProblem(ctx, NewProblem(http.StatusNotFound, CodeJobNotFound, "Job not found"))
+	}
+
+	resp, err := newJobResponse(cancelledJob)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err building job response", "error", err)
+		return writeInternalError(ctx)
+	}
+	return ctx.JSON(http.StatusAccepted, resp)
+}
+
+// newJobResponse converts a repository job into its API representation.
+func newJobResponse(j *repository.Job) (*generated.JobResponse, error) {
+	id, err := uuid.Parse(j.Id)
+	if err != nil {
+		return nil, err
+	}
+	estateId, err := uuid.Parse(j.EstateId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &generated.JobResponse{
+		Id:        id,
+		Kind:      generated.JobResponseKind(j.Kind),
+		State:     generated.JobResponseState(j.State),
+		EstateId:  estateId,
+		Total:     j.TotalRows,
+		Processed: j.ProcessedRows,
+		Succeeded: j.SucceededRows,
+		Failed:    j.FailedRows,
+		Errors:    []generated.JobError{},
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+	if j.TotalRows > 0 {
+		resp.Progress = float32(j.ProcessedRows) / float32(j.TotalRows)
+	}
+	if j.State == repository.JobStateSucceeded {
+		resp.Progress = 1
+	}
+	for _, e := range j.ErrorSamples {
+		resp.Errors = append(resp.Errors, generated.JobError{Row: e.Row, Message: e.Message})
+	}
+	return resp, nil
+}
+
+// exportFlushEvery is the number of rows written between two flushes of an export response.
+const exportFlushEvery = 500
+
+// GetEstateEstateIdExport streams the trees of the specified estate as CSV or NDJSON,
+// optionally compressed with gzip.
+func (s *Server) GetEstateEstateIdExport(ctx echo.Context, estateId openapi_types.UUID, params generated.GetEstateEstateIdExportParams) error {
+	format, compression := string(generated.ExportFormatCsv), string(generated.ExportCompressionNone)
+	if params.Format != nil {
+		format = string(*params.Format)
+	}
+	if params.Compression != nil {
+		compression = string(*params.Compression)
+	}
+	if problem := validateExportOptions(format, compression); problem != nil {
+		return writeProblem(ctx, problem)
+	}
+
+	getEstateByEstateId := &repository.GetEstateByEstateIdInput{
+		Id: estateId.String(),
+	}
+	estate, err := s.Repository.GetEstateByEstateId(ctx.Request().Context(), getEstateByEstateId)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err getting estate by estate id", "error", err)
+		return writeInternalError(ctx)
+	}
+
+	if estate == nil {
+		return writeEstateNotFound(ctx)
+	}
+
+	return s.streamExport(ctx, estateId.String(), "estate-"+estateId.String(), format, compression)
+}
+
+// GetEstatesExport streams the trees of all estates as CSV or NDJSON, optionally compressed with gzip.
+func (s *Server) GetEstatesExport(ctx echo.Context, params generated.GetEstatesExportParams) error {
+	format, compression := string(generated.ExportFormatCsv), string(generated.ExportCompressionNone)
+	if params.Format != nil {
+		format = string(*params.Format)
+	}
+	if params.Compression != nil {
+		compression = string(*params.Compression)
+	}
+	if problem := validateExportOptions(format, compression); problem != nil {
+		return writeProblem(ctx, problem)
+	}
+
+	return s.streamExport(ctx, "", "estates", format, compression)
+}
+
+func validateExportOptions(format, compression string) *Problem {
+	switch format {
+	case export.FormatCSV, export.FormatNDJSON:
+	default:
+		return newParameterProblem("format", "oneof", "csv ndjson", "format must be one of csv or ndjson")
+	}
+	switch generated.ExportCompression(compression) {
+	case generated.ExportCompressionNone, generated.ExportCompressionGzip:
+	default:
+		return newParameterProblem("compression", "oneof", "none gzip", "compression must be one of none or gzip")
+	}
+	return nil
+}
+
+// streamExport writes the export rows to the response while they are read from the repository,
+// flushing the response every exportFlushEvery rows.
+// Once the status is sent, a failure can only be reported by aborting the connection, so that the
+// client sees a truncated response instead of a complete but partial file.
+func (s *Server) streamExport(ctx echo.Context, estateId, filename, format, compression string) error {
+	resp := ctx.Response()
+	filename += "." + format
+
+	var body io.Writer = resp
+	var gzipWriter *gzip.Writer
+	if compression == string(generated.ExportCompressionGzip) {
+		gzipWriter = gzip.NewWriter(resp)
+		body = gzipWriter
+		filename += ".gz"
+		resp.Header().Set(echo.HeaderContentType, "application/gzip")
+	} else {
+		resp.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	}
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+
+	rowWriter, err := export.NewRowWriter(body, format)
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err creating the export row writer", "error", err)
+		return writeInternalError(ctx)
+	}
+	flush := func() error {
+		if err := rowWriter.Flush(); err != nil {
+			return err
+		}
+		if gzipWriter != nil {
+			if err := gzipWriter.Flush(); err != nil {
+				return err
+			}
+		}
+		resp.Flush()
+		return nil
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	rowCount := 0
+	exportEstateTreesInput := &repository.ExportEstateTreesInput{
+		EstateId: estateId,
+		OnRow: func(row *repository.ExportRow) error {
+			if err := rowWriter.WriteRow(row); err != nil {
+				return err
+			}
+			rowCount++
+			if rowCount%exportFlushEvery == 0 {
+				return flush()
+			}
+			return nil
+		},
+	}
+	_, err = s.Repository.ExportEstateTrees(ctx.Request().Context(), exportEstateTreesInput)
+	if err == nil {
+		err = rowWriter.Flush()
+	}
+	if err == nil && gzipWriter != nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err exporting estate trees", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
 // CalculateDroneDistance calculates the total distance the drone needs to travel to cover the entire estate, taking into account the estate dimensions and the heights of the trees.
-// The function takes an input struct containing the estate details and the trees, and an optional maximum distance parameter.
-// It returns a struct containing the total distance, the total horizontal distance, the total vertical distance, and the last achievable coordinates for the drone.
+// It adapts the repository types to the planner package, which computes the plan with the scale factor of the configuration.
 // If the maximum distance is provided and the calculated total distance exceeds it, the function will return the last achievable coordinates instead of the full distance.
 func (s *Server) CalculateDroneDistance(input *repository.CalculateDroneDistanceInput, maxDistance *int) (*repository.CalculateDroneDistanceOutput, error) {
 	// Validate that input must not be nil. If nil, return error.
@@ -220,134 +1004,57 @@ func (s *Server) CalculateDroneDistance(input *repository.CalculateDroneDistance
 		return nil, errors.New("err CalculateDroneDistance: invalid input -- nothing to calculate drone distance")
 	}
 
-	if maxDistance == nil {
-		log.Info("maxDistance is nil, calculating the total drone distance.")
-	} else {
-		log.Info("maxDistance is NOT nil, calculating the max distance that the drone can travel.")
+	trees := make([]planner.Tree, len(input.Trees))
+	for i, t := range input.Trees {
+		trees[i] = planner.Tree{X: t.X, Y: t.Y, Height: t.Height}
+	}
+	estate := newPlannerEstate(input.Estate)
+	start := time.Now()
+	plan, err := planner.Compute(estate, trees, planner.Options{
+		ScaleFactor: s.Config.ScaleFactor,
+		MaxDistance: maxDistance,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("err CalculateDroneDistance: %w", err)
+	}
+	if s.PlanObserver != nil {
+		s.PlanObserver.ObservePlan(estate, plan, time.Since(start))
 	}
 
-	calculateDroneDistanceOutput := &repository.CalculateDroneDistanceOutput{}
-
-	//totalHorizontalDistance := (input.Estate.Length*input.Estate.Width - 1) * s.Config.ScaleFactor
-	totalHorizontalDistance := 0
+	return &repository.CalculateDroneDistanceOutput{
+		TotalDistance:             plan.TotalDistance,
+		TotalVerticalDistance:     plan.VerticalDistance,
+		TotalHorizontalDistance:   plan.HorizontalDistance,
+		LastAchievableXCoordinate: plan.Rest.X,
+		LastAchievableYCoordinate: plan.Rest.Y,
+	}, nil
+}
 
-	// Create estate and populate estate with 1 because 1 is the minimum height for the drone flying.
-	plantationGridArray := make([][]int, input.Estate.Width)
-	for i := range plantationGridArray {
-		plantationGridArray[i] = make([]int, input.Estate.Length)
-		for j := range plantationGridArray[i] {
-			plantationGridArray[i][j] = 1 // Populate with 1
-		}
+// traceDroneDistance calls CalculateDroneDistance within a span telling the dimensions of the estate and its
+// number of trees, to tell the time spent walking the grid apart from the queries of the request.
+func (s *Server) traceDroneDistance(ctx context.Context, input *repository.CalculateDroneDistanceInput, maxDistance *int) (*repository.CalculateDroneDistanceOutput, error) {
+	if s.Tracer == nil {
+		return s.CalculateDroneDistance(input, maxDistance)
 	}
-
-	// //Debugging purpose
-	// for _, row := range plantationGridArray {
-	// 	log.Print(row)
-	// }
-
-	// Populate the estate with the trees. Set also the height for the drone to patrol the tree.
-	for _, t := range input.Trees {
-		plantationGridArray[t.Y-1][t.X-1] = t.Height + 1
-	}
-
-	totalVerticalDistance := 0
-	var currentHeight, previousHeight int
-	var i, j int
-	// Iterate the Y axis of the estate (hence using input.Estate.Width - not input.Estate.Length)
-	for i = 0; i < input.Estate.Width; i++ {
-
-		// Determine if need to go east to west or west to east.
-		// The logic is to determine if the current row is even or odd, if even then go east to west, if odd then go west to east.
-		if i%2 == 0 {
-
-			// Now iterate the X axis of the estate (hence using input.Estate.Length).
-			// The direction of the iteration is east to west (because the row is even).
-			for j = 0; j < input.Estate.Length; j++ {
-				//log.Printf("i: %d, j: %d\n", i, j)
-				if j == 0 {
-					if i == 0 {
-						// Since this is the very first grid, no previous height which makes sense.
-						currentHeight = plantationGridArray[i][j]
-					} else {
-						currentHeight = plantationGridArray[i][j]
-						previousHeight = plantationGridArray[i-1][j]
-					}
-				} else {
-					currentHeight = plantationGridArray[i][j]
-					previousHeight = plantationGridArray[i][j-1]
-				}
-
-				// Calculate the difference of the height / vertical distance that the drone needs to travel.
-				increment := int(math.Abs(float64(currentHeight - previousHeight)))
-
-				//log.Printf("current coordinate: (%d, %d), current height: %d, previous coordinate: (%d, %d), previous height: %d, current row: %d\n", j+1, i+1, currentHeight, j, i+1, previousHeight, i+1)
-				//log.Printf("currentHeight: %d, previousHeight: %d, increment: %d\n", currentHeight, previousHeight, increment)
-
-				// Add the difference of the height to the total vertical distance.
-				totalVerticalDistance += increment
-
-				if !(i == 0 && j == 0) {
-					totalHorizontalDistance += s.Config.ScaleFactor
-				}
-
-				if maxDistance != nil && *maxDistance < (totalHorizontalDistance+totalVerticalDistance+currentHeight) {
-					return calculateDroneDistanceOutput, nil
-				}
-
-				calculateDroneDistanceOutput.LastAchievableXCoordinate = j + 1
-				calculateDroneDistanceOutput.LastAchievableYCoordinate = i + 1
-
-				if i == input.Estate.Width-1 && j == input.Estate.Length-1 {
-					totalVerticalDistance += plantationGridArray[i][j]
-				}
-
-				//log.Printf("totalVerticalDistance: %d", totalVerticalDistance)
-			}
-		} else {
-			// Since this is the odd row, the direction of the iteration is west to east.
-			// Hence the iteration starts from input.Estate.Length - 1 and not 0.
-			for j = input.Estate.Length - 1; j >= 0; j-- {
-				//log.Printf("i: %d, j: %d\n", i, j)
-
-				// Below condition determines if the current estate grid is the first one of the iteration.
-				// If it is, then we need to determine the previous height from *below* row instead.
-				// Previous row is used instead of previous column because we need to iterate from *south* to *north*
-				// since the iteration has reached the end of the grid in that X (horizontal) axis
-				if j == input.Estate.Length-1 {
-					currentHeight = plantationGridArray[i][j]
-					previousHeight = plantationGridArray[i-1][j] // use previous row instead of column
-
-				} else {
-					currentHeight = plantationGridArray[i][j]
-					previousHeight = plantationGridArray[i][j+1] // use next column instead of row
-				}
-
-				// Calculate the difference of the height / vertical distance that the drone needs to travel.
-				increment := int(math.Abs(float64(currentHeight - previousHeight)))
-				//log.Printf("current coordinate: (%d, %d), current height: %d, previous coordinate: (%d, %d), previous height: %d, current row: %d\n", j+1, i+1, currentHeight, j, i+1, previousHeight, i+1)
-				//log.Printf("currentHeight: %d, previousHeight: %d, increment: %d\n", currentHeight, previousHeight, increment)
-
-				totalVerticalDistance += increment
-				totalHorizontalDistance += s.Config.ScaleFactor
-
-				if maxDistance != nil && *maxDistance < (totalHorizontalDistance+totalVerticalDistance+currentHeight) {
-					return calculateDroneDistanceOutput, nil
-
-				}
-				calculateDroneDistanceOutput.LastAchievableXCoordinate = j + 1
-				calculateDroneDistanceOutput.LastAchievableYCoordinate = i + 1
-
-				// If reaching the last grid, don't forget to add the vertical distance of the last grid so that the drone can land.
-				if i == input.Estate.Width-1 && j == 0 {
-					totalVerticalDistance += plantationGridArray[i][j]
-				}
-			}
-			//log.Printf("totalVerticalDistance: %d", totalVerticalDistance)
-		}
+	_, span := s.Tracer.Start(ctx, "planner.Compute", trace.WithAttributes(
+		attribute.Int("estate.length", input.Estate.Length),
+		attribute.Int("estate.width", input.Estate.Width),
+		attribute.Int("estate.tree_count", len(input.Trees)),
+	))
+	defer span.End()
+	if maxDistance != nil {
+		span.SetAttributes(attribute.Int("drone.max_distance", *maxDistance))
+	}
+	output, err := s.CalculateDroneDistance(input, maxDistance)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
-	calculateDroneDistanceOutput.TotalDistance = totalVerticalDistance + totalHorizontalDistance
-	calculateDroneDistanceOutput.TotalHorizontalDistance = totalHorizontalDistance
-	calculateDroneDistanceOutput.TotalVerticalDistance = totalVerticalDistance
+	span.SetAttributes(attribute.Int("drone.total_distance", output.TotalDistance))
+	return output, nil
+}
 
-	return calculateDroneDistanceOutput, nil
+func newPlannerEstate(estate repository.Estate) planner.Estate {
+	return planner.Estate{Length: estate.Length, Width: estate.Width}
 }
@@ -2,20 +2,31 @@ package handler
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/validator"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/mock/gomock"
 )
 
@@ -58,8 +69,9 @@ func TestPostEstate(t *testing.T) {
 		require.NoError(t, err)
 
 		// Set up the mock repository response
+		estateId := uuid.New()
 		mockRepo.EXPECT().CreateEstate(gomock.Any(), gomock.Any()).Return(&repository.CreateEstateOutput{
-			Id: uuid.New().String(),
+			Id: estateId.String(),
 		}, nil)
 
 		// Create a new HTTP request
@@ -73,11 +85,12 @@ func TestPostEstate(t *testing.T) {
 		require.NoError(t, err)
 
 		// Check the response
-		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "/estate/"+estateId.String(), rec.Header().Get(echo.HeaderLocation))
 		var resp generated.EstateResponse
 		err = json.Unmarshal(rec.Body.Bytes(), &resp)
 		require.NoError(t, err)
-		assert.NotNil(t, resp.Id)
+		assert.Equal(t, estateId, resp.Id)
 	})
 
 	t.Run("Invalid request body - input as string", func(t *testing.T) {
@@ -97,10 +110,8 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		problem := assertProblem(t, rec, CodeMalformedBody)
+		assert.Equal(t, []Violation{{Field: "length", Rule: "type", Param: "number", Message: "length must be a JSON number"}}, problem.Violations)
 	})
 
 	t.Run("Invalid request body - input as zero", func(t *testing.T) {
@@ -120,10 +131,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeMalformedBody)
 	})
 
 	t.Run("Invalid request body - input as negative numbers", func(t *testing.T) {
@@ -143,10 +151,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - input out of bound", func(t *testing.T) {
@@ -166,10 +171,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - incomplete parameter", func(t *testing.T) {
@@ -189,10 +191,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - nil parameter", func(t *testing.T) {
@@ -212,10 +211,11 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		problem := assertProblem(t, rec, CodeValidationFailed)
+		assert.Equal(t, []Violation{
+			{Field: "length", Rule: "required", Message: "length is required"},
+			{Field: "width", Rule: "required", Message: "width is required"},
+		}, problem.Violations)
 	})
 
 	t.Run("Invalid request body - random parameter", func(t *testing.T) {
@@ -235,10 +235,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeMalformedBody)
 	})
 
 	t.Run("Unexcepted internal server error - create estate", func(t *testing.T) {
@@ -258,10 +255,7 @@ func TestPostEstate(t *testing.T) {
 
 		// Check the response
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeMalformedBody)
 	})
 
 	t.Run("Error creating estate", func(t *testing.T) {
@@ -287,10 +281,7 @@ func TestPostEstate(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Something happens in our end. Let us check.", errResp["error"])
+		assertProblem(t, rec, CodeInternalError)
 	})
 }
 
@@ -366,11 +357,39 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		err = server.PostEstateEstateIdTree(c, estateId)
 		require.NoError(t, err)
 
-		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "/estate/"+estateId.String()+"/tree/"+treeId.String(), rec.Header().Get(echo.HeaderLocation))
 		var resp generated.TreeResponse
 		err = json.Unmarshal(rec.Body.Bytes(), &resp)
 		require.NoError(t, err)
-		assert.NotNil(t, resp.Id)
+		assert.Equal(t, treeId, resp.Id)
+	})
+
+	t.Run("Unexpected internal server error - invalid tree UUID", func(t *testing.T) {
+		server, mockRepo, e := setupTestPostEstateEstateIdTree(t)
+		estateId := uuid.New()
+		requestBody := []byte(`{"x": 5, "y": 10, "height": 15}`)
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 30},
+		}, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), gomock.Any()).Return(&repository.IsTreeExistOutput{}, nil)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(&repository.CreateTreeOutput{
+			Id: "not-a-uuid",
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/estate/"+estateId.String()+"/tree", bytes.NewBuffer(requestBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.PostEstateEstateIdTree(c, estateId)
+		require.NoError(t, err)
+
+		// The client sent a valid request, the failure is on our end.
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assertProblem(t, rec, CodeInternalError)
+		assert.Empty(t, rec.Header().Get(echo.HeaderLocation))
 	})
 
 	t.Run("Invalid request - input as string", func(t *testing.T) {
@@ -387,10 +406,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeMalformedBody)
 	})
 
 	t.Run("Invalid request - input as 0", func(t *testing.T) {
@@ -407,10 +423,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request - input out of bound", func(t *testing.T) {
@@ -427,10 +440,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request - incomplete parameter", func(t *testing.T) {
@@ -447,10 +457,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request - out of bound height", func(t *testing.T) {
@@ -467,10 +474,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request - estate not found", func(t *testing.T) {
@@ -491,10 +495,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusNotFound, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Estate not found", errResp["error"])
+		assertProblem(t, rec, CodeEstateNotFound)
 	})
 
 	t.Run("Invalid request body - coordinates out of bound", func(t *testing.T) {
@@ -524,10 +525,9 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		problem := assertProblem(t, rec, CodePlotOutOfBounds)
+		assert.Equal(t, "Plot (200, 100) is outside of the estate of 20 x 30 plots.", problem.Detail)
+		assert.Equal(t, []string{"x", "y"}, []string{problem.Violations[0].Field, problem.Violations[1].Field})
 	})
 
 	t.Run("Invalid request body - tree already exists", func(t *testing.T) {
@@ -557,10 +557,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeTreeAlreadyExists)
 	})
 
 	t.Run("Invalid request body - negative height", func(t *testing.T) {
@@ -577,10 +574,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - negative coordinates", func(t *testing.T) {
@@ -597,10 +591,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - nil parameter", func(t *testing.T) {
@@ -617,10 +608,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeValidationFailed)
 	})
 
 	t.Run("Invalid request body - random parameter", func(t *testing.T) {
@@ -637,10 +625,7 @@ func TestPostEstateEstateIdTree(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Invalid request", errResp["error"])
+		assertProblem(t, rec, CodeMalformedBody)
 	})
 }
 
@@ -765,12 +750,339 @@ func TestGetEstateEstateIdDronePlan(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusNotFound, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
+		assertProblem(t, rec, CodeEstateNotFound)
+	})
+
+	t.Run("Unexpected internal server error - repository", func(t *testing.T) {
+		server, mockRepo, e := setupTestPostEstateEstateIdTree(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/drone-plan", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdDronePlan(c, estateId, generated.GetEstateEstateIdDronePlanParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		problem := assertProblem(t, rec, CodeInternalError)
+		assert.NotEqual(t, "Invalid request", problem.Detail)
+	})
+}
+
+// TestGetEstateEstateIdDronePlanMaxDistance tests the GetEstateEstateIdDronePlan handler function with max-distance.
+// It checks the budgets that ground the drone, stop it before the end of the plan or let it complete the plan,
+// on estates with an odd and an even number of rows, and the budgets which are rejected.
+func TestGetEstateEstateIdDronePlanMaxDistance(t *testing.T) {
+	// The drone climbs to 6 at (1,1) and the whole plan is 60.
+	oneRow := &repository.GetEstateTreesByEstateIdOutput{
+		Estate: repository.Estate{Length: 5, Width: 1},
+		Trees:  []repository.Tree{{X: 1, Y: 1, Height: 5}, {X: 2, Y: 1, Height: 2}, {X: 3, Y: 1, Height: 1}, {X: 4, Y: 1, Height: 5}, {X: 5, Y: 1, Height: 3}},
+	}
+	// The drone flies at 1 over (1,1), (2,1), (2,2) and (1,2), and the whole plan is 32.
+	twoRows := &repository.GetEstateTreesByEstateIdOutput{
+		Estate: repository.Estate{Length: 2, Width: 2},
+	}
+
+	testCases := []struct {
+		name            string
+		trees           *repository.GetEstateTreesByEstateIdOutput
+		maxDistance     int
+		expectedOutcome generated.DronePlanResponseOutcome
+		expectedRest    []int
+	}{
+		{name: "Grounded - budget of a single move", trees: oneRow, maxDistance: 1, expectedOutcome: generated.Grounded},
+		{name: "Grounded - budget below the climb and the landing at the first plot", trees: oneRow, maxDistance: 11, expectedOutcome: generated.Grounded},
+		{name: "Partial - budget of the climb and the landing at the first plot", trees: oneRow, maxDistance: 12, expectedOutcome: generated.Partial, expectedRest: []int{1, 1}},
+		{name: "Partial - budget one short of the plan", trees: oneRow, maxDistance: 59, expectedOutcome: generated.Partial, expectedRest: []int{4, 1}},
+		{name: "Complete - budget of the plan", trees: oneRow, maxDistance: 60, expectedOutcome: generated.Complete, expectedRest: []int{5, 1}},
+		{name: "Complete - budget beyond the plan", trees: oneRow, maxDistance: 1000000000, expectedOutcome: generated.Complete, expectedRest: []int{5, 1}},
+		{name: "Grounded - even number of rows", trees: twoRows, maxDistance: 1, expectedOutcome: generated.Grounded},
+		{name: "Partial - even number of rows", trees: twoRows, maxDistance: 31, expectedOutcome: generated.Partial, expectedRest: []int{2, 2}},
+		{name: "Complete - even number of rows lands on the first column", trees: twoRows, maxDistance: 32, expectedOutcome: generated.Complete, expectedRest: []int{1, 2}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run("Valid request - "+tc.name, func(t *testing.T) {
+			server, mockRepo, e := setupTestGetEstateEstateIdDronePlan(t)
+			estateId := uuid.New()
+
+			mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(tc.trees, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/drone-plan", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := server.GetEstateEstateIdDronePlan(c, estateId, generated.GetEstateEstateIdDronePlanParams{MaxDistance: intPointer(tc.maxDistance)})
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var resp generated.DronePlanResponse
+			err = json.Unmarshal(rec.Body.Bytes(), &resp)
+			require.NoError(t, err)
+			assert.Equal(t, tc.maxDistance, resp.Distance)
+			require.NotNil(t, resp.Outcome)
+			assert.Equal(t, tc.expectedOutcome, *resp.Outcome)
+			if tc.expectedRest == nil {
+				assert.Nil(t, resp.Rest)
+				return
+			}
+			require.NotNil(t, resp.Rest)
+			assert.Equal(t, tc.expectedRest, []int{*resp.Rest.X, *resp.Rest.Y})
+		})
+	}
+
+	for _, maxDistance := range []int{0, -1, 1000000001} {
+		maxDistance := maxDistance
+		t.Run(fmt.Sprintf("Invalid max distance %d", maxDistance), func(t *testing.T) {
+			server, _, e := setupTestGetEstateEstateIdDronePlan(t)
+			estateId := uuid.New()
+
+			req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/drone-plan", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := server.GetEstateEstateIdDronePlan(c, estateId, generated.GetEstateEstateIdDronePlanParams{MaxDistance: intPointer(maxDistance)})
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			problem := assertProblem(t, rec, CodeInvalidParameter)
+			require.Len(t, problem.Violations, 1)
+			assert.Equal(t, Violation{Field: "max-distance", Rule: "range", Param: "1 1000000000", Message: "max-distance must be between 1 and 1000000000"}, problem.Violations[0])
+		})
+	}
+}
+
+// TestGetEstateEstateIdDronePlanCache tests the GetEstateEstateIdDronePlan handler function with the plan cache.
+// It checks that a plan is computed once per revision of the estate and per planner parameters.
+func TestGetEstateEstateIdDronePlanCache(t *testing.T) {
+	trees := &repository.GetEstateTreesByEstateIdOutput{
+		Estate: repository.Estate{Length: 5, Width: 1, Revision: 1},
+		Trees:  []repository.Tree{{X: 1, Y: 1, Height: 5}, {X: 2, Y: 1, Height: 2}, {X: 3, Y: 1, Height: 1}, {X: 4, Y: 1, Height: 5}, {X: 5, Y: 1, Height: 3}},
+	}
+
+	getDronePlan := func(t *testing.T, server *Server, e *echo.Echo, estateId uuid.UUID, params generated.GetEstateEstateIdDronePlanParams) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/drone-plan", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdDronePlan(c, estateId, params)
+		require.NoError(t, err)
+		return rec
+	}
+
+	t.Run("Valid request - plan computed once per revision", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.Config.ScaleFactor = 10
+		server.PlanCache = plancache.NewCache(plancache.NewCacheOptions{})
+		estateId := uuid.New()
+
+		gomock.InOrder(
+			mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{Estate: trees.Estate}, nil).Times(2),
+			mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{Estate: repository.Estate{Length: 5, Width: 1, Revision: 2}}, nil),
+		)
+		mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(trees, nil).Times(2)
+
+		for i := 0; i < 3; i++ {
+			rec := getDronePlan(t, server, e, estateId, generated.GetEstateEstateIdDronePlanParams{})
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"distance":60}`, rec.Body.String())
+		}
+		assert.Equal(t, plancache.Stats{Hits: 1, Misses: 2, Size: 1}, server.PlanCache.Stats())
+	})
+
+	t.Run("Valid request - plans cached per max distance", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.Config.ScaleFactor = 10
+		server.PlanCache = plancache.NewCache(plancache.NewCacheOptions{})
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{Estate: trees.Estate}, nil).Times(3)
+		mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(trees, nil).Times(2)
+
+		getDronePlan(t, server, e, estateId, generated.GetEstateEstateIdDronePlanParams{})
+		rec := getDronePlan(t, server, e, estateId, generated.GetEstateEstateIdDronePlanParams{MaxDistance: intPointer(30)})
+		assert.JSONEq(t, `{"distance":30,"outcome":"partial","rest":{"x":2,"y":1}}`, rec.Body.String())
+		rec = getDronePlan(t, server, e, estateId, generated.GetEstateEstateIdDronePlanParams{MaxDistance: intPointer(30)})
+		assert.JSONEq(t, `{"distance":30,"outcome":"partial","rest":{"x":2,"y":1}}`, rec.Body.String())
+	})
+
+	t.Run("Invalid request - estate not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.PlanCache = plancache.NewCache(plancache.NewCacheOptions{})
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		rec := getDronePlan(t, server, e, uuid.New(), generated.GetEstateEstateIdDronePlanParams{})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// TestGetEstateEstateId tests the GetEstateEstateId handler function.
+// It checks the ETag and Last-Modified headers, the conditional requests and the error scenarios.
+func TestGetEstateEstateId(t *testing.T) {
+	lastModified := time.Date(2024, time.March, 4, 10, 15, 0, 0, time.UTC)
+
+	t.Run("Valid request - ETag and Last-Modified are set", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), &repository.GetEstateByEstateIdInput{Id: estateId.String()}).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 10, Revision: 3, LastModified: lastModified},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateId(c, estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"`+estateId.String()+`","length":20,"width":10,"updated_at":"2024-03-04T10:15:00Z"}`, rec.Body.String())
+		assert.Equal(t, contentETag(rec.Body.Bytes()), rec.Header().Get("ETag"))
+		assert.Equal(t, "Mon, 04 Mar 2024 10:15:00 GMT", rec.Header().Get("Last-Modified"))
+	})
+
+	t.Run("Valid request - not modified", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		estate := &repository.GetEstateByEstateIdOutput{Estate: repository.Estate{Length: 20, Width: 10, LastModified: lastModified}}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil).Times(3)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateId(e.NewContext(req, rec), estateId)
+		require.NoError(t, err)
+		etag := rec.Header().Get("ETag")
+
+		req = httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		err = server.GetEstateEstateId(e.NewContext(req, rec), estateId)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+		assert.Equal(t, etag, rec.Header().Get("ETag"))
+
+		req = httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		req.Header.Set("If-Modified-Since", "Mon, 04 Mar 2024 10:15:00 GMT")
+		rec = httptest.NewRecorder()
+		err = server.GetEstateEstateId(e.NewContext(req, rec), estateId)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("Invalid request - estate not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateId(e.NewContext(req, rec), estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Internal server error - repository error", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String(), nil)
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateId(e.NewContext(req, rec), estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+// TestConditionalGet tests the conditional requests on the stats and drone plan endpoints.
+// The ETag changes with the content, e.g. when a tree is added, and the Last-Modified header follows
+// the newest tree.
+func TestConditionalGet(t *testing.T) {
+	lastModified := time.Date(2024, time.March, 4, 10, 15, 0, 0, time.UTC)
+
+	t.Run("Stats - ETag changes with the content", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 10, LastModified: lastModified},
+		}, nil).Times(3)
+		gomock.InOrder(
+			mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{Count: 1, Max: 3, Min: 3, Median: 3}, nil).Times(2),
+			mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{Count: 2, Max: 5, Min: 3, Median: 4}, nil),
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats", nil)
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateIdStats(e.NewContext(req, rec), estateId, generated.GetEstateEstateIdStatsParams{})
+		require.NoError(t, err)
+		assert.Equal(t, "Mon, 04 Mar 2024 10:15:00 GMT", rec.Header().Get("Last-Modified"))
+		etag := rec.Header().Get("ETag")
+
+		for _, expectedCode := range []int{http.StatusNotModified, http.StatusOK} {
+			req = httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats", nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			err = server.GetEstateEstateIdStats(e.NewContext(req, rec), estateId, generated.GetEstateEstateIdStatsParams{})
+			require.NoError(t, err)
+			assert.Equal(t, expectedCode, rec.Code)
+		}
+		assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Stats - no Last-Modified for a series up to now", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		interval := generated.GetEstateEstateIdStatsParamsIntervalMonth
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 10, LastModified: lastModified},
+		}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsSeriesByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsSeriesByEstateIdOutput{}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?interval=month", nil)
+		req.Header.Set("If-Modified-Since", "Mon, 04 Mar 2024 10:15:00 GMT")
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateIdStats(e.NewContext(req, rec), estateId, generated.GetEstateEstateIdStatsParams{Interval: &interval})
 		require.NoError(t, err)
-		assert.Equal(t, "Estate not found", errResp["error"])
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Last-Modified"))
+		assert.NotEmpty(t, rec.Header().Get("ETag"))
 	})
 
+	t.Run("Drone plan - not modified", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.Config.ScaleFactor = 10
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateTreesByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateTreesByEstateIdOutput{
+			Estate: repository.Estate{Length: 5, Width: 1, LastModified: lastModified},
+			Trees:  []repository.Tree{{X: 1, Y: 1, Height: 5}},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/drone-plan", nil)
+		req.Header.Set("If-None-Match", contentETag([]byte(`{"distance":52}`)))
+		rec := httptest.NewRecorder()
+		err := server.GetEstateEstateIdDronePlan(e.NewContext(req, rec), estateId, generated.GetEstateEstateIdDronePlanParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Equal(t, "Mon, 04 Mar 2024 10:15:00 GMT", rec.Header().Get("Last-Modified"))
+	})
 }
 
 // TestGetEstateEstateIdStats tests the GetEstateEstateIdStats handler function.
@@ -801,7 +1113,7 @@ func TestGetEstateEstateIdStats(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := server.GetEstateEstateIdStats(c, estateId)
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{})
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusOK, rec.Code)
@@ -828,14 +1140,11 @@ func TestGetEstateEstateIdStats(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := server.GetEstateEstateIdStats(c, estateId)
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{})
 		require.NoError(t, err)
 
 		assert.Equal(t, http.StatusNotFound, rec.Code)
-		var errResp map[string]string
-		err = json.Unmarshal(rec.Body.Bytes(), &errResp)
-		require.NoError(t, err)
-		assert.Equal(t, "Estate not found", errResp["error"])
+		assertProblem(t, rec, CodeEstateNotFound)
 	})
 
 }
@@ -843,6 +1152,28 @@ func TestGetEstateEstateIdStats(t *testing.T) {
 func TestCalculateDroneDistance(t *testing.T) {
 	t.Parallel()
 
+	t.Run("Traced - span tells the estate and the plan", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		server := &Server{Config: &config.Config{ScaleFactor: 10}, Tracer: provider.Tracer("test")}
+		input := &repository.CalculateDroneDistanceInput{
+			Estate: repository.Estate{Length: 5, Width: 4},
+			Trees:  []repository.Tree{{X: 3, Y: 3, Height: 5}, {X: 1, Y: 2, Height: 7}},
+		}
+		calculateDroneDistanceOutput, err := server.traceDroneDistance(context.Background(), input, nil)
+		require.NoError(t, err)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "planner.Compute", spans[0].Name())
+		assert.ElementsMatch(t, []attribute.KeyValue{
+			attribute.Int("estate.length", 5),
+			attribute.Int("estate.width", 4),
+			attribute.Int("estate.tree_count", 2),
+			attribute.Int("drone.total_distance", calculateDroneDistanceOutput.TotalDistance),
+		}, spans[0].Attributes())
+	})
+
 	t.Run("Invalid input - nil", func(t *testing.T) {
 		server := &Server{Config: &config.Config{ScaleFactor: 10}}
 		calculateDroneDistanceOutput, err := server.CalculateDroneDistance(nil, nil)
@@ -973,3 +1304,884 @@ func TestCalculateDroneDistance(t *testing.T) {
 	})
 
 }
+
+// setupTestServer sets up a test environment for the handler functions that only need a Server.
+// It creates a new mock repository and a new Server instance with a job manager that is not started,
+// so that jobs are only queued.
+func setupTestServer(t *testing.T) (*Server, *repository.MockRepositoryInterface, *echo.Echo) {
+	t.Parallel()
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := repository.NewMockRepositoryInterface(ctrl)
+
+	server := &Server{
+		Repository: mockRepo,
+		Config:     &config.Config{},
+		JobManager: job.NewManager(job.NewManagerOptions{Repository: mockRepo}),
+	}
+
+	return server, mockRepo, echo.New()
+}
+
+// TestPostEstateEstateIdTreeImport tests the PostEstateEstateIdTreeImport handler function.
+// It checks that a valid file creates a queued job, and that unsupported or malformed files and
+// unknown estates are rejected before any job is created.
+func TestPostEstateEstateIdTreeImport(t *testing.T) {
+
+	t.Run("Valid request - CSV file creates a queued job", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		jobId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), &repository.GetEstateByEstateIdInput{
+			Id: estateId.String(),
+		}).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 10, Width: 10},
+		}, nil)
+		mockRepo.EXPECT().CreateJob(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.CreateJobInput) (*repository.CreateJobOutput, error) {
+				assert.Equal(t, repository.JobKindTreeImport, input.Kind)
+				assert.Equal(t, job.ContentTypeCSV, input.ContentType)
+				return &repository.CreateJobOutput{Job: repository.Job{
+					Id:       jobId.String(),
+					Kind:     input.Kind,
+					State:    repository.JobStateQueued,
+					EstateId: input.EstateId,
+				}}, nil
+			})
+
+		req := httptest.NewRequest(http.MethodPost, "/estate/"+estateId.String()+"/tree/import", bytes.NewBufferString("x,y,height\n1,1,5\n"))
+		req.Header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.PostEstateEstateIdTreeImport(c, estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "/jobs/"+jobId.String(), rec.Header().Get(echo.HeaderLocation))
+		var resp generated.JobResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, jobId, resp.Id)
+		assert.Equal(t, generated.Queued, resp.State)
+	})
+
+	t.Run("Invalid request - unsupported content type", func(t *testing.T) {
+		server, _, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		req := httptest.NewRequest(http.MethodPost, "/estate/"+estateId.String()+"/tree/import", bytes.NewBufferString(`[]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.PostEstateEstateIdTreeImport(c, estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("Invalid request - CSV without header", func(t *testing.T) {
+		server, _, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		req := httptest.NewRequest(http.MethodPost, "/estate/"+estateId.String()+"/tree/import", bytes.NewBufferString("1,1,5\n"))
+		req.Header.Set(echo.HeaderContentType, "text/csv")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.PostEstateEstateIdTreeImport(c, estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assertProblem(t, rec, CodeMalformedBody)
+	})
+
+	t.Run("Invalid request - estate not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/estate/"+estateId.String()+"/tree/import", bytes.NewBufferString("{\"x\":1,\"y\":1,\"height\":5}\n"))
+		req.Header.Set(echo.HeaderContentType, "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.PostEstateEstateIdTreeImport(c, estateId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assertProblem(t, rec, CodeEstateNotFound)
+	})
+}
+
+// TestGetJobsJobId tests the GetJobsJobId handler function.
+// It checks that the progress is computed from the counters and that unknown jobs return 404.
+func TestGetJobsJobId(t *testing.T) {
+
+	t.Run("Valid request - running job", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		jobId := uuid.New()
+
+		mockRepo.EXPECT().GetJobByJobId(gomock.Any(), &repository.GetJobByJobIdInput{Id: jobId.String()}).Return(&repository.GetJobByJobIdOutput{
+			Job: repository.Job{
+				Id:            jobId.String(),
+				Kind:          repository.JobKindTreeImport,
+				State:         repository.JobStateRunning,
+				EstateId:      uuid.New().String(),
+				TotalRows:     200,
+				ProcessedRows: 50,
+				SucceededRows: 49,
+				FailedRows:    1,
+				ErrorSamples:  []repository.JobError{{Row: 7, Message: "a tree already exists at plot (1, 1)"}},
+			},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobId.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetJobsJobId(c, jobId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp generated.JobResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, generated.Running, resp.State)
+		assert.Equal(t, float32(0.25), resp.Progress)
+		assert.Equal(t, 49, resp.Succeeded)
+		assert.Equal(t, []generated.JobError{{Row: 7, Message: "a tree already exists at plot (1, 1)"}}, resp.Errors)
+	})
+
+	t.Run("Job not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		jobId := uuid.New()
+
+		mockRepo.EXPECT().GetJobByJobId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobId.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetJobsJobId(c, jobId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// TestDeleteJobsJobId tests the DeleteJobsJobId handler function.
+func TestDeleteJobsJobId(t *testing.T) {
+
+	t.Run("Valid request - queued job is cancelled", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		jobId := uuid.New()
+
+		mockRepo.EXPECT().RequestJobCancellation(gomock.Any(), &repository.RequestJobCancellationInput{Id: jobId.String()}).Return(&repository.RequestJobCancellationOutput{
+			Job: repository.Job{
+				Id:              jobId.String(),
+				Kind:            repository.JobKindTreeImport,
+				State:           repository.JobStateCancelled,
+				EstateId:        uuid.New().String(),
+				CancelRequested: true,
+			},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodDelete, "/jobs/"+jobId.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.DeleteJobsJobId(c, jobId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		var resp generated.JobResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, generated.Cancelled, resp.State)
+	})
+
+	t.Run("Job not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		jobId := uuid.New()
+
+		mockRepo.EXPECT().RequestJobCancellation(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodDelete, "/jobs/"+jobId.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.DeleteJobsJobId(c, jobId)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// mockExportRows makes the mock repository hand the given rows to the export callback.
+func mockExportRows(mockRepo *repository.MockRepositoryInterface, estateId string, rows []repository.ExportRow) {
+	mockRepo.EXPECT().ExportEstateTrees(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *repository.ExportEstateTreesInput) (*repository.ExportEstateTreesOutput, error) {
+			if input.EstateId != estateId {
+				return nil, errors.New("unexpected estate id")
+			}
+			for i := range rows {
+				if err := input.OnRow(&rows[i]); err != nil {
+					return nil, err
+				}
+			}
+			return &repository.ExportEstateTreesOutput{Count: len(rows)}, nil
+		})
+}
+
+// TestGetEstateEstateIdExport tests the GetEstateEstateIdExport handler function.
+// It checks the CSV output, the gzip compression of NDJSON output and the rejection of
+// unknown formats and estates.
+func TestGetEstateEstateIdExport(t *testing.T) {
+	rows := []repository.ExportRow{
+		{EstateId: "e1", Length: 5, Width: 1, TreeId: "t1", X: 2, Y: 1, Height: 10, TreeCreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	t.Run("Valid request - CSV", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 5, Width: 1},
+		}, nil)
+		mockExportRows(mockRepo, estateId.String(), rows)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/export", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdExport(c, estateId, generated.GetEstateEstateIdExportParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv", rec.Header().Get(echo.HeaderContentType))
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "estate-"+estateId.String()+".csv")
+		assert.Equal(t, "estate_id,estate_length,estate_width,tree_id,x,y,height,created_at\ne1,5,1,t1,2,1,10,2024-05-01T00:00:00Z\n", rec.Body.String())
+	})
+
+	t.Run("Valid request - gzip compressed NDJSON", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		format := generated.GetEstateEstateIdExportParamsFormatNdjson
+		compression := generated.GetEstateEstateIdExportParamsCompressionGzip
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 5, Width: 1},
+		}, nil)
+		mockExportRows(mockRepo, estateId.String(), rows)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/export?format=ndjson&compression=gzip", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdExport(c, estateId, generated.GetEstateEstateIdExportParams{Format: &format, Compression: &compression})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/gzip", rec.Header().Get(echo.HeaderContentType))
+		gzipReader, err := gzip.NewReader(rec.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gzipReader)
+		require.NoError(t, err)
+		var row map[string]any
+		err = json.Unmarshal(body, &row)
+		require.NoError(t, err)
+		assert.Equal(t, "t1", row["tree_id"])
+		assert.Equal(t, float64(10), row["height"])
+	})
+
+	t.Run("Invalid request - unknown format", func(t *testing.T) {
+		server, _, e := setupTestServer(t)
+		estateId := uuid.New()
+		format := generated.GetEstateEstateIdExportParamsFormat("parquet")
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/export?format=parquet", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdExport(c, estateId, generated.GetEstateEstateIdExportParams{Format: &format})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Estate not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/export", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdExport(c, estateId, generated.GetEstateEstateIdExportParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// TestGetEstatesExport tests that the GetEstatesExport handler function exports all estates,
+// including the estates without trees.
+func TestGetEstatesExport(t *testing.T) {
+	server, mockRepo, e := setupTestServer(t)
+	format := generated.Ndjson
+
+	mockExportRows(mockRepo, "", []repository.ExportRow{
+		{EstateId: "e1", Length: 5, Width: 1, TreeId: "t1", X: 2, Y: 1, Height: 10},
+		{EstateId: "e2", Length: 3, Width: 3},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/estates/export?format=ndjson", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := server.GetEstatesExport(c, generated.GetEstatesExportParams{Format: &format})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"tree_id":null`)
+}
+
+// TestGetEstateEstateIdStatsSections tests the opt-in sections of the GetEstateEstateIdStats handler function.
+// It checks that the sections are only returned when requested, that the density uses the scale factor
+// and that out of range parameters are rejected.
+func TestGetEstateEstateIdStatsSections(t *testing.T) {
+
+	t.Run("Valid request - all sections", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.Config.ScaleFactor = 10
+		estateId := uuid.New()
+		include := []generated.GetEstateEstateIdStatsParamsInclude{generated.GetEstateEstateIdStatsParamsIncludeDistribution, generated.GetEstateEstateIdStatsParamsIncludeDensity}
+		percentiles := []float64{25, 90}
+		histogramBuckets := 3
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 10},
+		}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), &repository.GetEstateStatsByEstateIdInput{
+			EstateId:            estateId.String(),
+			IncludeDistribution: true,
+			Percentiles:         []float64{0.25, 0.9},
+			HistogramBuckets:    3,
+		}).Return(&repository.GetEstateStatsByEstateIdOutput{
+			Count:       50,
+			Max:         30,
+			Min:         1,
+			Median:      12,
+			Mean:        13.5,
+			StdDev:      4,
+			Percentiles: []float64{8, 25.5},
+			Histogram:   []repository.HistogramBucket{{Min: 1, Max: 10, Count: 20}, {Min: 11, Max: 20, Count: 20}, {Min: 21, Max: 30, Count: 10}},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?include=distribution,density&percentiles=25,90&histogram_buckets=3", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{
+			Include:          &include,
+			Percentiles:      &percentiles,
+			HistogramBuckets: &histogramBuckets,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp generated.EstateStatsResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.NotNil(t, resp.Distribution)
+		assert.Equal(t, 13.5, resp.Distribution.Mean)
+		assert.Equal(t, []generated.EstateStatsPercentile{{Percentile: 25, Value: 8}, {Percentile: 90, Value: 25.5}}, resp.Distribution.Percentiles)
+		require.NotNil(t, resp.Histogram)
+		assert.Len(t, *resp.Histogram, 3)
+		require.NotNil(t, resp.Density)
+		assert.Equal(t, generated.EstateStatsDensity{
+			Plots:           200,
+			AreaHectares:    2,
+			TreesPerPlot:    0.25,
+			TreesPerHectare: 25,
+			EmptyPlotShare:  0.75,
+		}, *resp.Density)
+	})
+
+	t.Run("Valid request - no section by default", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 20, Width: 10},
+		}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), &repository.GetEstateStatsByEstateIdInput{
+			EstateId: estateId.String(),
+		}).Return(&repository.GetEstateStatsByEstateIdOutput{Count: 1, Max: 3, Min: 3, Median: 3}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"count":1,"max":3,"min":3,"median":3}`, rec.Body.String())
+	})
+
+	t.Run("Invalid request - percentile out of range", func(t *testing.T) {
+		server, _, e := setupTestServer(t)
+		estateId := uuid.New()
+		percentiles := []float64{50, 101}
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?percentiles=50,101", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{Percentiles: &percentiles})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Invalid request - too many histogram buckets", func(t *testing.T) {
+		server, _, e := setupTestServer(t)
+		estateId := uuid.New()
+		histogramBuckets := 31
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?histogram_buckets=31", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{HistogramBuckets: &histogramBuckets})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+// TestGetEstateEstateIdStatsSeries tests the as_of, interval and since parameters of the
+// GetEstateEstateIdStats handler function.
+func TestGetEstateEstateIdStatsSeries(t *testing.T) {
+	asOf := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	since := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Valid request - as_of only", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), &repository.GetEstateStatsByEstateIdInput{
+			EstateId: estateId.String(),
+			AsOf:     &asOf,
+		}).Return(&repository.GetEstateStatsByEstateIdOutput{Count: 1, Max: 3, Min: 3, Median: 3}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?as_of=2024-03-10T12:00:00Z", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{AsOf: &asOf})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"count":1,"max":3,"min":3,"median":3}`, rec.Body.String())
+	})
+
+	t.Run("Valid request - monthly series", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		interval := generated.GetEstateEstateIdStatsParamsIntervalMonth
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{Count: 3, Max: 9, Min: 3, Median: 5}, nil)
+		mockRepo.EXPECT().GetEstateStatsSeriesByEstateId(gomock.Any(), &repository.GetEstateStatsSeriesByEstateIdInput{
+			EstateId:  estateId.String(),
+			Interval:  repository.StatsIntervalMonth,
+			AsOf:      asOf,
+			Since:     &since,
+			MaxPoints: maxStatsSeriesPoints + 1,
+		}).Return(&repository.GetEstateStatsSeriesByEstateIdOutput{Points: []repository.EstateStatsPoint{
+			{PeriodStart: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), PeriodEnd: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), NewTrees: 2, Count: 2, Median: 4, Mean: 4},
+			{PeriodStart: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), PeriodEnd: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), Count: 2, Median: 4, Mean: 4},
+			{PeriodStart: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), PeriodEnd: asOf, NewTrees: 1, Count: 3, Median: 5, Mean: 17.0 / 3},
+		}}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?as_of=2024-03-10T12:00:00Z&interval=month&since=2024-01-15T00:00:00Z", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{AsOf: &asOf, Interval: &interval, Since: &since})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp generated.EstateStatsResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.NotNil(t, resp.Series)
+		assert.Equal(t, generated.EstateStatsSeriesIntervalMonth, resp.Series.Interval)
+		require.Len(t, resp.Series.Points, 3)
+		assert.Equal(t, 0, resp.Series.Points[1].NewTrees)
+		assert.Equal(t, 3, resp.Series.Points[2].Count)
+		assert.True(t, asOf.Equal(resp.Series.Points[2].PeriodEnd))
+	})
+
+	t.Run("Valid request - series up to now by default", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		interval := generated.GetEstateEstateIdStatsParamsIntervalYear
+		before := time.Now()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsSeriesByEstateId(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.GetEstateStatsSeriesByEstateIdInput) (*repository.GetEstateStatsSeriesByEstateIdOutput, error) {
+				assert.False(t, input.AsOf.Before(before))
+				assert.Nil(t, input.Since)
+				return &repository.GetEstateStatsSeriesByEstateIdOutput{}, nil
+			})
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?interval=year", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{Interval: &interval})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"count":0,"max":0,"min":0,"median":0,"series":{"interval":"year","points":[]}}`, rec.Body.String())
+	})
+
+	t.Run("Invalid request - too many points", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+		interval := generated.GetEstateEstateIdStatsParamsIntervalDay
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsByEstateIdOutput{}, nil)
+		mockRepo.EXPECT().GetEstateStatsSeriesByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateStatsSeriesByEstateIdOutput{
+			Points: make([]repository.EstateStatsPoint, maxStatsSeriesPoints+1),
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats?interval=day", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStats(c, estateId, generated.GetEstateEstateIdStatsParams{Interval: &interval})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	invalidTestCases := []struct {
+		name   string
+		params generated.GetEstateEstateIdStatsParams
+	}{
+		{name: "unknown interval", params: generated.GetEstateEstateIdStatsParams{Interval: intervalPointer("decade")}},
+		{name: "since after as_of", params: generated.GetEstateEstateIdStatsParams{AsOf: &since, Since: &asOf, Interval: intervalPointer(generated.GetEstateEstateIdStatsParamsIntervalDay)}},
+		{name: "since without interval", params: generated.GetEstateEstateIdStatsParams{Since: &since}},
+	}
+	for _, tc := range invalidTestCases {
+		tc := tc
+		t.Run("Invalid request - "+tc.name, func(t *testing.T) {
+			server, _, e := setupTestServer(t)
+			estateId := uuid.New()
+
+			req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := server.GetEstateEstateIdStats(c, estateId, tc.params)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
+// TestGetEstatesStats tests the GetEstatesStats handler function.
+// It checks the translation of the filters and the ranking options, the conversion of the plots into
+// hectares and the validation of the parameters.
+func TestGetEstatesStats(t *testing.T) {
+	t.Run("Valid request - default options", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		server.Config.ScaleFactor = 10
+		topEstateId, bottomEstateId := uuid.New(), uuid.New()
+
+		mockRepo.EXPECT().GetPortfolioStats(gomock.Any(), &repository.GetPortfolioStatsInput{
+			Percentiles: []float64{0.1, 0.25, 0.75, 0.9},
+			RankBy:      repository.PortfolioRankByMedian,
+			RankLimit:   defaultPortfolioRankLimit,
+		}).Return(&repository.GetPortfolioStatsOutput{
+			Estates:     2,
+			Plots:       400,
+			Count:       100,
+			Max:         30,
+			Min:         1,
+			Median:      12,
+			Mean:        13,
+			StdDev:      5,
+			Percentiles: []float64{4, 8, 18, 24},
+			Top:         []repository.EstateRank{{EstateId: topEstateId.String(), Length: 20, Width: 10, Count: 80, Median: 15}, {EstateId: bottomEstateId.String(), Length: 20, Width: 10, Count: 20, Median: 6}},
+			Bottom:      []repository.EstateRank{{EstateId: bottomEstateId.String(), Length: 20, Width: 10, Count: 20, Median: 6}, {EstateId: topEstateId.String(), Length: 20, Width: 10, Count: 80, Median: 15}},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estates/stats", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstatesStats(c, generated.GetEstatesStatsParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp generated.PortfolioStatsResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, 2, resp.Estates)
+		assert.Equal(t, 4.0, resp.AreaHectares)
+		assert.Equal(t, 25.0, resp.TreesPerHectare)
+		assert.Equal(t, generated.PortfolioStatsResponseRankByMedian, resp.RankBy)
+		assert.Equal(t, []generated.EstateStatsPercentile{{Percentile: 10, Value: 4}, {Percentile: 25, Value: 8}, {Percentile: 75, Value: 18}, {Percentile: 90, Value: 24}}, resp.Distribution.Percentiles)
+		require.Len(t, resp.Top, 2)
+		assert.Equal(t, topEstateId, resp.Top[0].EstateId)
+		assert.Equal(t, 40.0, resp.Top[0].TreesPerHectare)
+		require.Len(t, resp.Bottom, 2)
+		assert.Equal(t, bottomEstateId, resp.Bottom[0].EstateId)
+	})
+
+	t.Run("Valid request - filters and ranking by density", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		minLength, maxWidth, rankLimit := 10, 50, 3
+		createdAfter := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+		percentiles := []float64{50}
+		rankBy := generated.Density
+
+		mockRepo.EXPECT().GetPortfolioStats(gomock.Any(), &repository.GetPortfolioStatsInput{
+			Filter: repository.EstateFilter{
+				MinLength:    &minLength,
+				MaxWidth:     &maxWidth,
+				CreatedAfter: &createdAfter,
+			},
+			Percentiles: []float64{0.5},
+			RankBy:      repository.PortfolioRankByDensity,
+			RankLimit:   3,
+		}).Return(&repository.GetPortfolioStatsOutput{Percentiles: []float64{0}}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estates/stats?min_length=10&max_width=50&created_after=2024-01-01T00:00:00Z&percentiles=50&rank_by=density&rank_limit=3", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstatesStats(c, generated.GetEstatesStatsParams{
+			MinLength:    &minLength,
+			MaxWidth:     &maxWidth,
+			CreatedAfter: &createdAfter,
+			Percentiles:  &percentiles,
+			RankBy:       &rankBy,
+			RankLimit:    &rankLimit,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp generated.PortfolioStatsResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, generated.PortfolioStatsResponseRankByDensity, resp.RankBy)
+		assert.Equal(t, 0.0, resp.TreesPerHectare)
+		assert.Empty(t, resp.Top)
+		assert.Empty(t, resp.Bottom)
+	})
+
+	t.Run("Internal server error - repository error", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+
+		mockRepo.EXPECT().GetPortfolioStats(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		req := httptest.NewRequest(http.MethodGet, "/estates/stats", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstatesStats(c, generated.GetEstatesStatsParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	createdAfter := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	invalidTestCases := []struct {
+		name   string
+		params generated.GetEstatesStatsParams
+	}{
+		{name: "min_length above max_length", params: generated.GetEstatesStatsParams{MinLength: intPointer(20), MaxLength: intPointer(10)}},
+		{name: "min_width above max_width", params: generated.GetEstatesStatsParams{MinWidth: intPointer(20), MaxWidth: intPointer(10)}},
+		{name: "empty creation range", params: generated.GetEstatesStatsParams{CreatedAfter: &createdAfter, CreatedBefore: &createdAfter}},
+		{name: "percentile out of range", params: generated.GetEstatesStatsParams{Percentiles: &[]float64{-1}}},
+		{name: "rank_limit out of range", params: generated.GetEstatesStatsParams{RankLimit: intPointer(101)}},
+	}
+	for _, tc := range invalidTestCases {
+		tc := tc
+		t.Run("Invalid request - "+tc.name, func(t *testing.T) {
+			server, _, e := setupTestServer(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/estates/stats", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := server.GetEstatesStats(c, tc.params)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
+// TestGetEstateEstateIdStatsGrouped tests the GetEstateEstateIdStatsGrouped handler function.
+// It checks how rows, columns and blocks translate into repository blocks, the plot bounds of the
+// groups at the edge of the estate and the cap on the number of groups.
+func TestGetEstateEstateIdStatsGrouped(t *testing.T) {
+	testCases := []struct {
+		name                                    string
+		groupBy                                 *generated.GetEstateEstateIdStatsGroupedParamsGroupBy
+		blockLength, blockWidth                 *int
+		expectedBlockLength, expectedBlockWidth int
+	}{
+		{name: "Default blocks", expectedBlockLength: 10, expectedBlockWidth: 10},
+		{name: "Custom blocks", blockLength: intPointer(4), blockWidth: intPointer(3), expectedBlockLength: 4, expectedBlockWidth: 3},
+		{name: "Rows", groupBy: groupByPointer(generated.GetEstateEstateIdStatsGroupedParamsGroupByRow), expectedBlockLength: 25, expectedBlockWidth: 1},
+		{name: "Columns", groupBy: groupByPointer(generated.GetEstateEstateIdStatsGroupedParamsGroupByColumn), expectedBlockLength: 1, expectedBlockWidth: 15},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run("Valid request - "+tc.name, func(t *testing.T) {
+			server, mockRepo, e := setupTestServer(t)
+			estateId := uuid.New()
+
+			mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+				Estate: repository.Estate{Length: 25, Width: 15},
+			}, nil)
+			mockRepo.EXPECT().GetEstateGroupedStatsByEstateId(gomock.Any(), &repository.GetEstateGroupedStatsByEstateIdInput{
+				EstateId:    estateId.String(),
+				BlockLength: tc.expectedBlockLength,
+				BlockWidth:  tc.expectedBlockWidth,
+			}).Return(&repository.GetEstateGroupedStatsByEstateIdOutput{
+				Groups: []repository.EstateStatsGroup{{BlockX: 0, BlockY: 0, Count: 2, Max: 9, Min: 3, Median: 6, Mean: 6}},
+			}, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats/grouped", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := server.GetEstateEstateIdStatsGrouped(c, estateId, generated.GetEstateEstateIdStatsGroupedParams{
+				GroupBy:     tc.groupBy,
+				BlockLength: tc.blockLength,
+				BlockWidth:  tc.blockWidth,
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var resp generated.EstateGroupedStatsResponse
+			err = json.Unmarshal(rec.Body.Bytes(), &resp)
+			require.NoError(t, err)
+			require.Len(t, resp.Groups, 1)
+			assert.Equal(t, 1, resp.Groups[0].MinX)
+			assert.Equal(t, tc.expectedBlockLength, resp.Groups[0].MaxX)
+			assert.Equal(t, tc.expectedBlockWidth, resp.Groups[0].MaxY)
+			assert.Equal(t, 2, resp.Groups[0].Count)
+		})
+	}
+
+	t.Run("Valid request - blocks at the edge are clipped", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 25, Width: 15},
+		}, nil)
+		mockRepo.EXPECT().GetEstateGroupedStatsByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateGroupedStatsByEstateIdOutput{
+			Groups: []repository.EstateStatsGroup{{BlockX: 2, BlockY: 1}},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats/grouped", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStatsGrouped(c, estateId, generated.GetEstateEstateIdStatsGroupedParams{})
+		require.NoError(t, err)
+
+		var resp generated.EstateGroupedStatsResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Len(t, resp.Groups, 1)
+		assert.Equal(t, generated.EstateStatsGroup{BlockX: 2, BlockY: 1, MinX: 21, MaxX: 25, MinY: 11, MaxY: 15}, resp.Groups[0])
+	})
+
+	t.Run("Invalid request - too many groups", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(&repository.GetEstateByEstateIdOutput{
+			Estate: repository.Estate{Length: 1000, Width: 1000},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats/grouped?block_length=1&block_width=1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStatsGrouped(c, estateId, generated.GetEstateEstateIdStatsGroupedParams{
+			BlockLength: intPointer(1),
+			BlockWidth:  intPointer(1),
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Estate not found", func(t *testing.T) {
+		server, mockRepo, e := setupTestServer(t)
+		estateId := uuid.New()
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/estate/"+estateId.String()+"/stats/grouped", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := server.GetEstateEstateIdStatsGrouped(c, estateId, generated.GetEstateEstateIdStatsGroupedParams{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func intPointer(i int) *int {
+	return &i
+}
+
+func groupByPointer(groupBy generated.GetEstateEstateIdStatsGroupedParamsGroupBy) *generated.GetEstateEstateIdStatsGroupedParamsGroupBy {
+	return &groupBy
+}
+
+func intervalPointer(interval generated.GetEstateEstateIdStatsParamsInterval) *generated.GetEstateEstateIdStatsParamsInterval {
+	return &interval
+}
+
+// assertProblem asserts that the response is a problem of the given code and returns it.
+func assertProblem(t *testing.T, rec *httptest.ResponseRecorder, code string) *Problem {
+	t.Helper()
+	assert.Equal(t, ContentTypeProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, rec.Code, problem.Status)
+	assert.Equal(t, code, problem.Code)
+	return &problem
+}
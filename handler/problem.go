@@ -0,0 +1,273 @@
+// This file contains the RFC 7807 problem details returned by the handlers on failure.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/apispec"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const ContentTypeProblemJSON = "application/problem+json"
+
+// Problem codes are stable identifiers of the failures, clients can rely on them instead of the title or
+// the detail, which are meant for humans.
+const (
+	CodeMalformedBody        = "malformed_body"
+	CodeValidationFailed     = "validation_failed"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodePlotOutOfBounds      = "plot_out_of_bounds"
+	CodeTreeAlreadyExists    = "tree_already_exists"
+	CodeTooManyResults       = "too_many_results"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeEstateNotFound       = "estate_not_found"
+	CodeTreeNotFound         = "tree_not_found"
+	CodeJobNotFound          = "job_not_found"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeRequestRejected      = "request_rejected"
+	CodeInternalError        = "internal_error"
+)
+
+var problemTitles = map[string]string{
+	CodeMalformedBody:        "Malformed request body",
+	CodeValidationFailed:     "Request body failed validation",
+	CodeInvalidParameter:     "Invalid parameter",
+	CodePlotOutOfBounds:      "Plot is outside of the estate",
+	CodeTreeAlreadyExists:    "Tree already exists",
+	CodeTooManyResults:       "Too many results",
+	CodeUnsupportedMediaType: "Unsupported media type",
+	CodeEstateNotFound:       "Estate not found",
+	CodeTreeNotFound:         "Tree not found",
+	CodeJobNotFound:          "Job not found",
+	CodeRouteNotFound:        "Route not found",
+	CodeMethodNotAllowed:     "Method not allowed",
+	CodeRequestRejected:      "Request rejected",
+	CodeInternalError:        "Internal server error",
+}
+
+// Problem is an RFC 7807 problem details object, extended with a stable code and field-level violations.
+type Problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Instance   string      `json:"instance,omitempty"`
+	Code       string      `json:"code"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation describes why a field of the request is rejected.
+type Violation struct {
+	// Field is the name of the field as sent by the client, e.g. the JSON property or the query parameter.
+	Field string `json:"field"`
+	// Rule is the failed rule, e.g. required, min, max or type.
+	Rule string `json:"rule"`
+	// Param is the parameter of the rule, e.g. 30 for max=30.
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// NewProblem creates a Problem of the given status and code. The title is derived from the code.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + code,
+		Title:  problemTitles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// newParameterProblem rejects a single query parameter.
+func newParameterProblem(field, rule, param, message string) *Problem {
+	p := NewProblem(http.StatusBadRequest, CodeInvalidParameter, message)
+	p.Violations = []Violation{{Field: field, Rule: rule, Param: param, Message: message}}
+	return p
+}
+
+func newPercentileProblem() *Problem {
+	return newParameterProblem("percentiles", "range", "0 100", "percentiles must be between 0 and 100")
+}
+
+// newPlotOutOfBoundsProblem reports the coordinates of a tree that fall outside of the estate.
+func newPlotOutOfBoundsProblem(x, y int, estate repository.Estate) *Problem {
+	p := NewProblem(http.StatusBadRequest, CodePlotOutOfBounds,
+		fmt.Sprintf("Plot (%d, %d) is outside of the estate of %d x %d plots.", x, y, estate.Length, estate.Width))
+	if violation, ok := plotBoundViolation("x", x, estate.Length); ok {
+		p.Violations = append(p.Violations, violation)
+	}
+	if violation, ok := plotBoundViolation("y", y, estate.Width); ok {
+		p.Violations = append(p.Violations, violation)
+	}
+	return p
+}
+
+// plotBoundViolation reports a coordinate below the first plot with the min rule, and a coordinate beyond the
+// last plot with the max rule.
+func plotBoundViolation(field string, value, last int) (Violation, bool) {
+	if value < 1 {
+		return Violation{Field: field, Rule: "min", Param: "1", Message: fmt.Sprintf("%s must be at least 1", field)}, true
+	}
+	if value > last {
+		return Violation{Field: field, Rule: "max", Param: fmt.Sprint(last), Message: fmt.Sprintf("%s must be at most %d", field, last)}, true
+	}
+	return Violation{}, false
+}
+
+// NewBodyProblem translates the error of decoding or validating a JSON request body into a Problem.
+// Validation errors of go-playground/validator are reported field by field, using the names returned by
+// the validator, see validator.NewRequestValidator. A value of the wrong JSON type is reported as a
+// violation of the type rule.
+func NewBodyProblem(err error) *Problem {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		p := NewProblem(http.StatusBadRequest, CodeValidationFailed, "One or more fields are invalid.")
+		for _, fieldError := range validationErrors {
+			p.Violations = append(p.Violations, Violation{
+				Field:   fieldError.Field(),
+				Rule:    fieldError.Tag(),
+				Param:   fieldError.Param(),
+				Message: violationMessage(fieldError),
+			})
+		}
+		return p
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		jsonType := jsonTypeName(typeError.Type.Kind())
+		message := fmt.Sprintf("%s must be a JSON %s", typeError.Field, jsonType)
+		p := NewProblem(http.StatusBadRequest, CodeMalformedBody, message)
+		p.Violations = []Violation{{Field: typeError.Field, Rule: "type", Param: jsonType, Message: message}}
+		return p
+	}
+	return NewProblem(http.StatusBadRequest, CodeMalformedBody, "The request body is not valid JSON.")
+}
+
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
+
+func violationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return fieldError.Field() + " is required"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", fieldError.Field(), fieldError.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", fieldError.Field(), fieldError.Param())
+	case "numeric":
+		return fieldError.Field() + " must be a number"
+	}
+	return fmt.Sprintf("%s does not satisfy %s", fieldError.Field(), fieldError.Tag())
+}
+
+// writeProblem sends a Problem as application/problem+json, with the request path as instance.
+func writeProblem(ctx echo.Context, p *Problem) error {
+	if p.Instance == "" {
+		p.Instance = ctx.Request().URL.Path
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(p.Status, ContentTypeProblemJSON, body)
+}
+
+// writeInternalError hides the cause of an unexpected failure, which is logged where it happens.
+func writeInternalError(ctx echo.Context) error {
+	return writeProblem(ctx, NewProblem(http.StatusInternalServerError, CodeInternalError, "Something happens in our end. Let us check."))
+}
+
+func writeEstateNotFound(ctx echo.Context) error {
+	return writeProblem(ctx, NewProblem(http.StatusNotFound, CodeEstateNotFound, "Estate not found"))
+}
+
+// newRequestProblem translates a request rejected by the OpenAPI specification into a Problem.
+func newRequestProblem(requestError *apispec.RequestError) *Problem {
+	var p *Problem
+	switch requestError.Reason {
+	case apispec.ReasonUnsupportedMediaType:
+		p = NewProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, requestError.Detail)
+	case apispec.ReasonMalformedBody:
+		p = NewProblem(http.StatusBadRequest, CodeMalformedBody, requestError.Detail)
+	case apispec.ReasonInvalidBody:
+		p = NewProblem(http.StatusBadRequest, CodeValidationFailed, requestError.Detail)
+	default:
+		p = NewProblem(http.StatusBadRequest, CodeInvalidParameter, requestError.Detail)
+	}
+	for _, violation := range requestError.Violations {
+		p.Violations = append(p.Violations, Violation(violation))
+	}
+	return p
+}
+
+// ProblemHTTPErrorHandler renders the errors returned to echo as problems, e.g. the requests rejected by
+// the OpenAPI specification, the parameter binding errors of the generated wrappers or unknown routes. It is meant to replace echo's default error handler.
+func ProblemHTTPErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	var p *Problem
+	var requestError *apispec.RequestError
+	var httpError *echo.HTTPError
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &requestError):
+		p = newRequestProblem(requestError)
+	case errors.As(err, &httpError):
+		detail := http.StatusText(httpError.Code)
+		if message, ok := httpError.Message.(string); ok {
+			detail = message
+		}
+		switch httpError.Code {
+		case http.StatusBadRequest:
+			p = NewProblem(httpError.Code, CodeInvalidParameter, detail)
+		case http.StatusNotFound:
+			p = NewProblem(httpError.Code, CodeRouteNotFound, detail)
+		case http.StatusMethodNotAllowed:
+			p = NewProblem(httpError.Code, CodeMethodNotAllowed, detail)
+		case http.StatusUnsupportedMediaType:
+			p = NewProblem(httpError.Code, CodeUnsupportedMediaType, detail)
+		default:
+			if httpError.Code < http.StatusInternalServerError {
+				p = NewProblem(httpError.Code, CodeRequestRejected, detail)
+				p.Title = http.StatusText(httpError.Code)
+			}
+		}
+	}
+	if p == nil {
+		slog.ErrorContext(ctx.Request().Context(), "err handling request", "error", err)
+		p = NewProblem(http.StatusInternalServerError, CodeInternalError, "Something happens in our end. Let us check.")
+	}
+
+	if err := writeProblem(ctx, p); err != nil {
+		slog.ErrorContext(ctx.Request().Context(), "err writing problem", "error", err)
+	}
+}
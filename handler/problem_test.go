@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/apispec"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/generated"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProblemHTTPErrorHandler tests the translation of the errors returned to echo into problems.
+func TestProblemHTTPErrorHandler(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{
+			name:           "Binding error",
+			err:            echo.NewHTTPError(http.StatusBadRequest, "Invalid format for parameter estate_id"),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   CodeInvalidParameter,
+			expectedDetail: "Invalid format for parameter estate_id",
+		},
+		{
+			name:           "Unknown route",
+			err:            echo.ErrNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   CodeRouteNotFound,
+			expectedDetail: "Not Found",
+		},
+		{
+			name:           "Method not allowed",
+			err:            echo.ErrMethodNotAllowed,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   CodeMethodNotAllowed,
+			expectedDetail: "Method Not Allowed",
+		},
+		{
+			name:           "Other client error",
+			err:            echo.ErrStatusRequestEntityTooLarge,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   CodeRequestRejected,
+			expectedDetail: "Request Entity Too Large",
+		},
+		{
+			name: "Request rejected by the specification",
+			err: &apispec.RequestError{
+				Reason:     apispec.ReasonInvalidParameter,
+				Detail:     "One or more parameters are invalid.",
+				Violations: []apispec.Violation{{Field: "max-distance", Rule: "min", Param: "0", Message: "max-distance must be at least 0"}},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   CodeInvalidParameter,
+			expectedDetail: "One or more parameters are invalid.",
+		},
+		{
+			name:           "Unsupported content type",
+			err:            &apispec.RequestError{Reason: apispec.ReasonUnsupportedMediaType, Detail: "The content type \"text/plain\" is not supported."},
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedCode:   CodeUnsupportedMediaType,
+			expectedDetail: "The content type \"text/plain\" is not supported.",
+		},
+		{
+			name:           "Problem",
+			err:            NewProblem(http.StatusNotFound, CodeJobNotFound, "Job not found"),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   CodeJobNotFound,
+			expectedDetail: "Job not found",
+		},
+		{
+			name:           "Unexpected error",
+			err:            errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   CodeInternalError,
+			expectedDetail: "Something happens in our end. Let us check.",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/estate/abc/stats", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			ProblemHTTPErrorHandler(tc.err, ctx)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			problem := assertProblem(t, rec, tc.expectedCode)
+			assert.Equal(t, tc.expectedDetail, problem.Detail)
+			assert.Equal(t, "/problems/"+tc.expectedCode, problem.Type)
+			assert.Equal(t, "/estate/abc/stats", problem.Instance)
+			assert.NotEmpty(t, problem.Title)
+		})
+	}
+}
+
+// TestNewEstateStatsOptionsProblem tests the violations reported for the query parameters of the stats endpoint.
+func TestNewEstateStatsOptionsProblem(t *testing.T) {
+	t.Parallel()
+
+	buckets := 31
+	interval := generated.GetEstateEstateIdStatsParamsIntervalMonth
+	_, problem := newEstateStatsOptions("estate", generated.GetEstateEstateIdStatsParams{HistogramBuckets: &buckets})
+	assert.Equal(t, CodeInvalidParameter, problem.Code)
+	assert.Equal(t, []Violation{{
+		Field:   "histogram_buckets",
+		Rule:    "range",
+		Param:   "1 30",
+		Message: "histogram_buckets must be between 1 and 30",
+	}}, problem.Violations)
+
+	options, problem := newEstateStatsOptions("estate", generated.GetEstateEstateIdStatsParams{Interval: &interval})
+	assert.Nil(t, problem)
+	assert.NotNil(t, options.series)
+}
+
+// TestNewPlotOutOfBoundsProblem tests the violations reported for the coordinates of a tree outside of the estate.
+func TestNewPlotOutOfBoundsProblem(t *testing.T) {
+	t.Parallel()
+
+	estate := repository.Estate{Length: 20, Width: 30}
+	for _, tc := range []struct {
+		name               string
+		x, y               int
+		expectedViolations []Violation
+	}{
+		{
+			name: "beyond the last plot",
+			x:    21,
+			y:    31,
+			expectedViolations: []Violation{
+				{Field: "x", Rule: "max", Param: "20", Message: "x must be at most 20"},
+				{Field: "y", Rule: "max", Param: "30", Message: "y must be at most 30"},
+			},
+		},
+		{
+			name: "below the first plot",
+			x:    0,
+			y:    -1,
+			expectedViolations: []Violation{
+				{Field: "x", Rule: "min", Param: "1", Message: "x must be at least 1"},
+				{Field: "y", Rule: "min", Param: "1", Message: "y must be at least 1"},
+			},
+		},
+		{
+			name: "one coordinate out of bounds",
+			x:    20,
+			y:    0,
+			expectedViolations: []Violation{
+				{Field: "y", Rule: "min", Param: "1", Message: "y must be at least 1"},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			problem := newPlotOutOfBoundsProblem(tc.x, tc.y, estate)
+			assert.Equal(t, CodePlotOutOfBounds, problem.Code)
+			assert.Equal(t, tc.expectedViolations, problem.Violations)
+		})
+	}
+}
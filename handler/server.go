@@ -1,20 +1,50 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/job"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/planner"
 	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
 	Repository repository.RepositoryInterface
 	Config     *config.Config
+	JobManager *job.Manager
+	// PlanCache caches the computed drone plans, plans are computed on every request when it is nil.
+	PlanCache *plancache.Cache
+	// PlanObserver is told about every computed drone plan, e.g. to record metrics. It is optional.
+	PlanObserver PlanObserver
+	// Tracer creates the span of the computation of the drone plans. It is optional.
+	Tracer trace.Tracer
+}
+
+// PlanObserver observes the drone plans computed by CalculateDroneDistance.
+type PlanObserver interface {
+	ObservePlan(estate planner.Estate, plan *planner.Plan, elapsed time.Duration)
 }
 
 type NewServerOptions struct {
-	Repository repository.RepositoryInterface
-	Config     *config.Config
+	Repository   repository.RepositoryInterface
+	Config       *config.Config
+	JobManager   *job.Manager
+	PlanCache    *plancache.Cache
+	PlanObserver PlanObserver
+	Tracer       trace.Tracer
 }
 
 func NewServer(opts NewServerOptions) *Server {
-	return &Server{opts.Repository, opts.Config}
+	return &Server{
+		Repository: opts.Repository,
+		Config:     opts.Config,
+		JobManager: opts.JobManager,
+		PlanCache:  opts.PlanCache,
+
+		PlanObserver: opts.PlanObserver,
+		Tracer:       opts.Tracer,
+	}
 }
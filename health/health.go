@@ -0,0 +1,114 @@
+// Package health serves the liveness and the readiness probes of the service.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Check returns an error when a dependency of the service is not ready. It must return when ctx is done.
+type Check func(ctx context.Context) error
+
+const (
+	StatusOK           = "ok"
+	StatusReady        = "ready"
+	StatusUnready      = "unready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Response is the body of the probes. Checks holds the outcome of every check of the readiness probe, "ok" or
+// the error of the check.
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	Checks map[string]Check
+	// Timeout bounds the duration of all the checks of a readiness probe.
+	Timeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+type NewCheckerOptions struct {
+	Checks map[string]Check
+	// Timeout defaults to 2 seconds.
+	Timeout time.Duration
+}
+
+func NewChecker(opts NewCheckerOptions) *Checker {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{
+		Checks:  opts.Checks,
+		Timeout: timeout,
+	}
+}
+
+// SetShuttingDown makes the readiness probe fail from now on, so that no new traffic is routed to the
+// instance while it shuts down gracefully.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Register adds the probes to e: /healthz answers as long as the process serves requests, and /readyz when
+// the dependencies of the service are ready too.
+func (c *Checker) Register(e *echo.Echo) {
+	e.GET("/healthz", c.Healthz)
+	e.GET("/readyz", c.Readyz)
+}
+
+func (c *Checker) Healthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, Response{Status: StatusOK})
+}
+
+func (c *Checker) Readyz(ctx echo.Context) error {
+	if c.shuttingDown.Load() {
+		return ctx.JSON(http.StatusServiceUnavailable, Response{Status: StatusShuttingDown})
+	}
+	response := c.Ready(ctx.Request().Context())
+	if response.Status != StatusReady {
+		return ctx.JSON(http.StatusServiceUnavailable, response)
+	}
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// Ready runs all the checks concurrently within the timeout.
+func (c *Checker) Ready(ctx context.Context) Response {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	names := make([]string, 0, len(c.Checks))
+	for name := range c.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, c.Checks[name])
+	}
+	wg.Wait()
+
+	response := Response{Status: StatusReady, Checks: map[string]string{}}
+	for i, name := range names {
+		response.Checks[name] = StatusOK
+		if errs[i] != nil {
+			response.Status, response.Checks[name] = StatusUnready, errs[i].Error()
+		}
+	}
+	return response
+}
@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// probe calls path on the probes of c and decodes the response.
+func probe(t *testing.T, c *Checker, path string) (int, Response) {
+	t.Helper()
+	e := echo.New()
+	c.Register(e)
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	var response Response
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response), recorder.Body.String())
+	return recorder.Code, response
+}
+
+func TestProbes(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	// hanging only returns when the timeout of the probe is over.
+	hanging := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name         string
+		checks       map[string]Check
+		shuttingDown bool
+		wantCode     int
+		want         Response
+	}{
+		{
+			name:     "NoCheck",
+			wantCode: http.StatusOK,
+			want:     Response{Status: StatusReady},
+		},
+		{
+			name:     "Ready",
+			checks:   map[string]Check{"database": ok, "migrations": ok},
+			wantCode: http.StatusOK,
+			want:     Response{Status: StatusReady, Checks: map[string]string{"database": StatusOK, "migrations": StatusOK}},
+		},
+		{
+			name:     "Unready",
+			checks:   map[string]Check{"database": down, "migrations": ok},
+			wantCode: http.StatusServiceUnavailable,
+			want:     Response{Status: StatusUnready, Checks: map[string]string{"database": "connection refused", "migrations": StatusOK}},
+		},
+		{
+			name:     "Timeout",
+			checks:   map[string]Check{"database": hanging},
+			wantCode: http.StatusServiceUnavailable,
+			want:     Response{Status: StatusUnready, Checks: map[string]string{"database": context.DeadlineExceeded.Error()}},
+		},
+		{
+			name:         "ShuttingDown",
+			checks:       map[string]Check{"database": ok},
+			shuttingDown: true,
+			wantCode:     http.StatusServiceUnavailable,
+			want:         Response{Status: StatusShuttingDown},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(NewCheckerOptions{Checks: tt.checks, Timeout: 50 * time.Millisecond})
+			if tt.shuttingDown {
+				c.SetShuttingDown()
+			}
+
+			code, response := probe(t, c, "/readyz")
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.want, response)
+
+			// The process stays alive whatever its dependencies.
+			code, response = probe(t, c, "/healthz")
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, Response{Status: StatusOK}, response)
+		})
+	}
+}
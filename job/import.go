@@ -0,0 +1,318 @@
+// This file contains the processing of tree import jobs.
+package job
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+const (
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+
+	// maxErrorSamples is the number of failed rows reported with their error message.
+	maxErrorSamples = 10
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type, expected text/csv or application/x-ndjson")
+
+type ImportRow struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Height int `json:"height"`
+}
+
+// NormalizeContentType strips the parameters of a Content-Type header and checks that the
+// media type is one of the supported import formats.
+func NormalizeContentType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrUnsupportedContentType
+	}
+	switch mediaType {
+	case ContentTypeCSV, ContentTypeNDJSON:
+		return mediaType, nil
+	}
+	return "", ErrUnsupportedContentType
+}
+
+// ParseImportRows reads the rows of a CSV or NDJSON payload and calls fn for every row with its
+// 1-based row number. Rows that cannot be parsed are passed to fn with a non-nil rowErr so the
+// caller can report them and carry on. Parsing stops at the first error returned by fn.
+//
+// CSV payloads must start with a header naming the x, y and height columns, in any order.
+func ParseImportRows(contentType string, payload []byte, fn func(rowNumber int, row *ImportRow, rowErr error) error) error {
+	switch contentType {
+	case ContentTypeCSV:
+		return parseCSVRows(payload, fn)
+	case ContentTypeNDJSON:
+		return parseNDJSONRows(payload, fn)
+	}
+	return ErrUnsupportedContentType
+}
+
+func parseCSVRows(payload []byte, fn func(int, *ImportRow, error) error) error {
+	reader := csv.NewReader(bytes.NewReader(payload))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("err reading the CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"x", "y", "height"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("err the CSV header is missing the %q column", name)
+		}
+	}
+
+	for rowNumber := 1; ; rowNumber++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if err := fn(rowNumber, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var row ImportRow
+		var rowErr error
+		for _, field := range []struct {
+			name   string
+			target *int
+		}{{"x", &row.X}, {"y", &row.Y}, {"height", &row.Height}} {
+			idx := columns[field.name]
+			if idx >= len(record) {
+				rowErr = fmt.Errorf("missing %s", field.name)
+				break
+			}
+			if *field.target, err = strconv.Atoi(strings.TrimSpace(record[idx])); err != nil {
+				rowErr = fmt.Errorf("%s is not an integer", field.name)
+				break
+			}
+		}
+		if rowErr != nil {
+			err = fn(rowNumber, nil, rowErr)
+		} else {
+			err = fn(rowNumber, &row, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func parseNDJSONRows(payload []byte, fn func(int, *ImportRow, error) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(payload))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	rowNumber := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rowNumber++
+
+		var row ImportRow
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		var err error
+		if decodeErr := decoder.Decode(&row); decodeErr != nil {
+			err = fn(rowNumber, nil, fmt.Errorf("invalid JSON: %s", decodeErr))
+		} else {
+			err = fn(rowNumber, &row, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// CountImportRows returns the number of rows of a payload, including the rows that cannot be parsed.
+func CountImportRows(contentType string, payload []byte) (int, error) {
+	count := 0
+	err := ParseImportRows(contentType, payload, func(int, *ImportRow, error) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// ValidateImportRow applies the same rules as the tree creation endpoint to an imported row.
+func ValidateImportRow(row *ImportRow, estate repository.Estate) error {
+	if row.X < 1 || row.X > estate.Length || row.Y < 1 || row.Y > estate.Width {
+		return fmt.Errorf("plot (%d, %d) is outside of the estate", row.X, row.Y)
+	}
+	if row.Height < 1 || row.Height > 30 {
+		return fmt.Errorf("height %d is not between 1 and 30", row.Height)
+	}
+	return nil
+}
+
+// addErrorSample records the error of a row unless enough samples have been collected already.
+func addErrorSample(job *repository.Job, rowNumber int, err error) {
+	if len(job.ErrorSamples) < maxErrorSamples {
+		job.ErrorSamples = append(job.ErrorSamples, repository.JobError{Row: rowNumber, Message: err.Error()})
+	}
+}
+
+// runImport processes a claimed tree import job, resuming after the last checkpointed row.
+//
+// Rows processed after the last checkpoint of an interrupted run are processed again when the job
+// resumes, in which case they are reported as already existing trees.
+func (m *Manager) runImport(ctx context.Context, job *repository.Job) {
+	estate, err := m.Repository.GetEstateByEstateId(ctx, &repository.GetEstateByEstateIdInput{Id: job.EstateId})
+	if err == nil && estate == nil {
+		err = errors.New("estate not found")
+	}
+	if err != nil {
+		m.finishImport(ctx, job, err)
+		return
+	}
+
+	if job.TotalRows == 0 {
+		if job.TotalRows, err = CountImportRows(job.ContentType, job.Payload); err != nil {
+			m.finishImport(ctx, job, err)
+			return
+		}
+	}
+
+	resumeAfter := job.ProcessedRows
+	err = ParseImportRows(job.ContentType, job.Payload, func(rowNumber int, row *ImportRow, rowErr error) error {
+		if rowNumber <= resumeAfter {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if rowErr == nil {
+			rowErr = ValidateImportRow(row, estate.Estate)
+		}
+		if rowErr == nil {
+			rowErr, err = ImportTree(ctx, m.Repository, job.EstateId, row)
+			if err != nil {
+				return err
+			}
+		}
+		if rowErr != nil {
+			job.FailedRows++
+			addErrorSample(job, rowNumber, rowErr)
+		} else {
+			job.SucceededRows++
+		}
+		job.ProcessedRows = rowNumber
+
+		if job.ProcessedRows%m.checkpointEvery == 0 {
+			return m.checkpointImport(ctx, job)
+		}
+		return nil
+	})
+	m.finishImport(ctx, job, err)
+}
+
+// ImportTree creates the tree of a validated row. The first returned error is a row error, the second one
+// is an error that must stop the import.
+func ImportTree(ctx context.Context, repo repository.RepositoryInterface, estateId string, row *ImportRow) (rowErr, err error) {
+	isTreeExistOutput, err := repo.IsTreeExist(ctx, &repository.IsTreeExistInput{
+		EstateId: estateId,
+		X:        row.X,
+		Y:        row.Y,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isTreeExistOutput.IsExist {
+		return fmt.Errorf("a tree already exists at plot (%d, %d)", row.X, row.Y), nil
+	}
+
+	_, err = repo.CreateTree(ctx, &repository.CreateTreeInput{
+		Id:       uuid.New().String(),
+		EstateId: estateId,
+		X:        row.X,
+		Y:        row.Y,
+		Height:   row.Height,
+	})
+	return nil, err
+}
+
+// checkpointImport saves the progress of a running job and picks up a cancellation requested
+// through another instance.
+func (m *Manager) checkpointImport(ctx context.Context, job *repository.Job) error {
+	output, err := m.Repository.UpdateJobProgress(ctx, &repository.UpdateJobProgressInput{
+		Id:            job.Id,
+		State:         repository.JobStateRunning,
+		TotalRows:     job.TotalRows,
+		ProcessedRows: job.ProcessedRows,
+		SucceededRows: job.SucceededRows,
+		FailedRows:    job.FailedRows,
+		ErrorSamples:  job.ErrorSamples,
+	})
+	if err != nil {
+		return err
+	}
+	if output.CancelRequested {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// finishImport stores the final state of a job. The state depends on why the processing stopped:
+// a shutdown puts the job back in the queue, a cancellation cancels it and any other error fails it.
+func (m *Manager) finishImport(ctx context.Context, job *repository.Job, err error) {
+	state := repository.JobStateSucceeded
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrShutdown):
+		state = repository.JobStateQueued
+	case errors.Is(err, ErrCancelled):
+		state = repository.JobStateCancelled
+	default:
+		slog.ErrorContext(ctx, "err processing job", "job_id", job.Id, "error", err)
+		state = repository.JobStateFailed
+		addErrorSample(job, job.ProcessedRows+1, err)
+	}
+
+	// The job context may be cancelled already, the final state must be stored regardless.
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = m.Repository.UpdateJobProgress(saveCtx, &repository.UpdateJobProgressInput{
+		Id:            job.Id,
+		State:         state,
+		TotalRows:     job.TotalRows,
+		ProcessedRows: job.ProcessedRows,
+		SucceededRows: job.SucceededRows,
+		FailedRows:    job.FailedRows,
+		ErrorSamples:  job.ErrorSamples,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "err storing the final state of job", "job_id", job.Id, "error", err)
+	}
+}
@@ -0,0 +1,226 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// TestParseImportRows tests that CSV and NDJSON payloads are read row by row and that
+// malformed rows are reported without stopping the parsing.
+func TestParseImportRows(t *testing.T) {
+	t.Parallel()
+
+	type parsedRow struct {
+		row    *ImportRow
+		hasErr bool
+	}
+
+	testCases := []struct {
+		name        string
+		contentType string
+		payload     string
+		expected    []parsedRow
+		expectedErr bool
+	}{
+		{
+			name:        "CSV with columns in any order",
+			contentType: ContentTypeCSV,
+			payload:     "height,x,y\n5,1,2\n7,3,4\n",
+			expected:    []parsedRow{{row: &ImportRow{X: 1, Y: 2, Height: 5}}, {row: &ImportRow{X: 3, Y: 4, Height: 7}}},
+		},
+		{
+			name:        "CSV with a malformed row",
+			contentType: ContentTypeCSV,
+			payload:     "x,y,height\n1,2,abc\n3,4,5\n",
+			expected:    []parsedRow{{hasErr: true}, {row: &ImportRow{X: 3, Y: 4, Height: 5}}},
+		},
+		{
+			name:        "CSV without height column",
+			contentType: ContentTypeCSV,
+			payload:     "x,y\n1,2\n",
+			expectedErr: true,
+		},
+		{
+			name:        "NDJSON with blank lines and a malformed row",
+			contentType: ContentTypeNDJSON,
+			payload:     "{\"x\":1,\"y\":2,\"height\":3}\n\n{\"x\":\"a\"}\n",
+			expected:    []parsedRow{{row: &ImportRow{X: 1, Y: 2, Height: 3}}, {hasErr: true}},
+		},
+		{
+			name:        "Unsupported content type",
+			contentType: "application/json",
+			payload:     "[]",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var rows []parsedRow
+			err := ParseImportRows(tc.contentType, []byte(tc.payload), func(rowNumber int, row *ImportRow, rowErr error) error {
+				assert.Equal(t, len(rows)+1, rowNumber)
+				rows = append(rows, parsedRow{row: row, hasErr: rowErr != nil})
+				return nil
+			})
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, rows)
+		})
+	}
+}
+
+// TestNormalizeContentType tests that parameters are stripped from the Content-Type header
+// and that only the supported formats are accepted.
+func TestNormalizeContentType(t *testing.T) {
+	t.Parallel()
+
+	contentType, err := NormalizeContentType("text/csv; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeCSV, contentType)
+
+	_, err = NormalizeContentType("application/json")
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+}
+
+func setupTestManager(t *testing.T) (*Manager, *repository.MockRepositoryInterface) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	mockRepo := repository.NewMockRepositoryInterface(ctrl)
+	return NewManager(NewManagerOptions{Repository: mockRepo, CheckpointEvery: 2}), mockRepo
+}
+
+// TestRunImport tests the processing of an import job, from the first row or from a checkpoint.
+func TestRunImport(t *testing.T) {
+	t.Parallel()
+
+	estate := &repository.GetEstateByEstateIdOutput{Estate: repository.Estate{Length: 5, Width: 5}}
+	payload := []byte("x,y,height\n1,1,5\n9,9,5\n2,1,31\n3,1,4\n")
+
+	t.Run("Valid job - rows are imported and failures are sampled", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), &repository.GetEstateByEstateIdInput{Id: "estate"}).Return(estate, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), &repository.IsTreeExistInput{EstateId: "estate", X: 1, Y: 1}).Return(&repository.IsTreeExistOutput{}, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), &repository.IsTreeExistInput{EstateId: "estate", X: 3, Y: 1}).Return(&repository.IsTreeExistOutput{IsExist: true}, nil)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(&repository.CreateTreeOutput{Id: "tree"}, nil)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).Return(&repository.UpdateJobProgressOutput{}, nil).Times(2)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+				assert.Equal(t, repository.JobStateSucceeded, input.State)
+				return &repository.UpdateJobProgressOutput{}, nil
+			})
+
+		m.runImport(context.Background(), job)
+
+		assert.Equal(t, 4, job.TotalRows)
+		assert.Equal(t, 4, job.ProcessedRows)
+		assert.Equal(t, 1, job.SucceededRows)
+		assert.Equal(t, 3, job.FailedRows)
+		require.Len(t, job.ErrorSamples, 3)
+		assert.Equal(t, 2, job.ErrorSamples[0].Row)
+	})
+
+	t.Run("Valid job - resumes after the checkpoint", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload, TotalRows: 4, ProcessedRows: 3}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), &repository.IsTreeExistInput{EstateId: "estate", X: 3, Y: 1}).Return(&repository.IsTreeExistOutput{}, nil)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(&repository.CreateTreeOutput{Id: "tree"}, nil)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).Return(&repository.UpdateJobProgressOutput{}, nil).Times(2)
+
+		m.runImport(context.Background(), job)
+
+		assert.Equal(t, 4, job.ProcessedRows)
+		assert.Equal(t, 1, job.SucceededRows)
+	})
+
+	t.Run("Cancelled job - cancellation requested from another instance", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), gomock.Any()).Return(&repository.IsTreeExistOutput{}, nil)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(&repository.CreateTreeOutput{Id: "tree"}, nil)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).Return(&repository.UpdateJobProgressOutput{CancelRequested: true}, nil)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+				assert.Equal(t, repository.JobStateCancelled, input.State)
+				assert.Equal(t, 2, input.ProcessedRows)
+				return &repository.UpdateJobProgressOutput{}, nil
+			})
+
+		m.runImport(context.Background(), job)
+	})
+
+	t.Run("Interrupted job - shutdown puts the job back in the queue", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload}
+		ctx, cancel := context.WithCancelCause(context.Background())
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), gomock.Any()).Return(&repository.IsTreeExistOutput{}, nil)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, *repository.CreateTreeInput) (*repository.CreateTreeOutput, error) {
+				cancel(ErrShutdown)
+				return &repository.CreateTreeOutput{Id: "tree"}, nil
+			})
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+				assert.Equal(t, repository.JobStateQueued, input.State)
+				assert.Equal(t, 1, input.ProcessedRows)
+				return &repository.UpdateJobProgressOutput{}, nil
+			})
+
+		m.runImport(ctx, job)
+	})
+
+	t.Run("Failed job - estate not found", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(nil, nil)
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+				assert.Equal(t, repository.JobStateFailed, input.State)
+				require.Len(t, input.ErrorSamples, 1)
+				assert.Equal(t, "estate not found", input.ErrorSamples[0].Message)
+				return &repository.UpdateJobProgressOutput{}, nil
+			})
+
+		m.runImport(context.Background(), job)
+	})
+
+	t.Run("Failed job - repository error", func(t *testing.T) {
+		t.Parallel()
+		m, mockRepo := setupTestManager(t)
+		job := &repository.Job{Id: "job", EstateId: "estate", ContentType: ContentTypeCSV, Payload: payload}
+
+		mockRepo.EXPECT().GetEstateByEstateId(gomock.Any(), gomock.Any()).Return(estate, nil)
+		mockRepo.EXPECT().IsTreeExist(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+		mockRepo.EXPECT().UpdateJobProgress(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+				assert.Equal(t, repository.JobStateFailed, input.State)
+				assert.Equal(t, 0, input.FailedRows)
+				return &repository.UpdateJobProgressOutput{}, nil
+			})
+
+		m.runImport(context.Background(), job)
+	})
+}
@@ -0,0 +1,212 @@
+// This file contains the worker pool that runs background jobs.
+package job
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+var (
+	// ErrCancelled is the cause used when a user cancels a running job.
+	ErrCancelled = errors.New("job is cancelled")
+	// ErrShutdown is the cause used when a running job is interrupted by a shutdown.
+	ErrShutdown = errors.New("job is interrupted by shutdown")
+)
+
+type Manager struct {
+	Repository repository.RepositoryInterface
+
+	workers         int
+	pollInterval    time.Duration
+	staleAfter      time.Duration
+	checkpointEvery int
+
+	wakeup  chan struct{}
+	quit    chan struct{}
+	runCtx  context.Context
+	abort   context.CancelCauseFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+}
+
+type NewManagerOptions struct {
+	Repository repository.RepositoryInterface
+	// Workers is the number of jobs processed concurrently. Defaults to 2.
+	Workers int
+	// PollInterval is how often idle workers look for queued jobs, e.g. jobs queued by
+	// another instance. Defaults to 5 seconds.
+	PollInterval time.Duration
+	// StaleAfter is how long a running job may go without a checkpoint before it is
+	// considered abandoned and queued again on startup. Defaults to 1 minute.
+	StaleAfter time.Duration
+	// CheckpointEvery is the number of rows processed between two checkpoints. Defaults to 100.
+	CheckpointEvery int
+}
+
+// NewManager creates a new Manager with the provided options.
+// The manager does not process anything until Start is called, but jobs can already be
+// enqueued since they are persisted by the repository.
+func NewManager(opts NewManagerOptions) *Manager {
+	m := &Manager{
+		Repository:      opts.Repository,
+		workers:         opts.Workers,
+		pollInterval:    opts.PollInterval,
+		staleAfter:      opts.StaleAfter,
+		checkpointEvery: opts.CheckpointEvery,
+		wakeup:          make(chan struct{}, 1),
+		quit:            make(chan struct{}),
+		running:         map[string]context.CancelCauseFunc{},
+	}
+	if m.workers <= 0 {
+		m.workers = 2
+	}
+	if m.pollInterval <= 0 {
+		m.pollInterval = 5 * time.Second
+	}
+	if m.staleAfter <= 0 {
+		m.staleAfter = time.Minute
+	}
+	if m.checkpointEvery <= 0 {
+		m.checkpointEvery = 100
+	}
+	m.runCtx, m.abort = context.WithCancelCause(context.Background())
+	return m
+}
+
+// Start queues again the jobs abandoned by a previous run and launches the workers.
+func (m *Manager) Start(ctx context.Context) error {
+	output, err := m.Repository.RequeueStaleJobs(ctx, &repository.RequeueStaleJobsInput{
+		StaleBefore: time.Now().Add(-m.staleAfter),
+	})
+	if err != nil {
+		return err
+	}
+	if output.Count > 0 {
+		slog.InfoContext(ctx, "requeued stale jobs", "count", output.Count)
+	}
+
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return nil
+}
+
+// Notify wakes up an idle worker to claim the job which has just been queued, whichever it is.
+// It never blocks: the job is already persisted, so a missed notification only delays it
+// until the next poll.
+func (m *Manager) Notify() {
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel requests the cancellation of a job.
+// A queued job is cancelled immediately. A running job is interrupted right away when it runs
+// on this instance, otherwise at the next checkpoint of the instance running it.
+// If no job is found, both the output and the error are nil.
+func (m *Manager) Cancel(ctx context.Context, id string) (*repository.Job, error) {
+	output, err := m.Repository.RequestJobCancellation(ctx, &repository.RequestJobCancellationInput{Id: id})
+	if err != nil || output == nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	cancel, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		cancel(ErrCancelled)
+	}
+	return &output.Job, nil
+}
+
+// Shutdown stops claiming new jobs and waits for the running ones to finish.
+// If ctx expires first, the running jobs are interrupted and checkpointed as queued, so that
+// they resume where they stopped on the next start.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	close(m.quit)
+	// Release the context of the jobs once the workers are done, whichever way they stopped.
+	defer m.abort(ErrShutdown)
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "shutdown deadline reached, checkpointing running jobs")
+		m.abort(ErrShutdown)
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		default:
+		}
+
+		claimed := m.runNext()
+		if claimed {
+			continue
+		}
+
+		select {
+		case <-m.quit:
+			return
+		case <-m.wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and processes a single job. It reports whether a job has been claimed.
+func (m *Manager) runNext() bool {
+	output, err := m.Repository.ClaimNextJob(m.runCtx, &repository.ClaimNextJobInput{
+		Kind: repository.JobKindTreeImport,
+	})
+	if err != nil {
+		slog.ErrorContext(m.runCtx, "err claiming the next job", "error", err)
+		return false
+	}
+	if output == nil {
+		return false
+	}
+
+	job := output.Job
+	ctx, cancel := context.WithCancelCause(m.runCtx)
+	defer cancel(nil)
+
+	m.mu.Lock()
+	m.running[job.Id] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, job.Id)
+		m.mu.Unlock()
+	}()
+
+	if job.CancelRequested {
+		cancel(ErrCancelled)
+	}
+	m.runImport(ctx, &job)
+	return true
+}
@@ -0,0 +1,24 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManagerShutdown tests that a shutdown releases the context of the jobs, even when the workers stop in time.
+func TestManagerShutdown(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager(NewManagerOptions{
+		Repository: repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{}),
+	})
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Shutdown(context.Background()))
+
+	assert.ErrorIs(t, m.runCtx.Err(), context.Canceled)
+	assert.ErrorIs(t, context.Cause(m.runCtx), ErrShutdown)
+}
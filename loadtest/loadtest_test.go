@@ -0,0 +1,172 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScenario(t *testing.T) {
+	scenario, err := LoadScenario(filepath.Join("scenarios", "mixed.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "mixed", scenario.Name)
+	assert.Equal(t, Duration(10*time.Second), scenario.Stages[0].Duration)
+	// The defaults are applied.
+	assert.Equal(t, 1, scenario.Cases[0].Steps[0].Repeat)
+	assert.Equal(t, []int{http.StatusCreated}, scenario.Cases[0].Steps[0].Expect)
+	assert.Equal(t, []int{http.StatusOK}, scenario.Cases[0].Steps[2].Expect)
+
+	path := filepath.Join(t.TempDir(), "unknown.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"stages": [], "threads": 2}`), 0o600))
+	_, err = LoadScenario(path)
+	assert.ErrorContains(t, err, `unknown field "threads"`)
+}
+
+func TestScenarioValidate(t *testing.T) {
+	stages := []Stage{{Concurrency: 1, Duration: Duration(time.Second)}}
+	testCases := []struct {
+		name     string
+		scenario Scenario
+		err      string
+	}{
+		{name: "No stage", scenario: Scenario{}, err: "expected at least one stage"},
+		{name: "No concurrency", scenario: Scenario{Stages: []Stage{{Duration: Duration(time.Second)}}}, err: "stage 1: the concurrency and the duration must be positive"},
+		{name: "No case", scenario: Scenario{Stages: stages}, err: "expected at least one case"},
+		{name: "No step", scenario: Scenario{Stages: stages, Cases: []Case{{Name: "empty"}}}, err: `case "empty": expected at least one step`},
+		{
+			name:     "Unknown action",
+			scenario: Scenario{Stages: stages, Cases: []Case{{Name: "delete", Steps: []Step{{Action: "delete_estate"}}}}},
+			err:      `case "delete", step 1: unknown action "delete_estate", expected create_estate, create_tree, get_stats or get_drone_plan`,
+		},
+		{
+			name:     "No estate",
+			scenario: Scenario{Stages: stages, Cases: []Case{{Name: "stats", Steps: []Step{{Action: GetStats}}}}},
+			err:      `case "stats", step 1: get_stats needs an estate, created by an earlier step or by the setup`,
+		},
+		{
+			name:     "Negative weight",
+			scenario: Scenario{Stages: stages, Cases: []Case{{Name: "estate", Weight: -1, Steps: []Step{{Action: CreateEstate}}}}},
+			err:      `case "estate": the weight must not be negative`,
+		},
+		{
+			name:     "Negative number",
+			scenario: Scenario{Stages: stages, Setup: []Step{{Action: CreateEstate, Length: -1}}, Cases: []Case{{Steps: []Step{{Action: GetStats}}}}},
+			err:      "setup step 1: the numbers of a step must not be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, tc.scenario.Validate(), tc.err)
+		})
+	}
+
+	// The estates of the setup are shared with the cases.
+	scenario := Scenario{Stages: stages, Setup: []Step{{Action: CreateEstate}}, Cases: []Case{{Steps: []Step{{Action: GetStats}}}}}
+	assert.NoError(t, scenario.Validate())
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(latencies, 100))
+	assert.Equal(t, time.Millisecond, percentile(latencies[:1], 50))
+}
+
+func TestRunner(t *testing.T) {
+	var estates, trees atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/estate":
+			var body map[string]int
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, map[string]int{"length": 10, "width": 5}, body)
+			estates.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": uuid.NewString()})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/tree"):
+			var body map[string]int
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.LessOrEqual(t, body["x"], 10)
+			assert.LessOrEqual(t, body["y"], 5)
+			// Every other tree is planted already.
+			if trees.Add(1)%2 == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasSuffix(r.URL.Path, "/stats"):
+			w.WriteHeader(http.StatusOK)
+		case strings.HasSuffix(r.URL.Path, "/drone-plan"):
+			assert.Equal(t, "100", r.URL.Query().Get("max-distance"))
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &Scenario{
+		Name:   "test",
+		Setup:  []Step{{Action: CreateEstate, Length: 10, Width: 5}},
+		Stages: []Stage{{Concurrency: 2, Duration: Duration(200 * time.Millisecond)}},
+		Cases: []Case{
+			{Name: "plant", Steps: []Step{{Action: CreateEstate, Length: 10, Width: 5}, {Action: CreateTree, Repeat: 2}}},
+			{Name: "read", Steps: []Step{{Action: GetStats}, {Action: GetDronePlan, MaxDistance: 100}}},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+
+	report, err := NewRunner(NewRunnerOptions{BaseURL: server.URL + "/", Scenario: scenario}).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Stages, 1)
+	stage := report.Stages[0]
+	assert.Equal(t, 2, stage.Concurrency)
+	assert.Positive(t, stage.Total.Requests)
+	assert.Positive(t, stage.Total.Throughput)
+
+	actions := map[string]ActionReport{}
+	for _, action := range stage.Actions {
+		actions[action.Action] = action
+	}
+	require.Len(t, actions, 4)
+	assert.Zero(t, actions[CreateEstate].Errors)
+	// Neither the estate of the setup nor the requests cut by the end of the stage are reported.
+	assert.LessOrEqual(t, actions[CreateEstate].Requests, int(estates.Load())-1)
+	assert.InDelta(t, 0.5, actions[CreateTree].ErrorRate, 0.1)
+	assert.Equal(t, 1.0, actions[GetDronePlan].ErrorRate)
+	assert.Equal(t, map[string]int{"500": actions[GetDronePlan].Requests}, actions[GetDronePlan].Statuses)
+	assert.Zero(t, actions[GetStats].Errors)
+	assert.LessOrEqual(t, actions[GetStats].Latency.P50, actions[GetStats].Latency.Max)
+}
+
+func TestRunnerSetupFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	scenario := &Scenario{
+		Setup:  []Step{{Action: CreateEstate}},
+		Stages: []Stage{{Concurrency: 1, Duration: Duration(time.Second)}},
+		Cases:  []Case{{Steps: []Step{{Action: GetStats}}}},
+	}
+	require.NoError(t, scenario.Validate())
+	_, err := NewRunner(NewRunnerOptions{BaseURL: server.URL, Scenario: scenario}).Run(context.Background())
+	assert.EqualError(t, err, "setup step 1: create_estate returned status 500")
+}
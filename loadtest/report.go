@@ -0,0 +1,112 @@
+// This file contains the report of a run, with the latency percentiles and the error rates of every action.
+package loadtest
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Report struct {
+	Scenario string        `json:"scenario"`
+	Stages   []StageReport `json:"stages"`
+}
+
+type StageReport struct {
+	Concurrency int `json:"concurrency"`
+	// Elapsed is the measured duration of the stage, the requests cut by its end are not counted.
+	Elapsed Duration       `json:"elapsed"`
+	Total   ActionReport   `json:"total"`
+	Actions []ActionReport `json:"actions"`
+}
+
+type ActionReport struct {
+	// Action is empty for the total of a stage.
+	Action   string `json:"action,omitempty"`
+	Requests int    `json:"requests"`
+	// Errors counts the requests without a response and the responses without an expected status.
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+	Throughput float64 `json:"requests_per_second"`
+	Latency    Latency `json:"latency"`
+	// Statuses counts the responses by status, the requests without a response are counted as "error".
+	Statuses map[string]int `json:"statuses"`
+}
+
+type Latency struct {
+	Mean Duration `json:"mean"`
+	P50  Duration `json:"p50"`
+	P90  Duration `json:"p90"`
+	P95  Duration `json:"p95"`
+	P99  Duration `json:"p99"`
+	Max  Duration `json:"max"`
+}
+
+func newStageReport(stage Stage, elapsed time.Duration, samples []sample) StageReport {
+	report := StageReport{
+		Concurrency: stage.Concurrency,
+		Elapsed:     Duration(elapsed.Round(time.Millisecond)),
+		Total:       newActionReport("", elapsed, samples),
+		Actions:     []ActionReport{},
+	}
+	byAction := map[string][]sample{}
+	for _, s := range samples {
+		byAction[s.action] = append(byAction[s.action], s)
+	}
+	actions := make([]string, 0, len(byAction))
+	for action := range byAction {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		report.Actions = append(report.Actions, newActionReport(action, elapsed, byAction[action]))
+	}
+	return report
+}
+
+func newActionReport(action string, elapsed time.Duration, samples []sample) ActionReport {
+	report := ActionReport{Action: action, Requests: len(samples), Statuses: map[string]int{}}
+	if len(samples) == 0 {
+		return report
+	}
+
+	latencies := make([]time.Duration, 0, len(samples))
+	var sum time.Duration
+	for _, s := range samples {
+		if !s.ok {
+			report.Errors++
+		}
+		status := "error"
+		if s.status != 0 {
+			status = strconv.Itoa(s.status)
+		}
+		report.Statuses[status]++
+		latencies = append(latencies, s.latency)
+		sum += s.latency
+	}
+	slices.Sort(latencies)
+
+	report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	report.Throughput = math.Round(float64(report.Requests)/elapsed.Seconds()*100) / 100
+	report.Latency = Latency{
+		Mean: roundLatency(sum / time.Duration(len(latencies))),
+		P50:  roundLatency(percentile(latencies, 50)),
+		P90:  roundLatency(percentile(latencies, 90)),
+		P95:  roundLatency(percentile(latencies, 95)),
+		P99:  roundLatency(percentile(latencies, 99)),
+		Max:  roundLatency(latencies[len(latencies)-1]),
+	}
+	return report
+}
+
+// percentile returns the nearest rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func roundLatency(latency time.Duration) Duration {
+	return Duration(latency.Round(time.Microsecond))
+}
@@ -0,0 +1,252 @@
+// This file contains the runner, which sends the requests of the cases of a scenario.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+type Runner struct {
+	BaseURL  string
+	Client   *http.Client
+	Scenario *Scenario
+}
+
+type NewRunnerOptions struct {
+	// BaseURL is the URL of the API, e.g. http://localhost:1323.
+	BaseURL string
+	// Client defaults to a client keeping a connection per client of the busiest stage.
+	Client   *http.Client
+	Scenario *Scenario
+}
+
+func NewRunner(opts NewRunnerOptions) *Runner {
+	client := opts.Client
+	if client == nil {
+		maxConcurrency := 1
+		for _, stage := range opts.Scenario.Stages {
+			maxConcurrency = max(maxConcurrency, stage.Concurrency)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = maxConcurrency
+		client = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	}
+	return &Runner{
+		BaseURL:  strings.TrimSuffix(opts.BaseURL, "/"),
+		Client:   client,
+		Scenario: opts.Scenario,
+	}
+}
+
+// estate is an estate created by a create_estate step.
+type estate struct {
+	id            string
+	length, width int
+}
+
+// sample is the outcome of a request.
+type sample struct {
+	action  string
+	latency time.Duration
+	// status is 0 when no response was received, err tells why.
+	status int
+	err    error
+	ok     bool
+}
+
+// Run runs the setup and then the stages of the scenario. When ctx is cancelled, it returns the report of the
+// completed stages with the error of ctx.
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	random := rand.New(rand.NewSource(r.Scenario.Seed))
+	var pool []*estate
+	var current *estate
+	for i, step := range r.Scenario.Setup {
+		for n := 0; n < step.Repeat; n++ {
+			s, created := r.send(ctx, step, current, random)
+			if s.err != nil {
+				return nil, fmt.Errorf("setup step %d: %w", i+1, s.err)
+			}
+			if !s.ok {
+				return nil, fmt.Errorf("setup step %d: %s returned status %d", i+1, step.Action, s.status)
+			}
+			if created != nil {
+				pool, current = append(pool, created), created
+			}
+		}
+	}
+
+	report := &Report{Scenario: r.Scenario.Name}
+	for i, stage := range r.Scenario.Stages {
+		// Seeding every client differently keeps the runs reproducible without the clients repeating each other.
+		samples, elapsed := r.runStage(ctx, stage, pool, r.Scenario.Seed+int64(i+1)*1_000_003)
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Stages = append(report.Stages, newStageReport(stage, elapsed, samples))
+	}
+	return report, nil
+}
+
+// runStage runs the cases with the concurrency of the stage until its duration elapses.
+func (r *Runner) runStage(ctx context.Context, stage Stage, pool []*estate, seed int64) ([]sample, time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(stage.Duration))
+	defer cancel()
+
+	start := time.Now()
+	results := make([][]sample, stage.Concurrency)
+	var wg sync.WaitGroup
+	for client := 0; client < stage.Concurrency; client++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed + int64(client)))
+			for ctx.Err() == nil {
+				results[client] = r.runCase(ctx, r.pickCase(random), pool, random, results[client])
+			}
+		}(client)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var samples []sample
+	for _, result := range results {
+		samples = append(samples, result...)
+	}
+	return samples, elapsed
+}
+
+// pickCase picks a case at random, in proportion to the weights.
+func (r *Runner) pickCase(random *rand.Rand) *Case {
+	total := 0
+	for _, c := range r.Scenario.Cases {
+		total += c.Weight
+	}
+	pick := random.Intn(total)
+	for i := range r.Scenario.Cases {
+		if pick < r.Scenario.Cases[i].Weight {
+			return &r.Scenario.Cases[i]
+		}
+		pick -= r.Scenario.Cases[i].Weight
+	}
+	return &r.Scenario.Cases[len(r.Scenario.Cases)-1]
+}
+
+// runCase sends the steps of a case and appends their samples. The case stops at the first failed creation
+// of an estate, which the following steps need.
+func (r *Runner) runCase(ctx context.Context, c *Case, pool []*estate, random *rand.Rand, samples []sample) []sample {
+	var current *estate
+	if len(pool) > 0 {
+		current = pool[random.Intn(len(pool))]
+	}
+	for _, step := range c.Steps {
+		for n := 0; n < step.Repeat; n++ {
+			s, created := r.send(ctx, step, current, random)
+			if ctx.Err() != nil {
+				// The requests cut by the end of the stage are not counted.
+				return samples
+			}
+			samples = append(samples, s)
+			if step.Action == CreateEstate {
+				if created == nil {
+					return samples
+				}
+				current = created
+			}
+		}
+	}
+	return samples
+}
+
+// send sends a step to the estate, and returns the created estate of a successful create_estate step.
+func (r *Runner) send(ctx context.Context, step Step, target *estate, random *rand.Rand) (sample, *estate) {
+	var method, path string
+	var body any
+	var created *estate
+	switch step.Action {
+	case CreateEstate:
+		created = &estate{length: step.Length, width: step.Width}
+		if created.length == 0 {
+			created.length = 1 + random.Intn(randomDimension)
+		}
+		if created.width == 0 {
+			created.width = 1 + random.Intn(randomDimension)
+		}
+		method, path, body = http.MethodPost, "/estate", map[string]int{"length": created.length, "width": created.width}
+	case CreateTree:
+		x, y, height := step.X, step.Y, step.Height
+		if x == 0 {
+			x = 1 + random.Intn(target.length)
+		}
+		if y == 0 {
+			y = 1 + random.Intn(target.width)
+		}
+		if height == 0 {
+			height = repository.MinTreeHeight + random.Intn(repository.MaxTreeHeight-repository.MinTreeHeight+1)
+		}
+		method, path, body = http.MethodPost, "/estate/"+target.id+"/tree", map[string]int{"x": x, "y": y, "height": height}
+	case GetStats:
+		method, path = http.MethodGet, "/estate/"+target.id+"/stats"
+	case GetDronePlan:
+		method, path = http.MethodGet, "/estate/"+target.id+"/drone-plan"
+		if step.MaxDistance > 0 {
+			path += fmt.Sprintf("?max-distance=%d", step.MaxDistance)
+		}
+	}
+
+	s := sample{action: step.Action}
+	start := time.Now()
+	response, err := r.do(ctx, method, path, body)
+	if err != nil {
+		s.latency, s.err = time.Since(start), err
+		return s, nil
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Id string `json:"id"`
+	}
+	if created != nil && response.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			s.err = fmt.Errorf("err decoding the created estate: %w", err)
+		}
+	}
+	// Reading the whole body lets the client reuse the connection.
+	_, _ = io.Copy(io.Discard, response.Body)
+	s.latency, s.status = time.Since(start), response.StatusCode
+	s.ok = s.err == nil && slices.Contains(step.Expect, response.StatusCode)
+
+	if created == nil || result.Id == "" {
+		return s, nil
+	}
+	created.id = result.Id
+	return s, created
+}
+
+func (r *Runner) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, r.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	return r.Client.Do(request)
+}
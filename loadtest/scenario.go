@@ -0,0 +1,175 @@
+// Package loadtest drives the HTTP API with the concurrent clients of a scenario and reports how it holds up.
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// The actions of a step, named after the steps of the API tests.
+const (
+	CreateEstate = "create_estate"
+	CreateTree   = "create_tree"
+	GetStats     = "get_stats"
+	GetDronePlan = "get_drone_plan"
+)
+
+// randomDimension is the largest dimension of the estates created without a length or a width.
+const randomDimension = 100
+
+// Scenario is the load of a run. Like the test cases of the API tests, a case is a sequence of steps, whose
+// steps act on the estate created by the latest create_estate step of the case.
+type Scenario struct {
+	Name string `json:"name"`
+	// Seed makes the random dimensions, plots and heights, and the picked cases, the same on every run.
+	Seed int64 `json:"seed"`
+	// Setup runs once before the stages. The estates it creates are shared by the steps of the cases which run
+	// before any create_estate step, so that the read heavy cases do not need to create their own estates.
+	Setup []Step `json:"setup"`
+	// Stages run one after the other, typically with an increasing concurrency to ramp the load up.
+	Stages []Stage `json:"stages"`
+	// Cases are picked at random by the clients, in proportion to their weights.
+	Cases []Case `json:"cases"`
+}
+
+type Stage struct {
+	// Concurrency is the number of clients running cases concurrently.
+	Concurrency int      `json:"concurrency"`
+	Duration    Duration `json:"duration"`
+}
+
+type Case struct {
+	Name string `json:"name"`
+	// Weight is the relative frequency of the case, defaults to 1.
+	Weight int    `json:"weight"`
+	Steps  []Step `json:"steps"`
+}
+
+type Step struct {
+	// Action is one of the action constants.
+	Action string `json:"action"`
+	// Repeat is the number of times the step is sent in a row, defaults to 1.
+	Repeat int `json:"repeat"`
+	// Length and Width are the dimensions of the created estate, drawn at random up to 100 when 0.
+	Length int `json:"length"`
+	Width  int `json:"width"`
+	// X, Y and Height are the plot and the height of the created tree, drawn at random when 0. A random plot may
+	// be planted already, which the API rejects with a 400 status, see Expect.
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Height int `json:"height"`
+	// MaxDistance is the max-distance of the drone plan, the whole estate is planned when 0.
+	MaxDistance int `json:"max_distance"`
+	// Expect lists the statuses counted as successes, defaults to 201 for the creations and to 200 otherwise.
+	Expect []int `json:"expect"`
+}
+
+// Duration is a time.Duration written as a string in the scenario files, e.g. "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario reads and validates a JSON scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scenario); err != nil {
+		return nil, fmt.Errorf("err decoding scenario %s: %w", path, err)
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+// Validate checks the scenario and applies the defaults of the weights, repeats and expected statuses.
+func (s *Scenario) Validate() error {
+	if len(s.Stages) == 0 {
+		return errors.New("expected at least one stage")
+	}
+	for i, stage := range s.Stages {
+		if stage.Concurrency < 1 || stage.Duration <= 0 {
+			return fmt.Errorf("stage %d: the concurrency and the duration must be positive", i+1)
+		}
+	}
+	if len(s.Cases) == 0 {
+		return errors.New("expected at least one case")
+	}
+
+	hasSetupEstate := false
+	for i := range s.Setup {
+		if err := s.Setup[i].validate(hasSetupEstate); err != nil {
+			return fmt.Errorf("setup step %d: %w", i+1, err)
+		}
+		hasSetupEstate = hasSetupEstate || s.Setup[i].Action == CreateEstate
+	}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Weight == 0 {
+			c.Weight = 1
+		}
+		if c.Weight < 0 {
+			return fmt.Errorf("case %q: the weight must not be negative", c.Name)
+		}
+		if len(c.Steps) == 0 {
+			return fmt.Errorf("case %q: expected at least one step", c.Name)
+		}
+		hasEstate := hasSetupEstate
+		for j := range c.Steps {
+			if err := c.Steps[j].validate(hasEstate); err != nil {
+				return fmt.Errorf("case %q, step %d: %w", c.Name, j+1, err)
+			}
+			hasEstate = hasEstate || c.Steps[j].Action == CreateEstate
+		}
+	}
+	return nil
+}
+
+func (s *Step) validate(hasEstate bool) error {
+	switch s.Action {
+	case CreateEstate, CreateTree, GetStats, GetDronePlan:
+	default:
+		return fmt.Errorf("unknown action %q, expected %s, %s, %s or %s", s.Action, CreateEstate, CreateTree, GetStats, GetDronePlan)
+	}
+	if s.Action != CreateEstate && !hasEstate {
+		return fmt.Errorf("%s needs an estate, created by an earlier step or by the setup", s.Action)
+	}
+	if s.Repeat == 0 {
+		s.Repeat = 1
+	}
+	if s.Repeat < 0 || s.Length < 0 || s.Width < 0 || s.X < 0 || s.Y < 0 || s.Height < 0 || s.MaxDistance < 0 {
+		return errors.New("the numbers of a step must not be negative")
+	}
+	if len(s.Expect) == 0 {
+		s.Expect = []int{http.StatusOK}
+		if s.Action == CreateEstate || s.Action == CreateTree {
+			s.Expect = []int{http.StatusCreated}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package logging configures the structured logs of the service, and correlates them with the requests they
+// belong to.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats of the logs.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Attribute keys added to the records logged within a request.
+const (
+	RequestIDKey = "request_id"
+	TraceIDKey   = "trace_id"
+)
+
+// redacted replaces the secrets in the logs.
+const redacted = "REDACTED"
+
+var (
+	ErrUnsupportedLevel  = errors.New("unsupported log level")
+	ErrUnsupportedFormat = errors.New("unsupported log format")
+)
+
+// sensitiveKeys are the keys of the attributes whose values are secrets, or connection strings holding secrets.
+var sensitiveKeys = map[string]bool{
+	"dsn":          true,
+	"database_url": true,
+	"password":     true,
+	"secret":       true,
+	"token":        true,
+}
+
+type NewLoggerOptions struct {
+	// Level is one of debug, info, warn or error, defaults to info.
+	Level string
+	// Format is one of the Format constants, defaults to FormatJSON.
+	Format string
+	// Writer defaults to the standard error.
+	Writer io.Writer
+}
+
+// NewLogger creates a logger which adds the request ID and the trace ID of the context to the records, and
+// redacts the sensitive attributes.
+func NewLogger(opts NewLoggerOptions) (*slog.Logger, error) {
+	var level slog.Level
+	if opts.Level != "" {
+		if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return nil, fmt.Errorf("%w %q, expected one of debug, info, warn or error", ErrUnsupportedLevel, opts.Level)
+		}
+	}
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stderr
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch opts.Format {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(writer, handlerOpts)
+	case FormatText:
+		handler = slog.NewTextHandler(writer, handlerOpts)
+	default:
+		return nil, fmt.Errorf("%w %q, expected one of %s or %s", ErrUnsupportedFormat, opts.Format, FormatJSON, FormatText)
+	}
+	return slog.New(contextHandler{Handler: handler}), nil
+}
+
+// contextHandler adds the request ID and the trace ID of the context of the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		record.AddAttrs(slog.String(TraceIDKey, span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redactAttr masks the values of the sensitive attributes, and the passwords of the connection strings logged
+// in the errors.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		if attr.Value.Kind() == slog.KindString && strings.Contains(attr.Value.String(), "://") {
+			return slog.String(attr.Key, config.RedactDSN(attr.Value.String()))
+		}
+		return slog.String(attr.Key, redacted)
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, config.RedactDSN(err.Error()))
+		}
+	}
+	return attr
+}
@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// records decodes the JSON lines of out.
+func records(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    NewLoggerOptions
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "Defaults to JSON at the info level",
+			want: []string{`"level":"INFO","msg":"info"`, `"level":"WARN","msg":"warn"`},
+		},
+		{
+			name: "Debug level",
+			opts: NewLoggerOptions{Level: "debug"},
+			want: []string{`"msg":"debug"`, `"msg":"info"`, `"msg":"warn"`},
+		},
+		{
+			name: "Text format at the warn level",
+			opts: NewLoggerOptions{Level: "WARN", Format: FormatText},
+			want: []string{"level=WARN msg=warn"},
+		},
+		{
+			name:    "Unsupported level",
+			opts:    NewLoggerOptions{Level: "verbose"},
+			wantErr: ErrUnsupportedLevel,
+		},
+		{
+			name:    "Unsupported format",
+			opts:    NewLoggerOptions{Format: "xml"},
+			wantErr: ErrUnsupportedFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			tt.opts.Writer = out
+			logger, err := NewLogger(tt.opts)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			require.Len(t, lines, len(tt.want), out.String())
+			for i, want := range tt.want {
+				assert.Contains(t, lines[i], want)
+			}
+		})
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(NewLoggerOptions{Writer: out})
+	require.NoError(t, err)
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "abc-123"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	logger.With("component", "repository").ErrorContext(ctx, "err executing query", "error", errors.New("timeout"))
+	logger.Info("outside of a request")
+
+	logged := records(t, out)
+	require.Len(t, logged, 2)
+	assert.Equal(t, "abc-123", logged[0][RequestIDKey])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logged[0][TraceIDKey])
+	assert.Equal(t, "repository", logged[0]["component"])
+	assert.Equal(t, "timeout", logged[0]["error"])
+	assert.NotContains(t, logged[1], RequestIDKey)
+	assert.NotContains(t, logged[1], TraceIDKey)
+}
+
+func TestRedaction(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(NewLoggerOptions{Writer: out})
+	require.NoError(t, err)
+
+	logger.Info("connecting", "dsn", "postgres://postgres:s3cr3t@db:5432/database?sslmode=disable")
+	logger.Info("connecting", "dsn", "host=db user=postgres password=s3cr3t")
+	logger.Info("login", "Password", "s3cr3t")
+	logger.Error("err connecting", "error", errors.New(`dial postgres://app:s3cr3t@db:5432/database: connection refused`))
+
+	assert.NotContains(t, out.String(), "s3cr3t")
+	logged := records(t, out)
+	require.Len(t, logged, 4)
+	assert.Equal(t, "postgres://postgres:REDACTED@db:5432/database?sslmode=disable", logged[0]["dsn"])
+	assert.Equal(t, "REDACTED", logged[1]["dsn"])
+	assert.Equal(t, "REDACTED", logged[2]["Password"])
+	assert.Equal(t, "dial postgres://app:REDACTED@db:5432/database: connection refused", logged[3]["error"])
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(RequestIDMiddleware())
+	var seen string
+	e.GET("/", func(c echo.Context) error {
+		seen = RequestID(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		header    string
+		propagate bool
+	}{
+		{name: "Propagated", header: "req-42", propagate: true},
+		{name: "Generated when missing"},
+		{name: "Generated when too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "Generated when it forges log lines", header: "req-42\nlevel=ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				request.Header.Set(HeaderRequestID, tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, request)
+
+			id := recorder.Header().Get(HeaderRequestID)
+			assert.Equal(t, id, seen)
+			if tt.propagate {
+				assert.Equal(t, tt.header, id)
+			} else {
+				assert.Len(t, id, 36)
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(NewLoggerOptions{Writer: out})
+	require.NoError(t, err)
+	e := echo.New()
+	e.Use(RequestIDMiddleware(), RequestLogger(logger))
+	e.GET("/estate/:estate_id/stats", func(c echo.Context) error {
+		if c.Param("estate_id") == "broken" {
+			return echo.NewHTTPError(http.StatusInternalServerError, "db down")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/estate/a/stats", nil)
+	request.Header.Set(HeaderRequestID, "req-42")
+	e.ServeHTTP(httptest.NewRecorder(), request)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/estate/broken/stats", nil))
+
+	logged := records(t, out)
+	require.Len(t, logged, 2)
+	assert.Equal(t, slog.LevelInfo.String(), logged[0]["level"])
+	assert.Equal(t, "req-42", logged[0][RequestIDKey])
+	assert.Equal(t, "/estate/:estate_id/stats", logged[0]["route"])
+	assert.Equal(t, float64(http.StatusOK), logged[0]["status"])
+	assert.Equal(t, slog.LevelError.String(), logged[1]["level"])
+	assert.NotEmpty(t, logged[1][RequestIDKey])
+	assert.Contains(t, logged[1]["error"], "db down")
+}
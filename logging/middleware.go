@@ -0,0 +1,96 @@
+// This file contains the middlewares correlating the logs of a request.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// HeaderRequestID is the header of the ID of a request, set by the callers or by RequestIDMiddleware.
+const HeaderRequestID = echo.HeaderXRequestID
+
+// maxRequestIDLength bounds the length of the propagated IDs, which end up in every log of the request.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, empty when there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware propagates the X-Request-ID header of the requests, or generates a new ID when the header
+// is missing or invalid. The ID is echoed in the response, and carried by the context of the request so that
+// every log of the request, down to the repository, holds it.
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			id := request.Header.Get(HeaderRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+			c.Response().Header().Set(HeaderRequestID, id)
+			c.SetRequest(request.WithContext(WithRequestID(request.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+// validRequestID tells whether id is short and only made of printable ASCII characters, so that it cannot forge
+// log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger logs every request once it is served, at the error level for the server errors.
+func RequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			if v.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency.Round(time.Microsecond)),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.Any("error", v.Error))
+			}
+			logger.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,163 @@
+// Package metrics exposes the metrics of the service in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/planner"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute is the route label of the requests which match no route, so that the paths of the unknown
+// routes do not each create a series.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	dbQueryDuration     *prometheus.HistogramVec
+	plannerDuration     prometheus.Histogram
+	plannerPlotsVisited prometheus.Histogram
+	plannerEstatePlots  prometheus.Histogram
+	estatesCreated      prometheus.Counter
+	treesCreated        prometheus.Counter
+}
+
+type NewMetricsOptions struct {
+	// Registry defaults to a new registry holding the Go runtime and process collectors.
+	Registry *prometheus.Registry
+}
+
+func NewMetrics(opts NewMetricsOptions) *Metrics {
+	registry := opts.Registry
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	// The estates go from a single plot to 50000 x 50000 plots.
+	plotBuckets := prometheus.ExponentialBuckets(1, 10, 10)
+
+	m := &Metrics{
+		Registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of the HTTP requests by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Latency of the repository methods by method and outcome, ok or error.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"method", "outcome"}),
+		plannerDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "drone_planner_duration_seconds",
+			Help:    "Duration of the computation of a drone plan.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		plannerPlotsVisited: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "drone_planner_plots_visited",
+			Help:    "Number of plots the drone flies over in a drone plan.",
+			Buckets: plotBuckets,
+		}),
+		plannerEstatePlots: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "drone_planner_estate_plots",
+			Help:    "Number of plots of the estates of the drone plans.",
+			Buckets: plotBuckets,
+		}),
+		estatesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "estates_created_total",
+			Help: "Number of estates created, including the estates merged into an estate of the same dimensions.",
+		}),
+		treesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "trees_created_total",
+			Help: "Number of trees created, by the API or by the imports.",
+		}),
+	}
+	registry.MustRegister(m.httpRequests, m.httpRequestDuration, m.dbQueryDuration, m.plannerDuration,
+		m.plannerPlotsVisited, m.plannerEstatePlots, m.estatesCreated, m.treesCreated)
+	return m
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware counts the requests and measures their latency. The route label is the path template of the
+// matched route, e.g. /estate/:estate_id/stats, to keep the number of series bounded.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				// Write the error response now, so that its status is known.
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" || c.Response().Status == http.StatusNotFound && route == "/*" {
+				route = unmatchedRoute
+			}
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(c.Response().Status),
+			}
+			m.httpRequests.With(labels).Inc()
+			m.httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+// ObservePlan records the metrics of a computed drone plan, see handler.PlanObserver.
+func (m *Metrics) ObservePlan(estate planner.Estate, plan *planner.Plan, elapsed time.Duration) {
+	m.plannerDuration.Observe(elapsed.Seconds())
+	m.plannerPlotsVisited.Observe(float64(planner.VisitedPlots(estate, plan)))
+	m.plannerEstatePlots.Observe(float64(estate.Length) * float64(estate.Width))
+}
+
+// ObservePlanCache exposes the counters of the drone plan cache, read from its Stats when the metrics are scraped.
+// It must be called once per registry.
+func (m *Metrics) ObservePlanCache(cache *plancache.Cache) {
+	counter := func(name, help string, value func(stats plancache.Stats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(cache.Stats()))
+		})
+	}
+	m.Registry.MustRegister(
+		counter("drone_plan_cache_hits_total", "Number of drone plans served from the memory of the plan cache.",
+			func(stats plancache.Stats) int64 { return stats.Hits }),
+		counter("drone_plan_cache_persistent_hits_total", "Number of drone plans served from the persistent tier of the plan cache.",
+			func(stats plancache.Stats) int64 { return stats.PersistentHits }),
+		counter("drone_plan_cache_misses_total", "Number of drone plans missing from the plan cache.",
+			func(stats plancache.Stats) int64 { return stats.Misses }),
+		counter("drone_plan_cache_evictions_total", "Number of drone plans evicted from the memory of the plan cache.",
+			func(stats plancache.Stats) int64 { return stats.Evictions }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "drone_plan_cache_size",
+			Help: "Number of drone plans in the memory of the plan cache.",
+		}, func() float64 { return float64(cache.Stats().Size) }),
+	)
+}
+
+// observeQuery records the latency of a repository method.
+func (m *Metrics) observeQuery(method string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.dbQueryDuration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
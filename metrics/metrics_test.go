@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/plancache"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/planner"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/estate/:estate_id/stats", func(c echo.Context) error {
+		if c.Param("estate_id") == "missing" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, path := range []string{"/estate/a/stats", "/estate/b/stats", "/estate/missing/stats", "/unknown"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/estate/:estate_id/stats", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/estate/:estate_id/stats", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.httpRequestDuration))
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+	repo := NewRepository(NewRepositoryOptions{
+		Repository: repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{}),
+		Metrics:    m,
+	})
+
+	estate, err := repo.CreateEstate(ctx, &repository.CreateEstateInput{Id: "8d5a0a55-8b1f-4c9b-9d31-bd1d8f0b3f47", Length: 10, Width: 10})
+	require.NoError(t, err)
+	_, err = repo.CreateTree(ctx, &repository.CreateTreeInput{Id: "53c6b5a1-0b8e-4ac0-8f6e-3a5a7c2d4b9e", EstateId: estate.Id, X: 1, Y: 1, Height: 5})
+	require.NoError(t, err)
+	_, err = repo.GetEstateTreesByEstateId(ctx, &repository.GetEstateTreesByEstateIdInput{EstateId: estate.Id})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.estatesCreated))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.treesCreated))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.dbQueryDuration))
+
+	t.Run("Error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockRepo := repository.NewMockRepositoryInterface(ctrl)
+		mockRepo.EXPECT().CreateTree(gomock.Any(), gomock.Any()).Return(nil, errors.New("db down"))
+		repo := NewRepository(NewRepositoryOptions{Repository: mockRepo, Metrics: m})
+
+		_, err := repo.CreateTree(ctx, &repository.CreateTreeInput{})
+		assert.EqualError(t, err, "db down")
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.treesCreated))
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Contains(t, recorder.Body.String(), `db_query_duration_seconds_count{method="CreateTree",outcome="error"} 1`)
+	})
+}
+
+func TestObservePlan(t *testing.T) {
+	m := NewMetrics(NewMetricsOptions{})
+	estate := planner.Estate{Length: 5, Width: 4}
+	m.ObservePlan(estate, &planner.Plan{Rest: planner.Plot{X: 4, Y: 2}, Outcome: planner.Partial}, 2*time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, "drone_planner_duration_seconds_sum 0.002\n")
+	assert.Contains(t, body, "drone_planner_plots_visited_sum 7\n")
+	assert.Contains(t, body, "drone_planner_estate_plots_sum 20\n")
+	// The default registry also holds the runtime metrics.
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
+
+func TestObservePlanCache(t *testing.T) {
+	ctx := context.Background()
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+	cache := plancache.NewCache(plancache.NewCacheOptions{Size: 1})
+	m.ObservePlanCache(cache)
+
+	first := plancache.Key{EstateId: "8d5a0a55-8b1f-4c9b-9d31-bd1d8f0b3f47", ScaleFactor: 10}
+	second := plancache.Key{EstateId: "53c6b5a1-0b8e-4ac0-8f6e-3a5a7c2d4b9e", ScaleFactor: 10}
+	cache.Get(ctx, first)
+	cache.Put(ctx, first, repository.CalculateDroneDistanceOutput{TotalDistance: 10})
+	cache.Get(ctx, first)
+	cache.Put(ctx, second, repository.CalculateDroneDistanceOutput{TotalDistance: 20})
+
+	expected := `
+# HELP drone_plan_cache_evictions_total Number of drone plans evicted from the memory of the plan cache.
+# TYPE drone_plan_cache_evictions_total counter
+drone_plan_cache_evictions_total 1
+# HELP drone_plan_cache_hits_total Number of drone plans served from the memory of the plan cache.
+# TYPE drone_plan_cache_hits_total counter
+drone_plan_cache_hits_total 1
+# HELP drone_plan_cache_misses_total Number of drone plans missing from the plan cache.
+# TYPE drone_plan_cache_misses_total counter
+drone_plan_cache_misses_total 1
+# HELP drone_plan_cache_size Number of drone plans in the memory of the plan cache.
+# TYPE drone_plan_cache_size gauge
+drone_plan_cache_size 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.Registry, strings.NewReader(expected),
+		"drone_plan_cache_evictions_total", "drone_plan_cache_hits_total", "drone_plan_cache_misses_total", "drone_plan_cache_size"))
+}
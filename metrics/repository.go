@@ -0,0 +1,167 @@
+// This file contains the decorator of the repository, which measures the latency of its methods.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+// Repository measures the latency of every method of the wrapped repository, and counts the created estates
+// and trees, so that the handlers and the jobs are instrumented without any change.
+type Repository struct {
+	Next    repository.RepositoryInterface
+	Metrics *Metrics
+}
+
+type NewRepositoryOptions struct {
+	Repository repository.RepositoryInterface
+	Metrics    *Metrics
+}
+
+func NewRepository(opts NewRepositoryOptions) *Repository {
+	return &Repository{
+		Next:    opts.Repository,
+		Metrics: opts.Metrics,
+	}
+}
+
+func (r *Repository) CreateEstate(ctx context.Context, input *repository.CreateEstateInput) (*repository.CreateEstateOutput, error) {
+	start := time.Now()
+	output, err := r.Next.CreateEstate(ctx, input)
+	r.Metrics.observeQuery("CreateEstate", start, err)
+	if err == nil {
+		r.Metrics.estatesCreated.Inc()
+	}
+	return output, err
+}
+
+func (r *Repository) GetEstateByEstateId(ctx context.Context, input *repository.GetEstateByEstateIdInput) (*repository.GetEstateByEstateIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetEstateByEstateId(ctx, input)
+	r.Metrics.observeQuery("GetEstateByEstateId", start, err)
+	return output, err
+}
+
+func (r *Repository) IsTreeExist(ctx context.Context, input *repository.IsTreeExistInput) (*repository.IsTreeExistOutput, error) {
+	start := time.Now()
+	output, err := r.Next.IsTreeExist(ctx, input)
+	r.Metrics.observeQuery("IsTreeExist", start, err)
+	return output, err
+}
+
+func (r *Repository) CreateTree(ctx context.Context, input *repository.CreateTreeInput) (*repository.CreateTreeOutput, error) {
+	start := time.Now()
+	output, err := r.Next.CreateTree(ctx, input)
+	r.Metrics.observeQuery("CreateTree", start, err)
+	if err == nil {
+		r.Metrics.treesCreated.Inc()
+	}
+	return output, err
+}
+
+func (r *Repository) GetTreeByTreeId(ctx context.Context, input *repository.GetTreeByTreeIdInput) (*repository.GetTreeByTreeIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetTreeByTreeId(ctx, input)
+	r.Metrics.observeQuery("GetTreeByTreeId", start, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateStatsByEstateId(ctx context.Context, input *repository.GetEstateStatsByEstateIdInput) (*repository.GetEstateStatsByEstateIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetEstateStatsByEstateId(ctx, input)
+	r.Metrics.observeQuery("GetEstateStatsByEstateId", start, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateStatsSeriesByEstateId(ctx context.Context, input *repository.GetEstateStatsSeriesByEstateIdInput) (*repository.GetEstateStatsSeriesByEstateIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetEstateStatsSeriesByEstateId(ctx, input)
+	r.Metrics.observeQuery("GetEstateStatsSeriesByEstateId", start, err)
+	return output, err
+}
+
+func (r *Repository) GetPortfolioStats(ctx context.Context, input *repository.GetPortfolioStatsInput) (*repository.GetPortfolioStatsOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetPortfolioStats(ctx, input)
+	r.Metrics.observeQuery("GetPortfolioStats", start, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateGroupedStatsByEstateId(ctx context.Context, input *repository.GetEstateGroupedStatsByEstateIdInput) (*repository.GetEstateGroupedStatsByEstateIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetEstateGroupedStatsByEstateId(ctx, input)
+	r.Metrics.observeQuery("GetEstateGroupedStatsByEstateId", start, err)
+	return output, err
+}
+
+func (r *Repository) GetDronePlan(ctx context.Context, input *repository.GetDronePlanInput) (*repository.GetDronePlanOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetDronePlan(ctx, input)
+	r.Metrics.observeQuery("GetDronePlan", start, err)
+	return output, err
+}
+
+func (r *Repository) SaveDronePlan(ctx context.Context, input *repository.SaveDronePlanInput) (*repository.SaveDronePlanOutput, error) {
+	start := time.Now()
+	output, err := r.Next.SaveDronePlan(ctx, input)
+	r.Metrics.observeQuery("SaveDronePlan", start, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *repository.GetEstateTreesByEstateIdInput) (*repository.GetEstateTreesByEstateIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetEstateTreesByEstateId(ctx, input)
+	r.Metrics.observeQuery("GetEstateTreesByEstateId", start, err)
+	return output, err
+}
+
+func (r *Repository) CreateJob(ctx context.Context, input *repository.CreateJobInput) (*repository.CreateJobOutput, error) {
+	start := time.Now()
+	output, err := r.Next.CreateJob(ctx, input)
+	r.Metrics.observeQuery("CreateJob", start, err)
+	return output, err
+}
+
+func (r *Repository) GetJobByJobId(ctx context.Context, input *repository.GetJobByJobIdInput) (*repository.GetJobByJobIdOutput, error) {
+	start := time.Now()
+	output, err := r.Next.GetJobByJobId(ctx, input)
+	r.Metrics.observeQuery("GetJobByJobId", start, err)
+	return output, err
+}
+
+func (r *Repository) ClaimNextJob(ctx context.Context, input *repository.ClaimNextJobInput) (*repository.ClaimNextJobOutput, error) {
+	start := time.Now()
+	output, err := r.Next.ClaimNextJob(ctx, input)
+	r.Metrics.observeQuery("ClaimNextJob", start, err)
+	return output, err
+}
+
+func (r *Repository) UpdateJobProgress(ctx context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+	start := time.Now()
+	output, err := r.Next.UpdateJobProgress(ctx, input)
+	r.Metrics.observeQuery("UpdateJobProgress", start, err)
+	return output, err
+}
+
+func (r *Repository) RequestJobCancellation(ctx context.Context, input *repository.RequestJobCancellationInput) (*repository.RequestJobCancellationOutput, error) {
+	start := time.Now()
+	output, err := r.Next.RequestJobCancellation(ctx, input)
+	r.Metrics.observeQuery("RequestJobCancellation", start, err)
+	return output, err
+}
+
+func (r *Repository) RequeueStaleJobs(ctx context.Context, input *repository.RequeueStaleJobsInput) (*repository.RequeueStaleJobsOutput, error) {
+	start := time.Now()
+	output, err := r.Next.RequeueStaleJobs(ctx, input)
+	r.Metrics.observeQuery("RequeueStaleJobs", start, err)
+	return output, err
+}
+
+func (r *Repository) ExportEstateTrees(ctx context.Context, input *repository.ExportEstateTreesInput) (*repository.ExportEstateTreesOutput, error) {
+	start := time.Now()
+	output, err := r.Next.ExportEstateTrees(ctx, input)
+	r.Metrics.observeQuery("ExportEstateTrees", start, err)
+	return output, err
+}
@@ -0,0 +1,297 @@
+// This file contains the versioned migrations of the PostgreSQL schema.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// embedded holds the migrations shipped with the binary.
+//
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// lockKey identifies the advisory lock which serialises the migrations of concurrent instances.
+const lockKey int64 = 0x706c616e74 // "plant"
+
+// fileName matches the files of a migration, e.g. 0001_create_plantation_schema.up.sql.
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change of the schema, with the statements applying it and reverting it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies the migrations to a PostgreSQL database, recording the applied versions in the
+// schema_migrations table.
+//
+// Every migration runs in a transaction together with its record, so that a failed migration leaves
+// nothing behind. Instances migrating the same database at once wait for each other on an advisory lock.
+type Migrator struct {
+	Db *sql.DB
+
+	migrations []Migration
+}
+
+type NewMigratorOptions struct {
+	Db *sql.DB
+	// Migrations holds the NNNN_name.up.sql and NNNN_name.down.sql files of the migrations.
+	// Defaults to the migrations embedded in the binary.
+	Migrations fs.FS
+}
+
+// NewMigrator creates a new Migrator with the provided options.
+// It returns an error when a migration is missing one of its files or when two migrations share a version.
+func NewMigrator(opts NewMigratorOptions) (*Migrator, error) {
+	files := opts.Migrations
+	if files == nil {
+		files, _ = fs.Sub(embedded, "migrations")
+	}
+	migrations, err := readMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		Db:         opts.Db,
+		migrations: migrations,
+	}, nil
+}
+
+// readMigrations reads the migrations of the top directory of files, sorted by version.
+func readMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("err invalid migration version in %s", entry.Name())
+		}
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("err migrations %s and %s share version %d", migration.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("err migration %d %s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the known migrations, sorted by version.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration{}, m.migrations...)
+}
+
+// Latest returns the version of the newest known migration, 0 when there is none.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the newest applied version, 0 when no migration is applied.
+func (m *Migrator) Version(ctx context.Context) (version int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		for v := range applied {
+			version = max(version, v)
+		}
+		return err
+	})
+	return version, err
+}
+
+// AppliedVersion returns the newest applied version like Version, but reads it without taking the lock nor
+// creating the schema_migrations table, so that it can be polled while another instance migrates. It returns 0
+// when the table does not exist yet.
+func (m *Migrator) AppliedVersion(ctx context.Context) (int, error) {
+	var exists bool
+	if err := m.Db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		slog.ErrorContext(ctx, "err executing query to find the schema_migrations table", "error", err)
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	if err := m.Db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the applied version", "error", err)
+		return 0, err
+	}
+	return version, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if versions[migration.Version] {
+				continue
+			}
+			record := `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, NOW())`
+			if err = run(ctx, conn, migration.Up, record, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("err applying migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			slog.InfoContext(ctx, "applied migration", "version", migration.Version, "name", migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the steps newest applied migrations, newest first, and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		sorted := make([]int, 0, len(versions))
+		for version := range versions {
+			sorted = append(sorted, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+		for i := 0; i < steps && i < len(sorted); i++ {
+			migration, ok := m.find(sorted[i])
+			if !ok {
+				return fmt.Errorf("err migration %d is applied but unknown to this binary", sorted[i])
+			}
+			record := `DELETE FROM schema_migrations WHERE version = $1`
+			if err = run(ctx, conn, migration.Down, record, migration.Version); err != nil {
+				return fmt.Errorf("err reverting migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			slog.InfoContext(ctx, "reverted migration", "version", migration.Version, "name", migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on a connection holding the advisory lock, once the schema_migrations table exists.
+// The lock belongs to the session, so every statement of fn has to go through conn.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "err getting a connection to migrate the database", "error", err)
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		slog.ErrorContext(ctx, "err acquiring the migration lock", "error", err)
+		return err
+	}
+	defer func() {
+		// Release the lock even when ctx is done, the connection goes back to the pool.
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			slog.ErrorContext(ctx, "err releasing the migration lock", "error", err)
+		}
+	}()
+
+	sqlStatement := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL,
+
+			CONSTRAINT schema_migration_pk PRIMARY KEY (version)
+		);
+   `
+	if _, err = conn.ExecContext(ctx, sqlStatement); err != nil {
+		slog.ErrorContext(ctx, "err creating the schema_migrations table", "error", err)
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedVersions reads the versions recorded in schema_migrations.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the applied migrations", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		versions[version] = true
+	}
+	return versions, rows.Err()
+}
+
+// run executes the statements of a migration and then record with args, in a single transaction.
+func run(ctx context.Context, conn *sql.Conn, statements, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Without arguments the statements are sent as a single simple query, which may hold several of them.
+	if _, err = tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,257 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMigratorEmbedded(t *testing.T) {
+	m, err := NewMigrator(NewMigratorOptions{})
+	require.NoError(t, err)
+
+	migrations := m.Migrations()
+	require.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, "versions are numbered without gaps")
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+	assert.Equal(t, "create_plantation_schema", migrations[0].Name)
+	assert.Equal(t, len(migrations), m.Latest())
+}
+
+func TestNewMigratorFiles(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	testCases := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "Sorted by version",
+			files: fstest.MapFS{
+				"0010_c.up.sql":   file("C"),
+				"0010_c.down.sql": file("-C"),
+				"0002_b.up.sql":   file("B"),
+				"0002_b.down.sql": file("-B"),
+				"0001_a.up.sql":   file("A"),
+				"0001_a.down.sql": file("-A"),
+				"README.md":       file("ignored"),
+			},
+			versions: []int{1, 2, 10},
+		},
+		{
+			name:     "Empty",
+			files:    fstest.MapFS{},
+			versions: []int{},
+		},
+		{
+			name: "Missing down",
+			files: fstest.MapFS{
+				"0001_a.up.sql": file("A"),
+			},
+			err: "err migration 1 a needs both an up and a down file",
+		},
+		{
+			name: "Shared version",
+			files: fstest.MapFS{
+				"0001_a.up.sql":   file("A"),
+				"0001_a.down.sql": file("-A"),
+				"0001_b.up.sql":   file("B"),
+			},
+			err: "err migrations a and b share version 1",
+		},
+		{
+			name: "Version 0",
+			files: fstest.MapFS{
+				"0000_a.up.sql": file("A"),
+			},
+			err: "err invalid migration version in 0000_a.up.sql",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMigrator(NewMigratorOptions{Migrations: tc.files})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			versions := []int{}
+			for _, migration := range m.Migrations() {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tc.versions, versions)
+		})
+	}
+}
+
+// TestMigratorPostgres migrates the database of TEST_DATABASE_URL. It is skipped when the variable is not set.
+func TestMigratorPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Instances starting together apply every migration once.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := NewMigrator(NewMigratorOptions{Db: db})
+			if err == nil {
+				_, err = m.Up(ctx)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	m, err := NewMigrator(NewMigratorOptions{Db: db})
+	require.NoError(t, err)
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+	version, err = m.AppliedVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// The newest migration can be reverted and applied again.
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, m.Latest(), reverted[0].Version)
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest()-1, version)
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, m.Latest(), applied[0].Version)
+}
+
+// baselineSchema is the former database.sql script, which initialized the databases before the migrations.
+const baselineSchema = `
+CREATE SCHEMA plantation_management_service;
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.estates (
+	id UUID NOT NULL,
+	length INTEGER NOT NULL CHECK (length BETWEEN 1 AND 50000),
+	width INTEGER NOT NULL CHECK (width BETWEEN 1 AND 50000),
+	created_at TIMESTAMPTZ NOT NULL,
+
+	CONSTRAINT estate_pk PRIMARY KEY (id),
+	CONSTRAINT estates_unique_keys UNIQUE (length, width)
+);
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.trees (
+	id UUID NOT NULL,
+	estate_id UUID NOT NULL,
+	x INTEGER NOT NULL,
+	y INTEGER NOT NULL,
+	height SMALLINT NOT NULL CHECK (height BETWEEN 1 AND 30),
+	created_at TIMESTAMPTZ NOT NULL,
+
+	CONSTRAINT tree_pk PRIMARY KEY (id),
+	CONSTRAINT trees_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES plantation_management_service.estates(id)
+);
+`
+
+// TestMigratorPostgresBaseline migrates a database initialized with the baseline schema. The database is created
+// next to the database of TEST_DATABASE_URL, so that the other tests keep theirs. It is skipped when the variable
+// is not set.
+func TestMigratorPostgresBaseline(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	baselineURL, err := url.Parse(dsn)
+	if err != nil || baselineURL.Scheme == "" {
+		t.Skip("TEST_DATABASE_URL is not a URL")
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	name := fmt.Sprintf("migration_baseline_%d", time.Now().UnixNano())
+	_, err = admin.ExecContext(ctx, "CREATE DATABASE "+name)
+	require.NoError(t, err)
+	baselineURL.Path = "/" + name
+	db, err := sql.Open("postgres", baselineURL.String())
+	require.NoError(t, err)
+	defer func() {
+		db.Close()
+		_, err := admin.ExecContext(ctx, "DROP DATABASE IF EXISTS "+name)
+		assert.NoError(t, err)
+	}()
+
+	_, err = db.ExecContext(ctx, baselineSchema)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO plantation_management_service.estates (id, length, width, created_at)
+		VALUES ('7f1a3c2e-5b4d-4e6f-8a9b-0c1d2e3f4a5b', 10, 20, NOW())
+	`)
+	require.NoError(t, err)
+
+	m, err := NewMigrator(NewMigratorOptions{Db: db})
+	require.NoError(t, err)
+	// The version is read without creating the schema_migrations table.
+	version, err := m.AppliedVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+	var exists bool
+	err = db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(m.Migrations()))
+
+	// The existing estates get the default revision.
+	var revision int64
+	err = db.QueryRowContext(ctx, `SELECT revision FROM plantation_management_service.estates`).Scan(&revision)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), revision)
+
+	for _, table := range []string{"jobs", "drone_plans"} {
+		var exists bool
+		err = db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, "plantation_management_service."+table).Scan(&exists)
+		require.NoError(t, err)
+		assert.True(t, exists, table)
+	}
+
+	// The migrations can be reverted down to the empty database.
+	reverted, err := m.Down(ctx, len(m.Migrations()))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(m.Migrations()))
+}
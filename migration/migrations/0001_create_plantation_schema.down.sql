@@ -0,0 +1,11 @@
+-- This reverts the first migration, dropping the tables and all their data.
+
+DROP TABLE IF EXISTS plantation_management_service.drone_plans;
+
+DROP TABLE IF EXISTS plantation_management_service.jobs;
+
+DROP TABLE IF EXISTS plantation_management_service.trees;
+
+DROP TABLE IF EXISTS plantation_management_service.estates;
+
+DROP SCHEMA IF EXISTS plantation_management_service;
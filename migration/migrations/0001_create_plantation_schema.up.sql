@@ -0,0 +1,75 @@
+-- This is the first migration of the database schema, which creates the initial tables.
+-- We will evaluate you based on how well you design your database.
+-- 1. How you design the tables.
+-- 2. How you choose the data types and keys.
+-- 3. How you name the fields.
+-- In this assignment we will use PostgreSQL as the database.
+-- It only creates what is missing, so that it can be applied to a database initialized before the migrations
+-- with the former database.sql script, which created the schema, the estates without revision and the trees.
+
+CREATE SCHEMA IF NOT EXISTS plantation_management_service;
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.estates (
+	id UUID NOT NULL,
+	length INTEGER NOT NULL CHECK (length BETWEEN 1 AND 50000),
+	width INTEGER NOT NULL CHECK (width BETWEEN 1 AND 50000),
+	created_at TIMESTAMPTZ NOT NULL,
+	revision BIGINT NOT NULL DEFAULT 0,
+    
+	CONSTRAINT estate_pk PRIMARY KEY (id),
+	CONSTRAINT estates_unique_keys UNIQUE (length, width)
+);
+
+-- The estates created by the former database.sql script have no revision.
+ALTER TABLE plantation_management_service.estates ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.trees (
+	id UUID NOT NULL,
+	estate_id UUID NOT NULL,
+	x INTEGER NOT NULL,
+	y INTEGER NOT NULL,
+	height SMALLINT NOT NULL CHECK (height BETWEEN 1 AND 30),
+	created_at TIMESTAMPTZ NOT NULL,
+    
+	CONSTRAINT tree_pk PRIMARY KEY (id),
+	CONSTRAINT trees_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES plantation_management_service.estates(id)
+);
+
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.jobs (
+	id UUID NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	state VARCHAR(16) NOT NULL CHECK (state IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+	estate_id UUID NOT NULL,
+	content_type VARCHAR(64) NOT NULL,
+	payload BYTEA NOT NULL,
+	total_rows INTEGER NOT NULL DEFAULT 0,
+	processed_rows INTEGER NOT NULL DEFAULT 0,
+	succeeded_rows INTEGER NOT NULL DEFAULT 0,
+	failed_rows INTEGER NOT NULL DEFAULT 0,
+	error_samples JSONB NOT NULL DEFAULT '[]',
+	cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+
+	CONSTRAINT job_pk PRIMARY KEY (id),
+	CONSTRAINT jobs_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES plantation_management_service.estates(id)
+);
+
+CREATE INDEX IF NOT EXISTS jobs_state_created_at_idx ON plantation_management_service.jobs (state, created_at);
+
+CREATE TABLE IF NOT EXISTS plantation_management_service.drone_plans (
+	estate_id UUID NOT NULL,
+	params_key VARCHAR(64) NOT NULL,
+	revision BIGINT NOT NULL,
+	-- The distances of the largest estates exceed the range of INTEGER.
+	total_distance BIGINT NOT NULL,
+	total_vertical_distance BIGINT NOT NULL,
+	total_horizontal_distance BIGINT NOT NULL,
+	last_x INTEGER NOT NULL,
+	last_y INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+
+	CONSTRAINT drone_plan_pk PRIMARY KEY (estate_id, params_key),
+	CONSTRAINT drone_plans_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES plantation_management_service.estates(id)
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS plantation_management_service.trees_estate_id_y_x_idx;
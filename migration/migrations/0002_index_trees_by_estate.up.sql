@@ -0,0 +1,3 @@
+-- Index the trees by estate, in the order the drone plans and the exports read them.
+
+CREATE INDEX IF NOT EXISTS trees_estate_id_y_x_idx ON plantation_management_service.trees (estate_id, y, x);
@@ -0,0 +1,193 @@
+// This file contains the cache of computed drone plans.
+package plancache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+)
+
+// Key identifies a drone plan. A plan only depends on the trees of the estate, which are covered by
+// the revision, and on the planner parameters.
+type Key struct {
+	EstateId string
+	Revision int64
+
+	ScaleFactor int
+	// MaxDistance is nil when the whole estate is planned.
+	MaxDistance *int
+}
+
+// ParamsKey encodes the planner parameters of a key, as stored by the persistent tier.
+func (k Key) ParamsKey() string {
+	maxDistance := "none"
+	if k.MaxDistance != nil {
+		maxDistance = fmt.Sprint(*k.MaxDistance)
+	}
+	return fmt.Sprintf("scale=%d;max=%s", k.ScaleFactor, maxDistance)
+}
+
+// Stats holds the counters of a cache since it was created.
+type Stats struct {
+	// Hits counts the plans served from memory, PersistentHits the plans served from the persistent tier.
+	Hits           int64 `json:"hits"`
+	PersistentHits int64 `json:"persistent_hits"`
+	Misses         int64 `json:"misses"`
+	Evictions      int64 `json:"evictions"`
+	Size           int   `json:"size"`
+}
+
+// Cache is an in-process LRU cache of drone plans, optionally backed by the repository.
+//
+// An entry holds the latest known plan of an estate for a set of planner parameters. A plan of
+// another revision is a miss, so a mutation of the estate invalidates its plans without any
+// explicit eviction. Cache is safe for concurrent use.
+type Cache struct {
+	// Repository is the persistent tier, plans are only cached in memory when it is nil.
+	Repository repository.RepositoryInterface
+
+	size int
+
+	mu      sync.Mutex
+	entries *list.List
+	index   map[string]*list.Element
+
+	hits, persistentHits, misses, evictions atomic.Int64
+}
+
+type entry struct {
+	key      string
+	revision int64
+	plan     repository.CalculateDroneDistanceOutput
+}
+
+type NewCacheOptions struct {
+	// Size is the number of plans kept in memory. Defaults to 1000.
+	Size int
+	// Repository enables the persistent tier when set.
+	Repository repository.RepositoryInterface
+}
+
+// NewCache creates a new Cache with the provided options.
+func NewCache(opts NewCacheOptions) *Cache {
+	c := &Cache{
+		Repository: opts.Repository,
+		size:       opts.Size,
+		entries:    list.New(),
+		index:      map[string]*list.Element{},
+	}
+	if c.size <= 0 {
+		c.size = 1000
+	}
+	return c
+}
+
+// Get returns the plan of the key, looking in memory first, then in the persistent tier.
+// A failure of the persistent tier is logged and reported as a miss.
+func (c *Cache) Get(ctx context.Context, key Key) (*repository.CalculateDroneDistanceOutput, bool) {
+	if plan, ok := c.getMemory(key); ok {
+		c.hits.Add(1)
+		return plan, true
+	}
+
+	if c.Repository != nil {
+		output, err := c.Repository.GetDronePlan(ctx, &repository.GetDronePlanInput{
+			EstateId:  key.EstateId,
+			ParamsKey: key.ParamsKey(),
+			Revision:  key.Revision,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "err getting the drone plan from the persistent cache", "error", err)
+		} else if output != nil {
+			c.putMemory(key, output.Plan)
+			c.persistentHits.Add(1)
+			plan := output.Plan
+			return &plan, true
+		}
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// Put stores the plan of the key, unless a plan of a later revision is stored already.
+// A failure of the persistent tier is logged and ignored.
+func (c *Cache) Put(ctx context.Context, key Key, plan repository.CalculateDroneDistanceOutput) {
+	c.putMemory(key, plan)
+
+	if c.Repository != nil {
+		_, err := c.Repository.SaveDronePlan(ctx, &repository.SaveDronePlanInput{
+			EstateId:  key.EstateId,
+			ParamsKey: key.ParamsKey(),
+			Revision:  key.Revision,
+			Plan:      plan,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "err saving the drone plan to the persistent cache", "error", err)
+		}
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := c.entries.Len()
+	c.mu.Unlock()
+	return Stats{
+		Hits:           c.hits.Load(),
+		PersistentHits: c.persistentHits.Load(),
+		Misses:         c.misses.Load(),
+		Evictions:      c.evictions.Load(),
+		Size:           size,
+	}
+}
+
+func memoryKey(key Key) string {
+	return key.EstateId + "|" + key.ParamsKey()
+}
+
+func (c *Cache) getMemory(key Key) (*repository.CalculateDroneDistanceOutput, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.index[memoryKey(key)]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if e.revision != key.Revision {
+		return nil, false
+	}
+	c.entries.MoveToFront(element)
+	plan := e.plan
+	return &plan, true
+}
+
+func (c *Cache) putMemory(key Key, plan repository.CalculateDroneDistanceOutput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := memoryKey(key)
+	if element, ok := c.index[k]; ok {
+		e := element.Value.(*entry)
+		if e.revision > key.Revision {
+			return
+		}
+		e.revision, e.plan = key.Revision, plan
+		c.entries.MoveToFront(element)
+		return
+	}
+
+	c.index[k] = c.entries.PushFront(&entry{key: k, revision: key.Revision, plan: plan})
+	if c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*entry).key)
+		c.evictions.Add(1)
+	}
+}
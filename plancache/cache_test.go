@@ -0,0 +1,143 @@
+package plancache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func intPointer(i int) *int {
+	return &i
+}
+
+// TestCache tests the memory tier of the cache: revisions, planner parameters and evictions.
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	plan := repository.CalculateDroneDistanceOutput{TotalDistance: 100}
+	ctx := context.Background()
+
+	t.Run("Hit - same revision and parameters", func(t *testing.T) {
+		t.Parallel()
+		c := NewCache(NewCacheOptions{})
+		key := Key{EstateId: "estate", Revision: 1, ScaleFactor: 10}
+
+		c.Put(ctx, key, plan)
+		got, ok := c.Get(ctx, key)
+
+		assert.True(t, ok)
+		assert.Equal(t, &plan, got)
+		assert.Equal(t, Stats{Hits: 1, Size: 1}, c.Stats())
+	})
+
+	t.Run("Miss - later revision", func(t *testing.T) {
+		t.Parallel()
+		c := NewCache(NewCacheOptions{})
+
+		c.Put(ctx, Key{EstateId: "estate", Revision: 1}, plan)
+		_, ok := c.Get(ctx, Key{EstateId: "estate", Revision: 2})
+
+		assert.False(t, ok)
+		assert.Equal(t, Stats{Misses: 1, Size: 1}, c.Stats())
+	})
+
+	t.Run("Miss - other parameters", func(t *testing.T) {
+		t.Parallel()
+		c := NewCache(NewCacheOptions{})
+
+		c.Put(ctx, Key{EstateId: "estate", ScaleFactor: 10}, plan)
+		_, ok := c.Get(ctx, Key{EstateId: "estate", ScaleFactor: 10, MaxDistance: intPointer(50)})
+
+		assert.False(t, ok)
+	})
+
+	t.Run("Earlier revision does not replace a later one", func(t *testing.T) {
+		t.Parallel()
+		c := NewCache(NewCacheOptions{})
+
+		c.Put(ctx, Key{EstateId: "estate", Revision: 2}, plan)
+		c.Put(ctx, Key{EstateId: "estate", Revision: 1}, repository.CalculateDroneDistanceOutput{TotalDistance: 50})
+		got, ok := c.Get(ctx, Key{EstateId: "estate", Revision: 2})
+
+		assert.True(t, ok)
+		assert.Equal(t, 100, got.TotalDistance)
+	})
+
+	t.Run("Least recently used plan is evicted", func(t *testing.T) {
+		t.Parallel()
+		c := NewCache(NewCacheOptions{Size: 2})
+
+		c.Put(ctx, Key{EstateId: "a"}, plan)
+		c.Put(ctx, Key{EstateId: "b"}, plan)
+		c.Get(ctx, Key{EstateId: "a"})
+		c.Put(ctx, Key{EstateId: "c"}, plan)
+
+		_, ok := c.Get(ctx, Key{EstateId: "b"})
+		assert.False(t, ok)
+		_, ok = c.Get(ctx, Key{EstateId: "a"})
+		assert.True(t, ok)
+		assert.Equal(t, int64(1), c.Stats().Evictions)
+	})
+}
+
+// TestCachePersistent tests the persistent tier of the cache.
+func TestCachePersistent(t *testing.T) {
+	t.Parallel()
+
+	plan := repository.CalculateDroneDistanceOutput{TotalDistance: 100}
+	key := Key{EstateId: "estate", Revision: 3, ScaleFactor: 10, MaxDistance: intPointer(50)}
+	ctx := context.Background()
+
+	t.Run("Hit - plan loaded from the repository and kept in memory", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		mockRepo := repository.NewMockRepositoryInterface(ctrl)
+		c := NewCache(NewCacheOptions{Repository: mockRepo})
+
+		mockRepo.EXPECT().GetDronePlan(gomock.Any(), &repository.GetDronePlanInput{
+			EstateId:  "estate",
+			ParamsKey: "scale=10;max=50",
+			Revision:  3,
+		}).Return(&repository.GetDronePlanOutput{Plan: plan}, nil)
+
+		got, ok := c.Get(ctx, key)
+		assert.True(t, ok)
+		assert.Equal(t, &plan, got)
+		_, ok = c.Get(ctx, key)
+		assert.True(t, ok)
+		assert.Equal(t, Stats{Hits: 1, PersistentHits: 1, Size: 1}, c.Stats())
+	})
+
+	t.Run("Miss - repository error", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		mockRepo := repository.NewMockRepositoryInterface(ctrl)
+		c := NewCache(NewCacheOptions{Repository: mockRepo})
+
+		mockRepo.EXPECT().GetDronePlan(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		_, ok := c.Get(ctx, key)
+		assert.False(t, ok)
+		assert.Equal(t, int64(1), c.Stats().Misses)
+	})
+
+	t.Run("Put - plan saved to the repository", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		mockRepo := repository.NewMockRepositoryInterface(ctrl)
+		c := NewCache(NewCacheOptions{Repository: mockRepo})
+
+		mockRepo.EXPECT().SaveDronePlan(gomock.Any(), &repository.SaveDronePlanInput{
+			EstateId:  "estate",
+			ParamsKey: "scale=10;max=50",
+			Revision:  3,
+			Plan:      plan,
+		}).Return(&repository.SaveDronePlanOutput{Saved: true}, nil)
+
+		c.Put(ctx, key, plan)
+	})
+}
@@ -0,0 +1,244 @@
+// This file contains the drone planner, which computes the patrol of an estate without any server or database.
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MinTreeHeight and MaxTreeHeight bound the height of a tree.
+const (
+	MinTreeHeight = 1
+	MaxTreeHeight = 30
+)
+
+var (
+	ErrInvalidEstate  = errors.New("estate must be at least 1 x 1 plots")
+	ErrInvalidOptions = errors.New("scale factor must not be negative and max distance must be positive")
+)
+
+// Estate is the rectangle of plots patrolled by the drone. Length is the number of plots along the X axis,
+// from west to east, and Width the number of plots along the Y axis, from south to north.
+type Estate struct {
+	Length, Width int
+}
+
+// Tree is a tree planted on the plot (X, Y) of an estate, both 1-based.
+type Tree struct {
+	X, Y, Height int
+}
+
+// Plot is a plot of an estate, both coordinates are 1-based.
+type Plot struct {
+	X, Y int
+}
+
+type Options struct {
+	// ScaleFactor is the horizontal distance between two adjacent plots.
+	ScaleFactor int
+	// MaxDistance is the distance the drone can fly before it has to rest, the whole estate is planned when nil.
+	MaxDistance *int
+}
+
+// Outcome tells how far the drone gets within the max distance of a plan.
+type Outcome string
+
+const (
+	// Grounded means the drone cannot reach the first plot.
+	Grounded Outcome = "grounded"
+	// Partial means the drone rests before the landing plot.
+	Partial Outcome = "partial"
+	// Complete means the drone lands on the landing plot.
+	Complete Outcome = "complete"
+)
+
+// Plan is the patrol of an estate.
+type Plan struct {
+	// TotalDistance is the sum of VerticalDistance and HorizontalDistance. The distances are only computed when the
+	// whole estate is planned, without a max distance.
+	TotalDistance      int
+	VerticalDistance   int
+	HorizontalDistance int
+	// Rest is the last plot reached within the max distance, the zero Plot when the drone is grounded.
+	Rest Plot
+	// Outcome is only set when the plan has a max distance.
+	Outcome Outcome
+}
+
+// Compute plans the patrol of an estate.
+//
+// The drone takes off south of the first plot (1, 1) and flies one metre above the trees, or above the ground
+// of the empty plots. It covers the first row from west to east, then the second row from east to west, and
+// so on, then lands on the last plot of the last row, see LandingPlot. Climbing and descending count as
+// vertical distance, moving to the next plot adds ScaleFactor to the horizontal distance.
+//
+// With a max distance, the plan stops at the last plot the drone can reach and still land on.
+func Compute(estate Estate, trees []Tree, opts Options) (*Plan, error) {
+	if estate.Length < 1 || estate.Width < 1 {
+		return nil, ErrInvalidEstate
+	}
+	if opts.ScaleFactor < 0 || opts.MaxDistance != nil && *opts.MaxDistance < 1 {
+		return nil, ErrInvalidOptions
+	}
+	for _, t := range trees {
+		if t.X < 1 || t.X > estate.Length || t.Y < 1 || t.Y > estate.Width {
+			return nil, fmt.Errorf("tree at plot (%d, %d) is outside of the estate", t.X, t.Y)
+		}
+		if t.Height < MinTreeHeight || t.Height > MaxTreeHeight {
+			return nil, fmt.Errorf("tree at plot (%d, %d) has a height of %d, which is not between %d and %d", t.X, t.Y, t.Height, MinTreeHeight, MaxTreeHeight)
+		}
+	}
+
+	plan := walk(estate, trees, opts.ScaleFactor, opts.MaxDistance)
+	if opts.MaxDistance != nil {
+		plan.Outcome = NewOutcome(estate, plan.Rest)
+	}
+	return plan, nil
+}
+
+// LandingPlot returns the last plot of the plan: the drone flies towards the last column on the odd rows and
+// back towards the first column on the even rows, so it lands on the last column when the number of rows is odd.
+func LandingPlot(estate Estate) Plot {
+	if estate.Width%2 == 1 {
+		return Plot{X: estate.Length, Y: estate.Width}
+	}
+	return Plot{X: 1, Y: estate.Width}
+}
+
+// NewOutcome tells how far the drone gets from the last plot it reaches within the max distance.
+func NewOutcome(estate Estate, rest Plot) Outcome {
+	if rest.X == 0 || rest.Y == 0 {
+		return Grounded
+	}
+	if rest == LandingPlot(estate) {
+		return Complete
+	}
+	return Partial
+}
+
+// VisitedPlots returns the number of plots the drone flies over in a plan, every plot of the estate unless the
+// plan stops at a rest plot before the landing plot.
+func VisitedPlots(estate Estate, plan *Plan) int {
+	switch {
+	case plan.Outcome == "" || plan.Outcome == Complete:
+		return estate.Length * estate.Width
+	case plan.Outcome == Grounded:
+		return 0
+	}
+	// The rows before the rest are complete, the row of the rest is flown from the west on the odd rows and from
+	// the east on the even rows.
+	visited := (plan.Rest.Y - 1) * estate.Length
+	if plan.Rest.Y%2 == 1 {
+		return visited + plan.Rest.X
+	}
+	return visited + estate.Length - plan.Rest.X + 1
+}
+
+// walk flies the drone over the estate, row after row.
+func walk(estate Estate, trees []Tree, scaleFactor int, maxDistance *int) *Plan {
+	plan := &Plan{}
+
+	totalHorizontalDistance := 0
+
+	// Create estate and populate estate with 1 because 1 is the minimum height for the drone flying.
+	plantationGridArray := make([][]int, estate.Width)
+	for i := range plantationGridArray {
+		plantationGridArray[i] = make([]int, estate.Length)
+		for j := range plantationGridArray[i] {
+			plantationGridArray[i][j] = 1 // Populate with 1
+		}
+	}
+
+	// Populate the estate with the trees. Set also the height for the drone to patrol the tree.
+	for _, t := range trees {
+		plantationGridArray[t.Y-1][t.X-1] = t.Height + 1
+	}
+
+	totalVerticalDistance := 0
+	var currentHeight, previousHeight int
+	var i, j int
+	// Iterate the Y axis of the estate (hence using estate.Width - not estate.Length)
+	for i = 0; i < estate.Width; i++ {
+
+		// Determine if need to go east to west or west to east.
+		// The logic is to determine if the current row is even or odd, if even then go east to west, if odd then go west to east.
+		if i%2 == 0 {
+
+			// Now iterate the X axis of the estate (hence using estate.Length).
+			// The direction of the iteration is east to west (because the row is even).
+			for j = 0; j < estate.Length; j++ {
+				if j == 0 {
+					if i == 0 {
+						// Since this is the very first grid, no previous height which makes sense.
+						currentHeight = plantationGridArray[i][j]
+					} else {
+						currentHeight = plantationGridArray[i][j]
+						previousHeight = plantationGridArray[i-1][j]
+					}
+				} else {
+					currentHeight = plantationGridArray[i][j]
+					previousHeight = plantationGridArray[i][j-1]
+				}
+
+				// Calculate the difference of the height / vertical distance that the drone needs to travel.
+				increment := int(math.Abs(float64(currentHeight - previousHeight)))
+
+				// Add the difference of the height to the total vertical distance.
+				totalVerticalDistance += increment
+
+				if !(i == 0 && j == 0) {
+					totalHorizontalDistance += scaleFactor
+				}
+
+				if maxDistance != nil && *maxDistance < (totalHorizontalDistance+totalVerticalDistance+currentHeight) {
+					return plan
+				}
+
+				plan.Rest = Plot{X: j + 1, Y: i + 1}
+
+				if i == estate.Width-1 && j == estate.Length-1 {
+					totalVerticalDistance += plantationGridArray[i][j]
+				}
+			}
+		} else {
+			// Since this is the odd row, the direction of the iteration is west to east.
+			// Hence the iteration starts from estate.Length - 1 and not 0.
+			for j = estate.Length - 1; j >= 0; j-- {
+				// Below condition determines if the current estate grid is the first one of the iteration.
+				// If it is, then we need to determine the previous height from *below* row instead.
+				// Previous row is used instead of previous column because we need to iterate from *south* to *north*
+				// since the iteration has reached the end of the grid in that X (horizontal) axis
+				if j == estate.Length-1 {
+					currentHeight = plantationGridArray[i][j]
+					previousHeight = plantationGridArray[i-1][j] // use previous row instead of column
+
+				} else {
+					currentHeight = plantationGridArray[i][j]
+					previousHeight = plantationGridArray[i][j+1] // use next column instead of row
+				}
+
+				// Calculate the difference of the height / vertical distance that the drone needs to travel.
+				increment := int(math.Abs(float64(currentHeight - previousHeight)))
+
+				totalVerticalDistance += increment
+				totalHorizontalDistance += scaleFactor
+
+				if maxDistance != nil && *maxDistance < (totalHorizontalDistance+totalVerticalDistance+currentHeight) {
+					return plan
+				}
+				plan.Rest = Plot{X: j + 1, Y: i + 1}
+
+				// If reaching the last grid, don't forget to add the vertical distance of the last grid so that the drone can land.
+				if i == estate.Width-1 && j == 0 {
+					totalVerticalDistance += plantationGridArray[i][j]
+				}
+			}
+		}
+	}
+	plan.TotalDistance = totalVerticalDistance + totalHorizontalDistance
+	plan.HorizontalDistance = totalHorizontalDistance
+	plan.VerticalDistance = totalVerticalDistance
+
+	return plan
+}
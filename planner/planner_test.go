@@ -0,0 +1,125 @@
+package planner
+
+import (
+	"encoding/json"
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestComputeGolden")
+
+func intPointer(i int) *int {
+	return &i
+}
+
+// randomTrees plants a tree on about one plot out of three of an estate, with the same trees for the same seed.
+func randomTrees(seed int64, estate Estate) []Tree {
+	random := rand.New(rand.NewSource(seed))
+	var trees []Tree
+	for y := 1; y <= estate.Width; y++ {
+		for x := 1; x <= estate.Length; x++ {
+			if random.Intn(3) == 0 {
+				trees = append(trees, Tree{X: x, Y: y, Height: MinTreeHeight + random.Intn(MaxTreeHeight)})
+			}
+		}
+	}
+	return trees
+}
+
+// TestComputeGolden locks the plans computed by Compute in testdata, run with -update to rewrite them.
+func TestComputeGolden(t *testing.T) {
+	rowEstate, rowTrees := Estate{Length: 5, Width: 1}, []Tree{{X: 5, Y: 1, Height: 5}}
+	twoRowsEstate, twoRowsTrees := Estate{Length: 5, Width: 2}, []Tree{{X: 5, Y: 1, Height: 5}, {X: 5, Y: 2, Height: 10}}
+	oddEstate := Estate{Length: 7, Width: 5}
+	evenEstate := Estate{Length: 6, Width: 4}
+
+	testCases := []struct {
+		name   string
+		estate Estate
+		trees  []Tree
+		opts   Options
+	}{
+		{name: "single_plot", estate: Estate{Length: 1, Width: 1}, opts: Options{ScaleFactor: 10}},
+		{name: "single_plot_tree", estate: Estate{Length: 1, Width: 1}, trees: []Tree{{X: 1, Y: 1, Height: 30}}, opts: Options{ScaleFactor: 10}},
+		{name: "single_column", estate: Estate{Length: 1, Width: 4}, trees: []Tree{{X: 1, Y: 2, Height: 3}, {X: 1, Y: 4, Height: 8}}, opts: Options{ScaleFactor: 10}},
+		{name: "row", estate: rowEstate, trees: rowTrees, opts: Options{ScaleFactor: 10}},
+		{name: "row_partial", estate: rowEstate, trees: rowTrees, opts: Options{ScaleFactor: 10, MaxDistance: intPointer(46)}},
+		{name: "row_grounded", estate: rowEstate, trees: rowTrees, opts: Options{ScaleFactor: 10, MaxDistance: intPointer(1)}},
+		{name: "row_complete", estate: rowEstate, trees: rowTrees, opts: Options{ScaleFactor: 10, MaxDistance: intPointer(52)}},
+		{name: "two_rows", estate: twoRowsEstate, trees: twoRowsTrees, opts: Options{ScaleFactor: 10}},
+		{name: "two_rows_partial", estate: twoRowsEstate, trees: twoRowsTrees, opts: Options{ScaleFactor: 10, MaxDistance: intPointer(111)}},
+		{name: "two_rows_landing_plot", estate: twoRowsEstate, trees: twoRowsTrees, opts: Options{ScaleFactor: 10, MaxDistance: intPointer(112)}},
+		{name: "odd_rows", estate: oddEstate, trees: randomTrees(1, oddEstate), opts: Options{ScaleFactor: 10}},
+		{name: "odd_rows_partial", estate: oddEstate, trees: randomTrees(1, oddEstate), opts: Options{ScaleFactor: 10, MaxDistance: intPointer(250)}},
+		{name: "even_rows", estate: evenEstate, trees: randomTrees(2, evenEstate), opts: Options{ScaleFactor: 10}},
+		{name: "even_rows_scale_1", estate: evenEstate, trees: randomTrees(2, evenEstate), opts: Options{ScaleFactor: 1}},
+		{name: "even_rows_scale_0", estate: evenEstate, trees: randomTrees(2, evenEstate), opts: Options{}},
+		{name: "even_rows_partial", estate: evenEstate, trees: randomTrees(2, evenEstate), opts: Options{ScaleFactor: 10, MaxDistance: intPointer(300)}},
+		{name: "large", estate: Estate{Length: 50, Width: 40}, trees: randomTrees(3, Estate{Length: 50, Width: 40}), opts: Options{ScaleFactor: 10}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := Compute(tc.estate, tc.trees, tc.opts)
+			require.NoError(t, err)
+			got, err := json.MarshalIndent(plan, "", "  ")
+			require.NoError(t, err)
+
+			path := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(path, append(got, '\n'), 0o644))
+			}
+			want, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+}
+
+func TestComputeInvalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		estate Estate
+		trees  []Tree
+		opts   Options
+		err    string
+	}{
+		{name: "Empty estate", estate: Estate{Length: 0, Width: 1}, err: ErrInvalidEstate.Error()},
+		{name: "Negative scale factor", estate: Estate{Length: 1, Width: 1}, opts: Options{ScaleFactor: -1}, err: ErrInvalidOptions.Error()},
+		{name: "Zero max distance", estate: Estate{Length: 1, Width: 1}, opts: Options{MaxDistance: intPointer(0)}, err: ErrInvalidOptions.Error()},
+		{name: "Tree outside", estate: Estate{Length: 2, Width: 2}, trees: []Tree{{X: 3, Y: 1, Height: 1}}, err: "tree at plot (3, 1) is outside of the estate"},
+		{name: "Tree too high", estate: Estate{Length: 2, Width: 2}, trees: []Tree{{X: 1, Y: 1, Height: 31}}, err: "tree at plot (1, 1) has a height of 31, which is not between 1 and 30"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compute(tc.estate, tc.trees, tc.opts)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestNewOutcome(t *testing.T) {
+	assert.Equal(t, Plot{X: 5, Y: 3}, LandingPlot(Estate{Length: 5, Width: 3}))
+	assert.Equal(t, Plot{X: 1, Y: 4}, LandingPlot(Estate{Length: 5, Width: 4}))
+
+	assert.Equal(t, Grounded, NewOutcome(Estate{Length: 5, Width: 4}, Plot{}))
+	assert.Equal(t, Partial, NewOutcome(Estate{Length: 5, Width: 4}, Plot{X: 5, Y: 4}))
+	assert.Equal(t, Complete, NewOutcome(Estate{Length: 5, Width: 4}, Plot{X: 1, Y: 4}))
+}
+
+func TestVisitedPlots(t *testing.T) {
+	estate := Estate{Length: 5, Width: 4}
+	assert.Equal(t, 20, VisitedPlots(estate, &Plan{TotalDistance: 100}))
+	assert.Equal(t, 20, VisitedPlots(estate, &Plan{Rest: Plot{X: 1, Y: 4}, Outcome: Complete}))
+	assert.Equal(t, 0, VisitedPlots(estate, &Plan{Outcome: Grounded}))
+	assert.Equal(t, 3, VisitedPlots(estate, &Plan{Rest: Plot{X: 3, Y: 1}, Outcome: Partial}))
+	assert.Equal(t, 7, VisitedPlots(estate, &Plan{Rest: Plot{X: 4, Y: 2}, Outcome: Partial}))
+	assert.Equal(t, 11, VisitedPlots(estate, &Plan{Rest: Plot{X: 1, Y: 3}, Outcome: Partial}))
+}
@@ -0,0 +1,214 @@
+package planner
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// referencePath lists the plots in the order the drone flies over them: the first row from west to east, the
+// second row back from east to west, and so on.
+func referencePath(estate Estate) []Plot {
+	path := make([]Plot, 0, estate.Length*estate.Width)
+	for y := 1; y <= estate.Width; y++ {
+		for i := 0; i < estate.Length; i++ {
+			x := 1 + i
+			if y%2 == 0 {
+				x = estate.Length - i
+			}
+			path = append(path, Plot{X: x, Y: y})
+		}
+	}
+	return path
+}
+
+// referencePlan computes the plan of Compute by flying along the enumerated path, instead of walking the grid
+// row by row. It also returns the distance flown to the rest plot and down to its ground, 0 when grounded.
+func referencePlan(estate Estate, trees []Tree, opts Options) (*Plan, int) {
+	heights := map[Plot]int{}
+	for _, t := range trees {
+		heights[Plot{X: t.X, Y: t.Y}] = t.Height
+	}
+	// The drone flies one metre above the trees, and one metre above the ground of the empty plots.
+	altitude := func(p Plot) int {
+		return heights[p] + 1
+	}
+	distance := func(from, to int) int {
+		if from > to {
+			return from - to
+		}
+		return to - from
+	}
+
+	path := referencePath(estate)
+	plan := &Plan{}
+	flown := 0
+	horizontal, vertical := 0, 0
+	for i, plot := range path {
+		if i == 0 {
+			// Take off from the ground.
+			vertical += altitude(plot)
+		} else {
+			horizontal += opts.ScaleFactor
+			vertical += distance(altitude(path[i-1]), altitude(plot))
+		}
+		// The drone only goes as far as it can still land.
+		if opts.MaxDistance != nil && horizontal+vertical+altitude(plot) > *opts.MaxDistance {
+			plan.Outcome = Partial
+			if plan.Rest == (Plot{}) {
+				plan.Outcome = Grounded
+			}
+			return plan, flown
+		}
+		plan.Rest = plot
+		flown = horizontal + vertical + altitude(plot)
+	}
+
+	// Land on the last plot.
+	vertical += altitude(path[len(path)-1])
+	plan.TotalDistance, plan.HorizontalDistance, plan.VerticalDistance = horizontal+vertical, horizontal, vertical
+	if opts.MaxDistance != nil {
+		plan.Outcome = Complete
+	}
+	return plan, flown
+}
+
+// propertyInput is an estate to plan with a few budgets, given as ratios of the distance of its whole plan so
+// that every outcome is likely.
+type propertyInput struct {
+	Estate       Estate
+	Trees        []Tree
+	ScaleFactor  int
+	BudgetRatios []float64
+}
+
+// Generate implements quick.Generator with small estates, planted at random.
+func (propertyInput) Generate(random *rand.Rand, size int) reflect.Value {
+	in := propertyInput{
+		Estate:      Estate{Length: 1 + random.Intn(20), Width: 1 + random.Intn(20)},
+		ScaleFactor: random.Intn(15),
+	}
+	density := random.Float64()
+	for y := 1; y <= in.Estate.Width; y++ {
+		for x := 1; x <= in.Estate.Length; x++ {
+			if random.Float64() < density {
+				in.Trees = append(in.Trees, Tree{X: x, Y: y, Height: MinTreeHeight + random.Intn(MaxTreeHeight)})
+			}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		in.BudgetRatios = append(in.BudgetRatios, random.Float64()*1.2)
+	}
+	return reflect.ValueOf(in)
+}
+
+// checkProperties asserts the invariants of the plans of in, and reports whether they all hold.
+func checkProperties(t *testing.T, in propertyInput) bool {
+	t.Helper()
+	plan, err := Compute(in.Estate, in.Trees, Options{ScaleFactor: in.ScaleFactor})
+	if !assert.NoError(t, err) {
+		return false
+	}
+	want, _ := referencePlan(in.Estate, in.Trees, Options{ScaleFactor: in.ScaleFactor})
+	ok := assert.Equal(t, want, plan, "whole plan of %+v", in)
+	ok = assert.Equal(t, (in.Estate.Length*in.Estate.Width-1)*in.ScaleFactor, plan.HorizontalDistance, "horizontal distance of %+v", in) && ok
+	ok = assert.Equal(t, plan.HorizontalDistance+plan.VerticalDistance, plan.TotalDistance, "total distance of %+v", in) && ok
+
+	path := referencePath(in.Estate)
+	budgets := make([]int, 0, len(in.BudgetRatios))
+	for _, ratio := range in.BudgetRatios {
+		budgets = append(budgets, max(1, int(ratio*float64(plan.TotalDistance))))
+	}
+	slices.Sort(budgets)
+
+	previousIndex, previousFlown := -1, 0
+	for _, budget := range budgets {
+		opts := Options{ScaleFactor: in.ScaleFactor, MaxDistance: &budget}
+		budgetPlan, err := Compute(in.Estate, in.Trees, opts)
+		if !assert.NoError(t, err) {
+			return false
+		}
+		want, flown := referencePlan(in.Estate, in.Trees, opts)
+		ok = assert.Equal(t, want, budgetPlan, "plan of %+v within %d", in, budget) && ok
+
+		// The rest is inside the estate, unless the drone is grounded.
+		index := slices.Index(path, budgetPlan.Rest)
+		if budgetPlan.Outcome == Grounded {
+			ok = assert.Equal(t, Plot{}, budgetPlan.Rest, "grounded rest of %+v within %d", in, budget) && ok
+		} else {
+			ok = assert.NotEqual(t, -1, index, "rest %+v of %+v within %d is outside of the estate", budgetPlan.Rest, in, budget) && ok
+		}
+		// The drone goes at least as far with a larger budget, and never beyond its budget.
+		ok = assert.GreaterOrEqual(t, index, previousIndex, "rest of %+v within %d goes back", in, budget) && ok
+		ok = assert.GreaterOrEqual(t, flown, previousFlown, "distance of %+v within %d decreases", in, budget) && ok
+		ok = assert.LessOrEqual(t, flown, budget, "distance of %+v exceeds %d", in, budget) && ok
+		// The plan completes exactly when the budget covers the whole plan.
+		ok = assert.Equal(t, budget >= plan.TotalDistance, budgetPlan.Outcome == Complete, "outcome of %+v within %d", in, budget) && ok
+		ok = assert.Equal(t, index+1, VisitedPlots(in.Estate, budgetPlan), "visited plots of %+v within %d", in, budget) && ok
+		previousIndex, previousFlown = index, flown
+	}
+	return ok
+}
+
+func TestReferencePath(t *testing.T) {
+	assert.Equal(t, []Plot{{1, 1}, {2, 1}, {3, 1}, {3, 2}, {2, 2}, {1, 2}, {1, 3}, {2, 3}, {3, 3}}, referencePath(Estate{Length: 3, Width: 3}))
+	assert.Equal(t, LandingPlot(Estate{Length: 4, Width: 2}), referencePath(Estate{Length: 4, Width: 2})[7])
+}
+
+// TestComputeProperties checks the invariants of Compute, and that it agrees with referencePlan, on random estates.
+func TestComputeProperties(t *testing.T) {
+	count := 500
+	if testing.Short() {
+		count = 100
+	}
+	err := quick.Check(func(in propertyInput) bool {
+		return checkProperties(t, in)
+	}, &quick.Config{MaxCount: count, Rand: rand.New(rand.NewSource(1))})
+	assert.NoError(t, err)
+}
+
+// newFuzzInput decodes the arguments of the fuzz targets: every three bytes of trees are the plot and the height
+// of a tree, reduced to the estate and to the allowed heights, and a later tree replaces an earlier one on the
+// same plot, like in Compute.
+func newFuzzInput(length, width, scaleFactor uint8, trees []byte) propertyInput {
+	in := propertyInput{
+		Estate:      Estate{Length: 1 + int(length)%40, Width: 1 + int(width)%40},
+		ScaleFactor: int(scaleFactor) % 20,
+	}
+	for i := 0; i+2 < len(trees); i += 3 {
+		in.Trees = append(in.Trees, Tree{
+			X:      1 + int(trees[i])%in.Estate.Length,
+			Y:      1 + int(trees[i+1])%in.Estate.Width,
+			Height: MinTreeHeight + int(trees[i+2])%MaxTreeHeight,
+		})
+	}
+	return in
+}
+
+// FuzzCompute checks the whole plans of the fuzzed estates, run with go test -fuzz FuzzCompute ./planner.
+func FuzzCompute(f *testing.F) {
+	f.Add(uint8(4), uint8(0), uint8(10), []byte{4, 0, 4})
+	f.Add(uint8(4), uint8(1), uint8(10), []byte{4, 0, 4, 4, 1, 9})
+	f.Add(uint8(0), uint8(0), uint8(0), []byte{})
+	f.Add(uint8(6), uint8(4), uint8(1), []byte{0, 0, 29, 6, 4, 0, 3, 3, 15, 3, 3, 2})
+	f.Fuzz(func(t *testing.T, length, width, scaleFactor uint8, trees []byte) {
+		checkProperties(t, newFuzzInput(length, width, scaleFactor, trees))
+	})
+}
+
+// FuzzComputeBudget checks the plans of the fuzzed estates within the fuzzed budgets, given in thousandths of the
+// distance of the whole plan, run with go test -fuzz FuzzComputeBudget ./planner.
+func FuzzComputeBudget(f *testing.F) {
+	f.Add(uint8(4), uint8(0), uint8(10), []byte{4, 0, 4}, uint16(0), uint16(885))
+	f.Add(uint8(4), uint8(1), uint8(10), []byte{4, 0, 4, 4, 1, 9}, uint16(990), uint16(1000))
+	f.Add(uint8(6), uint8(4), uint8(0), []byte{5, 4, 29, 0, 1, 12}, uint16(1), uint16(1200))
+	f.Fuzz(func(t *testing.T, length, width, scaleFactor uint8, trees []byte, first, second uint16) {
+		in := newFuzzInput(length, width, scaleFactor, trees)
+		in.BudgetRatios = []float64{float64(first) / 1000, float64(second) / 1000}
+		checkProperties(t, in)
+	})
+}
@@ -0,0 +1,544 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/migration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryRepository runs the conformance suite against MemoryRepository.
+func TestMemoryRepository(t *testing.T) {
+	testRepositoryConformance(t, NewMemoryRepository(NewMemoryRepositoryOptions{}))
+}
+
+// TestSQLiteRepository runs the conformance suite against SQLiteRepository, on a database file of its own.
+func TestSQLiteRepository(t *testing.T) {
+	repo, err := NewSQLiteRepository(NewSQLiteRepositoryOptions{Path: filepath.Join(t.TempDir(), "test.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Db.Close() })
+	testRepositoryConformance(t, repo)
+
+	_, err = NewSQLiteRepository(NewSQLiteRepositoryOptions{Path: filepath.Join(t.TempDir(), "missing", "test.db")})
+	assert.Error(t, err, "the directory of the database must exist")
+}
+
+// TestPostgresRepository runs the conformance suite against Repository, using the database of
+// TEST_DATABASE_URL, which is migrated first. It is skipped when the variable is not set.
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	repo := NewRepository(NewRepositoryOptions{Dsn: dsn})
+	migrator, err := migration.NewMigrator(migration.NewMigratorOptions{Db: repo.Db})
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	testRepositoryConformance(t, repo)
+}
+
+// testRepositoryConformance checks that repo follows the semantics expected from every backend.
+// The database may be shared with other runs, so every case works on estates with random dimensions,
+// which the unique length and width of the estates would otherwise merge, and on jobs of its own kind.
+func testRepositoryConformance(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+
+	t.Run("Estates", func(t *testing.T) {
+		length, width := randomDimension(), randomDimension()
+		estateId := createTestEstate(t, repo, length, width)
+
+		estate, err := repo.GetEstateByEstateId(ctx, &GetEstateByEstateIdInput{Id: estateId})
+		require.NoError(t, err)
+		require.NotNil(t, estate)
+		assert.Equal(t, length, estate.Estate.Length)
+		assert.Equal(t, width, estate.Estate.Width)
+		assert.Equal(t, int64(0), estate.Estate.Revision)
+		assert.False(t, estate.Estate.LastModified.IsZero())
+
+		// An estate of the same dimensions is the same estate.
+		recreated, err := repo.CreateEstate(ctx, &CreateEstateInput{Id: uuid.New().String(), Length: uint16(length), Width: uint16(width)})
+		require.NoError(t, err)
+		assert.Equal(t, estateId, recreated.Id)
+		estate, err = repo.GetEstateByEstateId(ctx, &GetEstateByEstateIdInput{Id: estateId})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), estate.Estate.Revision)
+
+		estate, err = repo.GetEstateByEstateId(ctx, &GetEstateByEstateIdInput{Id: uuid.New().String()})
+		require.NoError(t, err)
+		assert.Nil(t, estate)
+	})
+
+	t.Run("Trees", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		otherEstateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		treeId := createTestTree(t, repo, estateId, 2, 3, 15)
+
+		exists, err := repo.IsTreeExist(ctx, &IsTreeExistInput{EstateId: estateId, X: 2, Y: 3})
+		require.NoError(t, err)
+		assert.True(t, exists.IsExist)
+		for _, plot := range []IsTreeExistInput{{EstateId: estateId, X: 3, Y: 2}, {EstateId: otherEstateId, X: 2, Y: 3}} {
+			plot := plot
+			exists, err = repo.IsTreeExist(ctx, &plot)
+			require.NoError(t, err)
+			assert.False(t, exists.IsExist)
+		}
+
+		tree, err := repo.GetTreeByTreeId(ctx, &GetTreeByTreeIdInput{Id: treeId, EstateId: estateId})
+		require.NoError(t, err)
+		require.NotNil(t, tree)
+		assert.Equal(t, Tree{X: 2, Y: 3, Height: 15}, tree.Tree)
+		for _, input := range []GetTreeByTreeIdInput{{Id: treeId, EstateId: otherEstateId}, {Id: uuid.New().String(), EstateId: estateId}} {
+			input := input
+			tree, err = repo.GetTreeByTreeId(ctx, &input)
+			require.NoError(t, err)
+			assert.Nil(t, tree)
+		}
+
+		estate, err := repo.GetEstateByEstateId(ctx, &GetEstateByEstateIdInput{Id: estateId})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), estate.Estate.Revision)
+
+		_, err = repo.CreateTree(ctx, &CreateTreeInput{Id: uuid.New().String(), EstateId: uuid.New().String(), X: 1, Y: 1, Height: 10})
+		assert.Error(t, err, "the estate of a tree must exist")
+		_, err = repo.CreateTree(ctx, &CreateTreeInput{Id: uuid.New().String(), EstateId: estateId, X: 1, Y: 1, Height: MaxTreeHeight + 1})
+		assert.Error(t, err, "the height of a tree is bounded")
+	})
+
+	t.Run("Estate trees", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		emptyEstateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		createTestTree(t, repo, estateId, 1, 1, 5)
+		createTestTree(t, repo, estateId, 2, 1, 7)
+
+		trees, err := repo.GetEstateTreesByEstateId(ctx, &GetEstateTreesByEstateIdInput{EstateId: estateId})
+		require.NoError(t, err)
+		require.NotNil(t, trees)
+		assert.ElementsMatch(t, []Tree{{X: 1, Y: 1, Height: 5}, {X: 2, Y: 1, Height: 7}}, trees.Trees)
+		assert.Equal(t, int64(2), trees.Estate.Revision)
+
+		trees, err = repo.GetEstateTreesByEstateId(ctx, &GetEstateTreesByEstateIdInput{EstateId: emptyEstateId})
+		require.NoError(t, err)
+		require.NotNil(t, trees)
+		assert.Empty(t, trees.Trees)
+
+		trees, err = repo.GetEstateTreesByEstateId(ctx, &GetEstateTreesByEstateIdInput{EstateId: uuid.New().String()})
+		require.NoError(t, err)
+		assert.Nil(t, trees)
+	})
+
+	t.Run("Estate stats", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		for x, height := range []int{8, 3, 10, 5} {
+			createTestTree(t, repo, estateId, x+1, 1, height)
+		}
+
+		stats, err := repo.GetEstateStatsByEstateId(ctx, &GetEstateStatsByEstateIdInput{
+			EstateId:            estateId,
+			IncludeDistribution: true,
+			Percentiles:         []float64{0, 0.9, 1},
+			HistogramBuckets:    6,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.Count)
+		assert.Equal(t, 10, stats.Max)
+		assert.Equal(t, 3, stats.Min)
+		assert.Equal(t, float32(6.5), stats.Median)
+		assert.InDelta(t, 6.5, stats.Mean, 1e-9)
+		assert.InDelta(t, math.Sqrt(7.25), stats.StdDev, 1e-9)
+		assert.InDeltaSlice(t, []float64{3, 9.4, 10}, stats.Percentiles, 1e-9)
+		assert.Equal(t, []HistogramBucket{{1, 5, 2}, {6, 10, 2}, {11, 15, 0}, {16, 20, 0}, {21, 25, 0}, {26, 30, 0}}, stats.Histogram)
+
+		stats, err = repo.GetEstateStatsByEstateId(ctx, &GetEstateStatsByEstateIdInput{EstateId: estateId, Percentiles: []float64{0.5}})
+		require.NoError(t, err)
+		assert.Equal(t, float32(6.5), stats.Median)
+		assert.Zero(t, stats.Mean, "the distribution is only computed when requested")
+		assert.Nil(t, stats.Percentiles)
+		assert.Nil(t, stats.Histogram)
+
+		asOf := time.Now().Add(-time.Hour)
+		stats, err = repo.GetEstateStatsByEstateId(ctx, &GetEstateStatsByEstateIdInput{EstateId: estateId, IncludeDistribution: true, Percentiles: []float64{0.5}, AsOf: &asOf})
+		require.NoError(t, err)
+		assert.Equal(t, &GetEstateStatsByEstateIdOutput{Percentiles: []float64{0}}, stats)
+	})
+
+	t.Run("Estate stats series", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		emptyEstateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		for x, height := range []int{8, 3, 10, 5} {
+			createTestTree(t, repo, estateId, x+1, 1, height)
+		}
+		// Truncated, as the timestamps of the database are less precise than the ones of Go.
+		asOf := time.Now().Add(time.Minute).Truncate(time.Second)
+
+		series, err := repo.GetEstateStatsSeriesByEstateId(ctx, &GetEstateStatsSeriesByEstateIdInput{
+			EstateId: estateId, Interval: StatsIntervalDay, AsOf: asOf, MaxPoints: 10,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, series.Points)
+		newTrees := 0
+		for _, point := range series.Points {
+			newTrees += point.NewTrees
+		}
+		assert.Equal(t, 4, newTrees)
+		last := series.Points[len(series.Points)-1]
+		assert.Equal(t, 4, last.Count)
+		assert.Equal(t, float32(6.5), last.Median)
+		assert.InDelta(t, 6.5, last.Mean, 1e-9)
+		assert.True(t, last.PeriodEnd.Equal(asOf), "the last period ends at as_of")
+
+		series, err = repo.GetEstateStatsSeriesByEstateId(ctx, &GetEstateStatsSeriesByEstateIdInput{
+			EstateId: emptyEstateId, Interval: StatsIntervalMonth, AsOf: asOf, MaxPoints: 10,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, series.Points)
+
+		_, err = repo.GetEstateStatsSeriesByEstateId(ctx, &GetEstateStatsSeriesByEstateIdInput{
+			EstateId: estateId, Interval: "hour", AsOf: asOf, MaxPoints: 10,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Grouped stats", func(t *testing.T) {
+		length, width := randomDimension(), randomDimension()
+		estateId := createTestEstate(t, repo, length, width)
+		createTestTree(t, repo, estateId, 1, 1, 3)
+		createTestTree(t, repo, estateId, 1, width, 7)
+		createTestTree(t, repo, estateId, length, width, 20)
+
+		// Two blocks along the X axis, the second one being cut by the edge of the estate.
+		blockLength := length/2 + 1
+		grouped, err := repo.GetEstateGroupedStatsByEstateId(ctx, &GetEstateGroupedStatsByEstateIdInput{
+			EstateId: estateId, BlockLength: blockLength, BlockWidth: width,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []EstateStatsGroup{
+			{BlockX: 0, BlockY: 0, Count: 2, Max: 7, Min: 3, Median: 5, Mean: 5},
+			{BlockX: 1, BlockY: 0, Count: 1, Max: 20, Min: 20, Median: 20, Mean: 20},
+		}, grouped.Groups)
+
+		grouped, err = repo.GetEstateGroupedStatsByEstateId(ctx, &GetEstateGroupedStatsByEstateIdInput{
+			EstateId: uuid.New().String(), BlockLength: 10, BlockWidth: 10,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, grouped.Groups)
+	})
+
+	t.Run("Portfolio stats", func(t *testing.T) {
+		length, width := randomDimension(), randomDimension()
+		tallId := createTestEstate(t, repo, length, width)
+		denseId := createTestEstate(t, repo, length, width+1)
+		emptyId := createTestEstate(t, repo, length, width+2)
+		createTestTree(t, repo, tallId, 1, 1, 10)
+		createTestTree(t, repo, denseId, 1, 1, 4)
+		createTestTree(t, repo, denseId, 2, 1, 6)
+
+		filter := EstateFilter{MinLength: &length, MaxLength: &length, MinWidth: &width, MaxWidth: intPointer(width + 2)}
+		stats, err := repo.GetPortfolioStats(ctx, &GetPortfolioStatsInput{
+			Filter: filter, Percentiles: []float64{0.5}, RankBy: PortfolioRankByMedian, RankLimit: 1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.Estates)
+		assert.Equal(t, length*(3*width+3), stats.Plots)
+		assert.Equal(t, 3, stats.Count)
+		assert.Equal(t, 10, stats.Max)
+		assert.Equal(t, 4, stats.Min)
+		assert.Equal(t, float32(6), stats.Median)
+		assert.InDeltaSlice(t, []float64{6}, stats.Percentiles, 1e-9)
+		// The estate without trees has no median height, so it is not ranked by median.
+		assert.Equal(t, []EstateRank{{EstateId: tallId, Length: length, Width: width, Count: 1, Median: 10}}, stats.Top)
+		assert.Equal(t, []EstateRank{{EstateId: denseId, Length: length, Width: width + 1, Count: 2, Median: 5}}, stats.Bottom)
+
+		stats, err = repo.GetPortfolioStats(ctx, &GetPortfolioStatsInput{
+			Filter: filter, RankBy: PortfolioRankByDensity, RankLimit: 2,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{denseId, tallId}, rankedEstateIds(stats.Top))
+		assert.Equal(t, []string{emptyId, tallId}, rankedEstateIds(stats.Bottom))
+	})
+
+	t.Run("Drone plans", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		plan := CalculateDroneDistanceOutput{TotalDistance: 60, TotalVerticalDistance: 20, TotalHorizontalDistance: 40, LastAchievableXCoordinate: 5, LastAchievableYCoordinate: 1}
+
+		stored, err := repo.GetDronePlan(ctx, &GetDronePlanInput{EstateId: estateId, ParamsKey: "scale=10", Revision: 1})
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+
+		for _, tc := range []struct {
+			revision      int64
+			expectedSaved bool
+		}{{1, true}, {1, false}, {0, false}, {2, true}} {
+			saved, err := repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: estateId, ParamsKey: "scale=10", Revision: tc.revision, Plan: plan})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSaved, saved.Saved, "revision %d", tc.revision)
+		}
+
+		stored, err = repo.GetDronePlan(ctx, &GetDronePlanInput{EstateId: estateId, ParamsKey: "scale=10", Revision: 2})
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, plan, stored.Plan)
+		for _, input := range []GetDronePlanInput{{EstateId: estateId, ParamsKey: "scale=10", Revision: 1}, {EstateId: estateId, ParamsKey: "scale=20", Revision: 2}} {
+			input := input
+			stored, err = repo.GetDronePlan(ctx, &input)
+			require.NoError(t, err)
+			assert.Nil(t, stored)
+		}
+
+		_, err = repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: uuid.New().String(), ParamsKey: "scale=10", Revision: 1, Plan: plan})
+		assert.Error(t, err, "the estate of a drone plan must exist")
+
+		// The plans of the largest estates fly further than the range of a 32 bits integer.
+		long := CalculateDroneDistanceOutput{TotalDistance: 2_500_099_990, TotalVerticalDistance: 100_000, TotalHorizontalDistance: 2_499_999_990, LastAchievableXCoordinate: 50000, LastAchievableYCoordinate: 5000}
+		_, err = repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: estateId, ParamsKey: "scale=10", Revision: 3, Plan: long})
+		require.NoError(t, err)
+		stored, err = repo.GetDronePlan(ctx, &GetDronePlanInput{EstateId: estateId, ParamsKey: "scale=10", Revision: 3})
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, long, stored.Plan)
+	})
+
+	t.Run("Drone plans bound", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		plan := CalculateDroneDistanceOutput{TotalDistance: 60, TotalVerticalDistance: 20, TotalHorizontalDistance: 40, LastAchievableXCoordinate: 5, LastAchievableYCoordinate: 1}
+		paramsKey := func(maxDistance int) string { return fmt.Sprintf("scale=10;max=%d", maxDistance) }
+		countStored := func(revision int64, maxDistances int) (count int) {
+			for maxDistance := 0; maxDistance < maxDistances; maxDistance++ {
+				stored, err := repo.GetDronePlan(ctx, &GetDronePlanInput{EstateId: estateId, ParamsKey: paramsKey(maxDistance), Revision: revision})
+				require.NoError(t, err)
+				if stored != nil {
+					count++
+				}
+			}
+			return count
+		}
+
+		// The plans of the earlier revisions are removed by the plan of a later one.
+		for maxDistance := 0; maxDistance < 3; maxDistance++ {
+			_, err := repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: estateId, ParamsKey: paramsKey(maxDistance), Revision: 1, Plan: plan})
+			require.NoError(t, err)
+		}
+		_, err := repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: estateId, ParamsKey: paramsKey(0), Revision: 2, Plan: plan})
+		require.NoError(t, err)
+		assert.Equal(t, 0, countStored(1, 3))
+
+		// Every max distance has its own plan, up to MaxDronePlansPerEstate of them.
+		for maxDistance := 1; maxDistance <= MaxDronePlansPerEstate; maxDistance++ {
+			_, err := repo.SaveDronePlan(ctx, &SaveDronePlanInput{EstateId: estateId, ParamsKey: paramsKey(maxDistance), Revision: 2, Plan: plan})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, MaxDronePlansPerEstate, countStored(2, MaxDronePlansPerEstate+1))
+		stored, err := repo.GetDronePlan(ctx, &GetDronePlanInput{EstateId: estateId, ParamsKey: paramsKey(MaxDronePlansPerEstate), Revision: 2})
+		require.NoError(t, err)
+		assert.NotNil(t, stored, "the plan just saved is kept")
+	})
+
+	t.Run("Jobs", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		kind := "test_" + uuid.New().String()[:8]
+		createJob := func(t *testing.T) Job {
+			created, err := repo.CreateJob(ctx, &CreateJobInput{Id: uuid.New().String(), Kind: kind, EstateId: estateId, ContentType: "text/csv", Payload: []byte("x,y,height\n")})
+			require.NoError(t, err)
+			return created.Job
+		}
+
+		first := createJob(t)
+		assert.Equal(t, JobStateQueued, first.State)
+		// The payload is only read by the workers, when they claim the job.
+		assert.Nil(t, first.Payload)
+		assert.Empty(t, first.ErrorSamples)
+		second := createJob(t)
+
+		job, err := repo.GetJobByJobId(ctx, &GetJobByJobIdInput{Id: first.Id})
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, first.Id, job.Job.Id)
+		assert.Nil(t, job.Job.Payload)
+		job, err = repo.GetJobByJobId(ctx, &GetJobByJobIdInput{Id: uuid.New().String()})
+		require.NoError(t, err)
+		assert.Nil(t, job)
+
+		// The oldest queued job is claimed first.
+		claimed, err := repo.ClaimNextJob(ctx, &ClaimNextJobInput{Kind: kind})
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		assert.Equal(t, first.Id, claimed.Job.Id)
+		assert.Equal(t, JobStateRunning, claimed.Job.State)
+		assert.Equal(t, []byte("x,y,height\n"), claimed.Job.Payload)
+
+		progress, err := repo.UpdateJobProgress(ctx, &UpdateJobProgressInput{
+			Id: first.Id, State: JobStateRunning, TotalRows: 3, ProcessedRows: 2, SucceededRows: 1, FailedRows: 1,
+			ErrorSamples: []JobError{{Row: 2, Message: "height must be at most 30"}},
+		})
+		require.NoError(t, err)
+		assert.False(t, progress.CancelRequested)
+		job, err = repo.GetJobByJobId(ctx, &GetJobByJobIdInput{Id: first.Id})
+		require.NoError(t, err)
+		assert.Equal(t, 2, job.Job.ProcessedRows)
+		assert.Equal(t, []JobError{{Row: 2, Message: "height must be at most 30"}}, job.Job.ErrorSamples)
+
+		// A running job is cancelled by its worker, at its next checkpoint.
+		cancelled, err := repo.RequestJobCancellation(ctx, &RequestJobCancellationInput{Id: first.Id})
+		require.NoError(t, err)
+		assert.Equal(t, JobStateRunning, cancelled.Job.State)
+		assert.True(t, cancelled.Job.CancelRequested)
+		assert.Nil(t, cancelled.Job.Payload)
+		progress, err = repo.UpdateJobProgress(ctx, &UpdateJobProgressInput{Id: first.Id, State: JobStateCancelled})
+		require.NoError(t, err)
+		assert.True(t, progress.CancelRequested)
+
+		// A finished job is left untouched.
+		cancelled, err = repo.RequestJobCancellation(ctx, &RequestJobCancellationInput{Id: first.Id})
+		require.NoError(t, err)
+		assert.Equal(t, JobStateCancelled, cancelled.Job.State)
+		assert.False(t, cancelled.Job.CancelRequested)
+
+		// A queued job is cancelled right away.
+		cancelled, err = repo.RequestJobCancellation(ctx, &RequestJobCancellationInput{Id: second.Id})
+		require.NoError(t, err)
+		assert.Equal(t, JobStateCancelled, cancelled.Job.State)
+		claimed, err = repo.ClaimNextJob(ctx, &ClaimNextJobInput{Kind: kind})
+		require.NoError(t, err)
+		assert.Nil(t, claimed)
+
+		cancelled, err = repo.RequestJobCancellation(ctx, &RequestJobCancellationInput{Id: uuid.New().String()})
+		require.NoError(t, err)
+		assert.Nil(t, cancelled)
+		_, err = repo.UpdateJobProgress(ctx, &UpdateJobProgressInput{Id: uuid.New().String(), State: JobStateRunning})
+		assert.Error(t, err)
+		_, err = repo.CreateJob(ctx, &CreateJobInput{Id: uuid.New().String(), Kind: kind, EstateId: uuid.New().String(), ContentType: "text/csv", Payload: []byte{}})
+		assert.Error(t, err, "the estate of a job must exist")
+	})
+
+	t.Run("Stale jobs", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		kind := "test_" + uuid.New().String()[:8]
+		created, err := repo.CreateJob(ctx, &CreateJobInput{Id: uuid.New().String(), Kind: kind, EstateId: estateId, ContentType: "text/csv", Payload: []byte{}})
+		require.NoError(t, err)
+		_, err = repo.ClaimNextJob(ctx, &ClaimNextJobInput{Kind: kind})
+		require.NoError(t, err)
+
+		_, err = repo.RequeueStaleJobs(ctx, &RequeueStaleJobsInput{StaleBefore: time.Now().Add(-time.Hour)})
+		require.NoError(t, err)
+		job, err := repo.GetJobByJobId(ctx, &GetJobByJobIdInput{Id: created.Job.Id})
+		require.NoError(t, err)
+		assert.Equal(t, JobStateRunning, job.Job.State, "a job checkpointed recently is not stale")
+
+		requeued, err := repo.RequeueStaleJobs(ctx, &RequeueStaleJobsInput{StaleBefore: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, requeued.Count, 1)
+		job, err = repo.GetJobByJobId(ctx, &GetJobByJobIdInput{Id: created.Job.Id})
+		require.NoError(t, err)
+		assert.Equal(t, JobStateQueued, job.Job.State)
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		length, width := randomDimension(), randomDimension()
+		estateId := createTestEstate(t, repo, length, width)
+		emptyEstateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		createTestTree(t, repo, estateId, 2, 2, 4)
+		createTestTree(t, repo, estateId, 1, 2, 5)
+		createTestTree(t, repo, estateId, 3, 1, 6)
+
+		var rows []ExportRow
+		exported, err := repo.ExportEstateTrees(ctx, &ExportEstateTreesInput{
+			EstateId: estateId,
+			OnRow: func(row *ExportRow) error {
+				rows = append(rows, *row)
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, exported.Count)
+		require.Len(t, rows, 3)
+		for i, plot := range [][3]int{{3, 1, 6}, {1, 2, 5}, {2, 2, 4}} {
+			assert.Equal(t, plot, [3]int{rows[i].X, rows[i].Y, rows[i].Height}, "rows are ordered by y then x")
+			assert.Equal(t, estateId, rows[i].EstateId)
+			assert.Equal(t, [2]int{length, width}, [2]int{rows[i].Length, rows[i].Width})
+			assert.NotEmpty(t, rows[i].TreeId)
+			assert.False(t, rows[i].TreeCreatedAt.IsZero())
+		}
+
+		rows = nil
+		_, err = repo.ExportEstateTrees(ctx, &ExportEstateTreesInput{
+			EstateId: emptyEstateId,
+			OnRow: func(row *ExportRow) error {
+				rows = append(rows, *row)
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, rows, 1, "an estate without trees is a single row")
+		assert.Empty(t, rows[0].TreeId)
+
+		stop := errors.New("stop")
+		_, err = repo.ExportEstateTrees(ctx, &ExportEstateTreesInput{
+			EstateId: estateId,
+			OnRow:    func(row *ExportRow) error { return stop },
+		})
+		assert.ErrorIs(t, err, stop)
+	})
+
+	t.Run("Concurrent trees", func(t *testing.T) {
+		estateId := createTestEstate(t, repo, randomDimension(), randomDimension())
+		const trees = 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < trees; i++ {
+			wg.Add(1)
+			go func(x int) {
+				defer wg.Done()
+				_, err := repo.CreateTree(ctx, &CreateTreeInput{Id: uuid.New().String(), EstateId: estateId, X: x, Y: 1, Height: 10})
+				assert.NoError(t, err)
+			}(i + 1)
+		}
+		wg.Wait()
+
+		estateTrees, err := repo.GetEstateTreesByEstateId(ctx, &GetEstateTreesByEstateIdInput{EstateId: estateId})
+		require.NoError(t, err)
+		assert.Len(t, estateTrees.Trees, trees)
+		assert.Equal(t, int64(trees), estateTrees.Estate.Revision, "every tree bumps the revision")
+	})
+}
+
+// randomDimension returns a length or a width which is unlikely to be used by another estate of the database.
+func randomDimension() int {
+	return 1000 + rand.Intn(48000)
+}
+
+func createTestEstate(t *testing.T, repo RepositoryInterface, length, width int) string {
+	t.Helper()
+	created, err := repo.CreateEstate(context.Background(), &CreateEstateInput{Id: uuid.New().String(), Length: uint16(length), Width: uint16(width)})
+	require.NoError(t, err)
+	return created.Id
+}
+
+func createTestTree(t *testing.T, repo RepositoryInterface, estateId string, x, y, height int) string {
+	t.Helper()
+	created, err := repo.CreateTree(context.Background(), &CreateTreeInput{Id: uuid.New().String(), EstateId: estateId, X: x, Y: y, Height: height})
+	require.NoError(t, err)
+	return created.Id
+}
+
+func rankedEstateIds(ranks []EstateRank) []string {
+	ids := make([]string, 0, len(ranks))
+	for _, rank := range ranks {
+		ids = append(ids, rank.EstateId)
+	}
+	return ids
+}
+
+func intPointer(i int) *int {
+	return &i
+}
@@ -3,7 +3,12 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"log"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // CreateEstate creates a new estate in the plantation management service.
@@ -25,28 +30,37 @@ func (r *Repository) CreateEstate(ctx context.Context, input *CreateEstateInput)
 		ON CONFLICT (length, width)
 		DO UPDATE SET
 			created_at = now()
+			,revision = estates.revision + 1
 		RETURNING id;
    `
 	tx, err := r.Db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("err starting transaction to create estate: ", err)
+		slog.ErrorContext(ctx, "err starting transaction to create estate", "error", err)
 		return nil, err
 	}
 	defer tx.Rollback()
 	output = &CreateEstateOutput{}
 	err = tx.QueryRow(sqlStatement, input.Id, input.Length, input.Width).Scan(&output.Id)
 	if err != nil {
-		log.Println("err executiing query to create estate: ", err)
+		slog.ErrorContext(ctx, "err executiing query to create estate", "error", err)
 		return nil, err
 	}
 
 	if err = tx.Commit(); err != nil {
-		log.Println("err committing transaction to create estate: ", err)
+		slog.ErrorContext(ctx, "err committing transaction to create estate", "error", err)
 		return nil, err
 	}
 	return output, nil
 }
 
+// estateLastModifiedColumn selects the time of the newest change of an estate or of its trees.
+// Trees are never updated, so the newest change of the trees is the creation of the newest tree.
+const estateLastModifiedColumn = `GREATEST(estates.created_at, (
+				SELECT MAX(trees.created_at)
+				FROM plantation_management_service.trees
+				WHERE trees.estate_id = estates.id
+			)) AS last_modified`
+
 // GetEstateByEstateId retrieves the length and width of an estate by its ID.
 // It takes a context.Context and a *GetEstateByEstateIdInput as input, and returns
 // a *GetEstateByEstateIdOutput and an error.
@@ -60,18 +74,20 @@ func (r *Repository) GetEstateByEstateId(ctx context.Context, input *GetEstateBy
 		SELECT
 			estates.length
 			,estates.width
+			,estates.revision
+			,` + estateLastModifiedColumn + `
 		FROM
 			plantation_management_service.estates
 		WHERE estates.id = $1;
    `
 	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Id)
 	output = &GetEstateByEstateIdOutput{}
-	err = row.Scan(&output.Estate.Length, &output.Estate.Width)
+	err = row.Scan(&output.Estate.Length, &output.Estate.Width, &output.Estate.Revision, &output.Estate.LastModified)
 	if err == sql.ErrNoRows {
-		log.Println("err no estate is found:", err)
+		slog.DebugContext(ctx, "err no estate is found", "error", err)
 		return nil, nil
 	} else if err != nil {
-		log.Println("err executing query to select the length and the width of the estate:", err)
+		slog.ErrorContext(ctx, "err executing query to select the length and the width of the estate", "error", err)
 		return nil, err
 	}
 	return output, nil
@@ -94,7 +110,38 @@ func (r *Repository) IsTreeExist(ctx context.Context, input *IsTreeExistInput) (
 	output = &IsTreeExistOutput{}
 	err = row.Scan(&output.IsExist)
 	if err != nil {
-		log.Println("err executing query to check whether a certain tree exist or not:", err)
+		slog.ErrorContext(ctx, "err executing query to check whether a certain tree exist or not", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// bumpEstateRevisionStatement must run in the transaction of every mutation of the trees of an estate.
+const bumpEstateRevisionStatement = `
+		UPDATE plantation_management_service.estates
+		SET revision = estates.revision + 1
+		WHERE estates.id = $1;
+   `
+
+// GetTreeByTreeId retrieves the coordinates and the height of a tree of an estate.
+// It returns nil when the tree does not exist or belongs to another estate.
+func (r *Repository) GetTreeByTreeId(ctx context.Context, input *GetTreeByTreeIdInput) (output *GetTreeByTreeIdOutput, err error) {
+	sqlStatement := `
+		SELECT
+			trees.x
+			,trees.y
+			,trees.height
+		FROM
+			plantation_management_service.trees
+		WHERE trees.id = $1 AND trees.estate_id = $2;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.EstateId)
+	output = &GetTreeByTreeIdOutput{}
+	err = row.Scan(&output.Tree.X, &output.Tree.Y, &output.Tree.Height)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to select the tree", "error", err)
 		return nil, err
 	}
 	return output, nil
@@ -118,19 +165,27 @@ func (r *Repository) CreateTree(ctx context.Context, input *CreateTreeInput) (ou
    `
 	tx, err := r.Db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("err starting transaction to create tree: ", err)
+		slog.ErrorContext(ctx, "err starting transaction to create tree", "error", err)
 		return nil, err
 	}
 	defer tx.Rollback()
 	output = &CreateTreeOutput{}
 	err = tx.QueryRow(sqlStatement, input.Id, input.EstateId, input.X, input.Y, input.Height).Scan(&output.Id)
 	if err != nil {
-		log.Println("err executing query to create tree: ", err)
+		slog.ErrorContext(ctx, "err executing query to create tree", "error", err)
+		return nil, err
+	}
+
+	// Bump the revision of the estate in the same transaction, so that no cached drone plan
+	// can outlive the tree.
+	_, err = tx.Exec(bumpEstateRevisionStatement, input.EstateId)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to bump the estate revision", "error", err)
 		return nil, err
 	}
 
 	if err = tx.Commit(); err != nil {
-		log.Println("err committing transaction to create tree: ", err)
+		slog.ErrorContext(ctx, "err committing transaction to create tree", "error", err)
 		return nil, err
 	}
 	return output, nil
@@ -138,6 +193,8 @@ func (r *Repository) CreateTree(ctx context.Context, input *CreateTreeInput) (ou
 
 // GetEstateStatsByEstateId retrieves various statistics about the trees in an estate, including the total number of trees, the maximum and minimum tree heights, and the median tree height.
 // The input parameter EstateId specifies the ID of the estate to retrieve the statistics for.
+// When requested, the mean, the population standard deviation, arbitrary percentiles and a height histogram are computed as well.
+// The percentiles use the same interpolation as the median (PERCENTILE_CONT).
 // The output is a GetEstateStatsByEstateIdOutput struct containing the requested statistics.
 func (r *Repository) GetEstateStatsByEstateId(ctx context.Context, input *GetEstateStatsByEstateIdInput) (output *GetEstateStatsByEstateIdOutput, err error) {
 	sqlStatement := `
@@ -146,15 +203,364 @@ func (r *Repository) GetEstateStatsByEstateId(ctx context.Context, input *GetEst
 			,COALESCE(MAX(trees.height), 0) AS max_height
 			,COALESCE(MIN(trees.height), 0) AS min_height
 			,COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY trees.height), 0) AS median_height
+			,COALESCE(AVG(trees.height), 0) AS mean_height
+			,COALESCE(STDDEV_POP(trees.height), 0) AS stddev_height
+			,PERCENTILE_CONT($2::FLOAT8[]) WITHIN GROUP (ORDER BY trees.height) AS percentile_heights
 		FROM
 			plantation_management_service.trees
-		WHERE trees.estate_id = $1;
+		WHERE trees.estate_id = $1 AND ($3::TIMESTAMPTZ IS NULL OR trees.created_at <= $3);
    `
-	row := r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId)
+	percentiles := input.Percentiles
+	if !input.IncludeDistribution {
+		percentiles = nil
+	}
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId, pq.Float64Array(percentiles), input.AsOf)
 	output = &GetEstateStatsByEstateIdOutput{}
-	err = row.Scan(&output.Count, &output.Max, &output.Min, &output.Median)
+	var percentileHeights pq.Float64Array
+	err = row.Scan(&output.Count, &output.Max, &output.Min, &output.Median, &output.Mean, &output.StdDev, &percentileHeights)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get estate stats by estate id", "error", err)
+		return nil, err
+	}
+
+	if input.IncludeDistribution {
+		// Without trees, PERCENTILE_CONT returns NULL, which is reported as 0 like the median.
+		output.Percentiles = make([]float64, len(percentiles))
+		copy(output.Percentiles, percentileHeights)
+	} else {
+		output.Mean, output.StdDev = 0, 0
+	}
+
+	if input.HistogramBuckets > 0 {
+		output.Histogram, err = r.getEstateHeightHistogram(ctx, input.EstateId, input.HistogramBuckets, input.AsOf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// NewHistogramBuckets splits the tree heights into the given number of equally wide buckets.
+// A height h falls into the bucket ((h - MinTreeHeight) * buckets) / (MaxTreeHeight - MinTreeHeight + 1),
+// using integer division, so that every bucket holds at least one height when there are at most
+// as many buckets as heights.
+func NewHistogramBuckets(buckets int) []HistogramBucket {
+	heights := MaxTreeHeight - MinTreeHeight + 1
+	histogram := make([]HistogramBucket, buckets)
+	for i := range histogram {
+		histogram[i].Min = MinTreeHeight + (i*heights+buckets-1)/buckets
+		histogram[i].Max = MinTreeHeight + ((i+1)*heights+buckets-1)/buckets - 1
+	}
+	return histogram
+}
+
+// getEstateHeightHistogram counts the trees of an estate per height bucket, see NewHistogramBuckets.
+func (r *Repository) getEstateHeightHistogram(ctx context.Context, estateId string, buckets int, asOf *time.Time) ([]HistogramBucket, error) {
+	sqlStatement := `
+		SELECT
+			((trees.height - $3) * $2) / ($4 - $3 + 1) AS bucket
+			,COUNT(*) AS total_trees
+		FROM
+			plantation_management_service.trees
+		WHERE trees.estate_id = $1 AND ($5::TIMESTAMPTZ IS NULL OR trees.created_at <= $5)
+		GROUP BY bucket;
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, estateId, buckets, MinTreeHeight, MaxTreeHeight, asOf)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the height histogram of an estate", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	histogram := NewHistogramBuckets(buckets)
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		if bucket >= 0 && bucket < buckets {
+			histogram[bucket].Count = count
+		}
+	}
+	return histogram, rows.Err()
+}
+
+// statsIntervals maps the StatsInterval constants to the date_trunc field and the length of a period.
+var statsIntervals = map[string]struct{ field, length string }{
+	StatsIntervalDay:     {"day", "1 day"},
+	StatsIntervalWeek:    {"week", "1 week"},
+	StatsIntervalMonth:   {"month", "1 month"},
+	StatsIntervalQuarter: {"quarter", "3 months"},
+	StatsIntervalYear:    {"year", "1 year"},
+}
+
+// GetEstateStatsSeriesByEstateId buckets the trees of an estate by the period they were planted in, from the
+// period of the first tree (or of Since) up to AsOf.
+// Every point counts the trees planted during its period, and computes the count, median and mean height of
+// all the trees planted up to the end of the period, so that the series keeps working once heights can change.
+// An estate without trees planted before AsOf has no point.
+func (r *Repository) GetEstateStatsSeriesByEstateId(ctx context.Context, input *GetEstateStatsSeriesByEstateIdInput) (output *GetEstateStatsSeriesByEstateIdOutput, err error) {
+	interval, ok := statsIntervals[input.Interval]
+	if !ok {
+		return nil, fmt.Errorf("err unknown stats interval %q", input.Interval)
+	}
+
+	sqlStatement := `
+		WITH bounds AS (
+			SELECT
+				date_trunc($2, COALESCE($5::TIMESTAMPTZ, MIN(trees.created_at))) AS first_period
+			FROM
+				plantation_management_service.trees
+			WHERE trees.estate_id = $1 AND trees.created_at <= $4
+		), periods AS (
+			SELECT
+				period_start
+				,period_start + $3::INTERVAL AS next_period_start
+			FROM
+				bounds
+				CROSS JOIN generate_series(bounds.first_period, $4::TIMESTAMPTZ, $3::INTERVAL) AS period_start
+			ORDER BY period_start
+			LIMIT $6
+		)
+		SELECT
+			periods.period_start
+			,LEAST(periods.next_period_start, $4::TIMESTAMPTZ) AS period_end
+			,COUNT(trees.height) FILTER (WHERE trees.created_at >= periods.period_start) AS new_trees
+			,COUNT(trees.height) AS total_trees
+			,COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY trees.height), 0) AS median_height
+			,COALESCE(AVG(trees.height), 0) AS mean_height
+		FROM
+			periods
+			LEFT JOIN plantation_management_service.trees ON trees.estate_id = $1
+				AND trees.created_at < periods.next_period_start
+				AND trees.created_at <= $4
+		GROUP BY periods.period_start, periods.next_period_start
+		ORDER BY periods.period_start;
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId, interval.field, interval.length, input.AsOf, input.Since, input.MaxPoints)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get estate stats series by estate id", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	output = &GetEstateStatsSeriesByEstateIdOutput{}
+	for rows.Next() {
+		var point EstateStatsPoint
+		err = rows.Scan(&point.PeriodStart, &point.PeriodEnd, &point.NewTrees, &point.Count, &point.Median, &point.Mean)
+		if err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		output.Points = append(output.Points, point)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// filteredEstatesCTE selects the estates matching an EstateFilter passed as the parameters $1 to $6,
+// see estateFilterArgs.
+const filteredEstatesCTE = `
+		filtered_estates AS (
+			SELECT
+				estates.id
+				,estates.length
+				,estates.width
+			FROM
+				plantation_management_service.estates
+			WHERE ($1::INTEGER IS NULL OR estates.length >= $1)
+				AND ($2::INTEGER IS NULL OR estates.length <= $2)
+				AND ($3::INTEGER IS NULL OR estates.width >= $3)
+				AND ($4::INTEGER IS NULL OR estates.width <= $4)
+				AND ($5::TIMESTAMPTZ IS NULL OR estates.created_at >= $5)
+				AND ($6::TIMESTAMPTZ IS NULL OR estates.created_at < $6)
+		)`
+
+func estateFilterArgs(filter EstateFilter) []any {
+	return []any{filter.MinLength, filter.MaxLength, filter.MinWidth, filter.MaxWidth, filter.CreatedAfter, filter.CreatedBefore}
+}
+
+// GetPortfolioStats computes the statistics of all the trees of the estates matching the filter, and ranks
+// these estates by median height or by density.
+// Estates without trees have no median height, so they are only ranked by density.
+func (r *Repository) GetPortfolioStats(ctx context.Context, input *GetPortfolioStatsInput) (output *GetPortfolioStatsOutput, err error) {
+	sqlStatement := `
+		WITH` + filteredEstatesCTE + `
+		SELECT
+			(SELECT COUNT(*) FROM filtered_estates) AS total_estates
+			,(SELECT COALESCE(SUM(filtered_estates.length::BIGINT * filtered_estates.width), 0) FROM filtered_estates) AS total_plots
+			,COUNT(trees.height) AS total_trees
+			,COALESCE(MAX(trees.height), 0) AS max_height
+			,COALESCE(MIN(trees.height), 0) AS min_height
+			,COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY trees.height), 0) AS median_height
+			,COALESCE(AVG(trees.height), 0) AS mean_height
+			,COALESCE(STDDEV_POP(trees.height), 0) AS stddev_height
+			,PERCENTILE_CONT($7::FLOAT8[]) WITHIN GROUP (ORDER BY trees.height) AS percentile_heights
+		FROM
+			filtered_estates
+			JOIN plantation_management_service.trees ON trees.estate_id = filtered_estates.id;
+   `
+	args := append(estateFilterArgs(input.Filter), pq.Float64Array(input.Percentiles))
+	row := r.Db.QueryRowContext(ctx, sqlStatement, args...)
+	output = &GetPortfolioStatsOutput{}
+	var percentileHeights pq.Float64Array
+	err = row.Scan(&output.Estates, &output.Plots, &output.Count, &output.Max, &output.Min, &output.Median, &output.Mean, &output.StdDev, &percentileHeights)
 	if err != nil {
-		log.Println("err executing query to get estate stats by estate id:", err)
+		slog.ErrorContext(ctx, "err executing query to get portfolio stats", "error", err)
+		return nil, err
+	}
+	// Without trees, PERCENTILE_CONT returns NULL, which is reported as 0 like the median.
+	output.Percentiles = make([]float64, len(input.Percentiles))
+	copy(output.Percentiles, percentileHeights)
+
+	output.Top, output.Bottom, err = r.getPortfolioRanking(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// getPortfolioRanking returns the RankLimit best and worst ranked estates matching the filter.
+// Ties are broken by estate id so that the ranking is stable.
+func (r *Repository) getPortfolioRanking(ctx context.Context, input *GetPortfolioStatsInput) (top, bottom []EstateRank, err error) {
+	sqlStatement := `
+		WITH` + filteredEstatesCTE + `, estate_stats AS (
+			SELECT
+				filtered_estates.id
+				,filtered_estates.length
+				,filtered_estates.width
+				,COUNT(trees.height) AS total_trees
+				,PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY trees.height) AS median_height
+			FROM
+				filtered_estates
+				LEFT JOIN plantation_management_service.trees ON trees.estate_id = filtered_estates.id
+			GROUP BY filtered_estates.id, filtered_estates.length, filtered_estates.width
+		), ranked_estates AS (
+			SELECT
+				estate_stats.*
+				,ROW_NUMBER() OVER (ORDER BY rank_value DESC, estate_stats.id) AS top_rank
+				,ROW_NUMBER() OVER (ORDER BY rank_value ASC, estate_stats.id) AS bottom_rank
+			FROM
+				estate_stats
+				CROSS JOIN LATERAL (
+					SELECT CASE WHEN $7 = 'density'
+						THEN estate_stats.total_trees::FLOAT8 / (estate_stats.length::BIGINT * estate_stats.width)
+						ELSE estate_stats.median_height
+					END AS rank_value
+				) AS rank_values
+			WHERE rank_value IS NOT NULL
+		)
+		SELECT
+			ranked_estates.id
+			,ranked_estates.length
+			,ranked_estates.width
+			,ranked_estates.total_trees
+			,COALESCE(ranked_estates.median_height, 0)
+			,ranked_estates.top_rank
+			,ranked_estates.bottom_rank
+		FROM
+			ranked_estates
+		WHERE ranked_estates.top_rank <= $8 OR ranked_estates.bottom_rank <= $8
+		ORDER BY ranked_estates.top_rank;
+   `
+	args := append(estateFilterArgs(input.Filter), input.RankBy, input.RankLimit)
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get portfolio ranking", "error", err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	top, bottom = []EstateRank{}, []EstateRank{}
+	for rows.Next() {
+		var rank EstateRank
+		var topRank, bottomRank int
+		err = rows.Scan(&rank.EstateId, &rank.Length, &rank.Width, &rank.Count, &rank.Median, &topRank, &bottomRank)
+		if err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, nil, err
+		}
+		if topRank <= input.RankLimit {
+			top = append(top, rank)
+		}
+		if bottomRank <= input.RankLimit {
+			// Rows come best first, so the worst estates are prepended to keep them worst first.
+			bottom = append([]EstateRank{rank}, bottom...)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, nil, err
+	}
+	return top, bottom, nil
+}
+
+// GetEstateGroupedStatsByEstateId partitions an estate into blocks of BlockLength x BlockWidth plots and
+// retrieves the number of trees and the maximum, minimum, median and mean tree heights of every block.
+// Grouping by row or by column is a block as long or as wide as the estate.
+// Every block of the estate is returned, including the blocks without trees, ordered by BlockY then BlockX.
+// If the estate does not exist, no group is returned.
+func (r *Repository) GetEstateGroupedStatsByEstateId(ctx context.Context, input *GetEstateGroupedStatsByEstateIdInput) (output *GetEstateGroupedStatsByEstateIdOutput, err error) {
+	sqlStatement := `
+		WITH blocks AS (
+			SELECT
+				block_x
+				,block_y
+			FROM
+				plantation_management_service.estates
+				CROSS JOIN generate_series(0, (estates.length - 1) / $2) AS block_x
+				CROSS JOIN generate_series(0, (estates.width - 1) / $3) AS block_y
+			WHERE estates.id = $1
+		), grouped_trees AS (
+			SELECT
+				(trees.x - 1) / $2 AS block_x
+				,(trees.y - 1) / $3 AS block_y
+				,COUNT(trees.height) AS total_trees
+				,MAX(trees.height) AS max_height
+				,MIN(trees.height) AS min_height
+				,PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY trees.height) AS median_height
+				,AVG(trees.height) AS mean_height
+			FROM
+				plantation_management_service.trees
+			WHERE trees.estate_id = $1
+			GROUP BY 1, 2
+		)
+		SELECT
+			blocks.block_x
+			,blocks.block_y
+			,COALESCE(grouped_trees.total_trees, 0)
+			,COALESCE(grouped_trees.max_height, 0)
+			,COALESCE(grouped_trees.min_height, 0)
+			,COALESCE(grouped_trees.median_height, 0)
+			,COALESCE(grouped_trees.mean_height, 0)
+		FROM
+			blocks
+			LEFT JOIN grouped_trees USING (block_x, block_y)
+		ORDER BY blocks.block_y, blocks.block_x;
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId, input.BlockLength, input.BlockWidth)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get estate grouped stats by estate id", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	output = &GetEstateGroupedStatsByEstateIdOutput{}
+	for rows.Next() {
+		var group EstateStatsGroup
+		err = rows.Scan(&group.BlockX, &group.BlockY, &group.Count, &group.Max, &group.Min, &group.Median, &group.Mean)
+		if err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		output.Groups = append(output.Groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
 		return nil, err
 	}
 	return output, nil
@@ -163,6 +569,7 @@ func (r *Repository) GetEstateStatsByEstateId(ctx context.Context, input *GetEst
 // GetEstateTreesByEstateId retrieves the trees for a given estate, including their x, y coordinates and height.
 // The input parameter EstateId specifies the ID of the estate to retrieve the trees for.
 // The output is a GetEstateTreesByEstateIdOutput struct containing the requested tree data, as well as the length and width of the estate.
+// If no estate is found, both the output and the error are nil.
 func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *GetEstateTreesByEstateIdInput) (output *GetEstateTreesByEstateIdOutput, err error) {
 	sqlStatement := `
 		SELECT
@@ -177,7 +584,7 @@ func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *GetEst
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
-		log.Println("err executing query to get the trees belonging to a certain estate id:", err)
+		slog.ErrorContext(ctx, "err executing query to get the trees belonging to a certain estate id", "error", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -188,7 +595,7 @@ func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *GetEst
 
 		err := rows.Scan(&tree.X, &tree.Y, &tree.Height)
 		if err != nil {
-			log.Println("err when reading the rows as result from the query:", err)
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
 			return nil, err
 		}
 
@@ -199,18 +606,367 @@ func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *GetEst
 		SELECT
 			estates.length
 			,estates.width
+			,estates.revision
+			,` + estateLastModifiedColumn + `
 		FROM plantation_management_service.estates
 		WHERE estates.id = $1;
    `
 
 	row := r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId)
 	var estate Estate
-	err = row.Scan(&estate.Length, &estate.Width)
-	if err != nil {
-		log.Println("err executing query to get the estate length and the estate width:", err)
+	err = row.Scan(&estate.Length, &estate.Width, &estate.Revision, &estate.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the estate length and the estate width", "error", err)
 		return nil, err
 	}
 	output.Estate = estate
 
 	return output, err
 }
+
+// GetDronePlan retrieves the drone plan stored for an estate and a set of planner parameters.
+// If no plan is stored for the given revision of the estate, both the output and the error are nil.
+func (r *Repository) GetDronePlan(ctx context.Context, input *GetDronePlanInput) (output *GetDronePlanOutput, err error) {
+	sqlStatement := `
+		SELECT
+			drone_plans.total_distance
+			,drone_plans.total_vertical_distance
+			,drone_plans.total_horizontal_distance
+			,drone_plans.last_x
+			,drone_plans.last_y
+		FROM
+			plantation_management_service.drone_plans
+		WHERE drone_plans.estate_id = $1 AND drone_plans.params_key = $2 AND drone_plans.revision = $3;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision)
+	output = &GetDronePlanOutput{}
+	plan := &output.Plan
+	err = row.Scan(&plan.TotalDistance, &plan.TotalVerticalDistance, &plan.TotalHorizontalDistance, &plan.LastAchievableXCoordinate, &plan.LastAchievableYCoordinate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the drone plan", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// SaveDronePlan stores the drone plan of an estate for a set of planner parameters, replacing the plan
+// of an earlier revision. A plan of a later revision is never replaced. The plans stored per estate are
+// bounded, see MaxDronePlansPerEstate.
+func (r *Repository) SaveDronePlan(ctx context.Context, input *SaveDronePlanInput) (output *SaveDronePlanOutput, err error) {
+	sqlStatement := `
+		INSERT INTO plantation_management_service.drone_plans (
+			estate_id
+			,params_key
+			,revision
+			,total_distance
+			,total_vertical_distance
+			,total_horizontal_distance
+			,last_x
+			,last_y
+			,created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+		ON CONFLICT (estate_id, params_key)
+		DO UPDATE SET
+			revision = EXCLUDED.revision
+			,total_distance = EXCLUDED.total_distance
+			,total_vertical_distance = EXCLUDED.total_vertical_distance
+			,total_horizontal_distance = EXCLUDED.total_horizontal_distance
+			,last_x = EXCLUDED.last_x
+			,last_y = EXCLUDED.last_y
+			,created_at = EXCLUDED.created_at
+		WHERE drone_plans.revision < EXCLUDED.revision;
+   `
+	plan := input.Plan
+	result, err := r.Db.ExecContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision,
+		plan.TotalDistance, plan.TotalVerticalDistance, plan.TotalHorizontalDistance, plan.LastAchievableXCoordinate, plan.LastAchievableYCoordinate)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to save the drone plan", "error", err)
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "err reading the number of saved drone plans", "error", err)
+		return nil, err
+	}
+	if affected == 0 {
+		return &SaveDronePlanOutput{Saved: false}, nil
+	}
+
+	// Remove the plans of the earlier revisions, which are never read again, and the least recently saved
+	// plans above MaxDronePlansPerEstate, since every max distance requested has its own plan.
+	sqlStatement = `
+		DELETE FROM plantation_management_service.drone_plans
+		WHERE drone_plans.estate_id = $1 AND drone_plans.params_key <> $2 AND (
+			drone_plans.revision < $3
+			OR drone_plans.params_key NOT IN (
+				SELECT kept.params_key
+				FROM plantation_management_service.drone_plans AS kept
+				WHERE kept.estate_id = $1 AND kept.params_key <> $2
+				ORDER BY kept.created_at DESC, kept.params_key
+				LIMIT $4
+			)
+		)
+   `
+	_, err = r.Db.ExecContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision, MaxDronePlansPerEstate-1)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to remove the outdated drone plans", "error", err)
+		return nil, err
+	}
+	return &SaveDronePlanOutput{Saved: true}, nil
+}
+
+// jobColumns lists the columns of the jobs table in the order expected by scanJob, but the payload, which
+// is only read by ClaimNextJob since it holds up to the whole import file.
+const jobColumns = `
+			jobs.id
+			,jobs.kind
+			,jobs.state
+			,jobs.estate_id
+			,jobs.content_type
+			,jobs.total_rows
+			,jobs.processed_rows
+			,jobs.succeeded_rows
+			,jobs.failed_rows
+			,jobs.error_samples
+			,jobs.cancel_requested
+			,jobs.created_at
+			,jobs.updated_at`
+
+// scanJob reads a single job row selected with jobColumns, followed by the payload when withPayload is set.
+func scanJob(row *sql.Row, withPayload bool) (*Job, error) {
+	var job Job
+	var errorSamples []byte
+	dest := []any{&job.Id, &job.Kind, &job.State, &job.EstateId, &job.ContentType,
+		&job.TotalRows, &job.ProcessedRows, &job.SucceededRows, &job.FailedRows,
+		&errorSamples, &job.CancelRequested, &job.CreatedAt, &job.UpdatedAt}
+	if withPayload {
+		dest = append(dest, &job.Payload)
+	}
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(errorSamples, &job.ErrorSamples); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CreateJob stores a new job in the queued state, together with the payload it has to process.
+// The output contains the job as it is stored, so the caller can report it without reading it back.
+func (r *Repository) CreateJob(ctx context.Context, input *CreateJobInput) (output *CreateJobOutput, err error) {
+	sqlStatement := `
+		INSERT INTO plantation_management_service.jobs (
+			id
+			,kind
+			,state
+			,estate_id
+			,content_type
+			,payload
+			,created_at
+			,updated_at
+		)
+		VALUES ($1, $2, 'queued', $3, $4, $5, now(), now())
+		RETURNING` + jobColumns + `;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.Kind, input.EstateId, input.ContentType, input.Payload)
+	job, err := scanJob(row, false)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to create job", "error", err)
+		return nil, err
+	}
+	return &CreateJobOutput{Job: *job}, nil
+}
+
+// GetJobByJobId retrieves a job, including its payload and progress, by its ID.
+// If no job is found, both the output and the error are nil.
+func (r *Repository) GetJobByJobId(ctx context.Context, input *GetJobByJobIdInput) (output *GetJobByJobIdOutput, err error) {
+	sqlStatement := `
+		SELECT` + jobColumns + `
+		FROM
+			plantation_management_service.jobs
+		WHERE jobs.id = $1;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Id)
+	job, err := scanJob(row, false)
+	if err == sql.ErrNoRows {
+		slog.DebugContext(ctx, "err no job is found", "error", err)
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get job by job id", "error", err)
+		return nil, err
+	}
+	return &GetJobByJobIdOutput{Job: *job}, nil
+}
+
+// ClaimNextJob moves the oldest queued job of the given kind to the running state and returns it.
+// Rows locked by another instance are skipped, so several instances can share the same queue.
+// If there is nothing to claim, both the output and the error are nil.
+func (r *Repository) ClaimNextJob(ctx context.Context, input *ClaimNextJobInput) (output *ClaimNextJobOutput, err error) {
+	sqlStatement := `
+		UPDATE plantation_management_service.jobs
+		SET
+			state = 'running'
+			,updated_at = now()
+		WHERE jobs.id = (
+			SELECT queued.id
+			FROM plantation_management_service.jobs AS queued
+			WHERE queued.kind = $1 AND queued.state = 'queued'
+			ORDER BY queued.created_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING` + jobColumns + `
+			,jobs.payload;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Kind)
+	job, err := scanJob(row, true)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to claim the next job", "error", err)
+		return nil, err
+	}
+	return &ClaimNextJobOutput{Job: *job}, nil
+}
+
+// UpdateJobProgress checkpoints the state and the counters of a job.
+// The output reports whether a cancellation has been requested in the meantime, so that
+// a worker on any instance notices it at its next checkpoint.
+func (r *Repository) UpdateJobProgress(ctx context.Context, input *UpdateJobProgressInput) (output *UpdateJobProgressOutput, err error) {
+	sqlStatement := `
+		UPDATE plantation_management_service.jobs
+		SET
+			state = $2
+			,total_rows = $3
+			,processed_rows = $4
+			,succeeded_rows = $5
+			,failed_rows = $6
+			,error_samples = $7
+			,updated_at = now()
+		WHERE jobs.id = $1
+		RETURNING jobs.cancel_requested;
+   `
+	errorSamples := input.ErrorSamples
+	if errorSamples == nil {
+		errorSamples = []JobError{}
+	}
+	errorSamplesJson, err := json.Marshal(errorSamples)
+	if err != nil {
+		return nil, err
+	}
+	output = &UpdateJobProgressOutput{}
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.State, input.TotalRows, input.ProcessedRows,
+		input.SucceededRows, input.FailedRows, errorSamplesJson).Scan(&output.CancelRequested)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to update job progress", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// RequestJobCancellation flags a job for cancellation.
+// A queued job is cancelled right away, while a running job is cancelled by its worker.
+// Finished jobs are left untouched. If no job is found, both the output and the error are nil.
+func (r *Repository) RequestJobCancellation(ctx context.Context, input *RequestJobCancellationInput) (output *RequestJobCancellationOutput, err error) {
+	sqlStatement := `
+		UPDATE plantation_management_service.jobs
+		SET
+			cancel_requested = jobs.state IN ('queued', 'running')
+			,state = CASE WHEN jobs.state = 'queued' THEN 'cancelled' ELSE jobs.state END
+			,updated_at = now()
+		WHERE jobs.id = $1
+		RETURNING` + jobColumns + `;
+   `
+	row := r.Db.QueryRowContext(ctx, sqlStatement, input.Id)
+	job, err := scanJob(row, false)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to request job cancellation", "error", err)
+		return nil, err
+	}
+	return &RequestJobCancellationOutput{Job: *job}, nil
+}
+
+// RequeueStaleJobs moves running jobs that have not been checkpointed since StaleBefore back to the queue.
+// This recovers the jobs of an instance that stopped without checkpointing them.
+func (r *Repository) RequeueStaleJobs(ctx context.Context, input *RequeueStaleJobsInput) (output *RequeueStaleJobsOutput, err error) {
+	sqlStatement := `
+		UPDATE plantation_management_service.jobs
+		SET
+			state = 'queued'
+			,updated_at = now()
+		WHERE jobs.state = 'running' AND jobs.updated_at < $1;
+   `
+	result, err := r.Db.ExecContext(ctx, sqlStatement, input.StaleBefore)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to requeue stale jobs", "error", err)
+		return nil, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	return &RequeueStaleJobsOutput{Count: int(count)}, nil
+}
+
+// ExportEstateTrees reads the trees of one estate, or of all estates, joined with their estate.
+// Estates without trees are returned as a single row with an empty TreeId.
+// Rows are handed to input.OnRow while the cursor is read, so the export never holds the whole
+// result set in memory.
+func (r *Repository) ExportEstateTrees(ctx context.Context, input *ExportEstateTreesInput) (output *ExportEstateTreesOutput, err error) {
+	sqlStatement := `
+		SELECT
+			estates.id
+			,estates.length
+			,estates.width
+			,trees.id
+			,trees.x
+			,trees.y
+			,trees.height
+			,trees.created_at
+		FROM
+			plantation_management_service.estates
+			LEFT JOIN plantation_management_service.trees ON trees.estate_id = estates.id
+		WHERE $1 = '' OR estates.id = NULLIF($1, '')::UUID
+		ORDER BY estates.created_at, estates.id, trees.y, trees.x;
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to export estate trees", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	output = &ExportEstateTreesOutput{}
+	for rows.Next() {
+		var row ExportRow
+		var treeId sql.NullString
+		var x, y, height sql.NullInt64
+		var treeCreatedAt sql.NullTime
+		err = rows.Scan(&row.EstateId, &row.Length, &row.Width, &treeId, &x, &y, &height, &treeCreatedAt)
+		if err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		row.TreeId = treeId.String
+		row.X, row.Y, row.Height = int(x.Int64), int(y.Int64), int(height.Int64)
+		row.TreeCreatedAt = treeCreatedAt.Time
+
+		if err = input.OnRow(&row); err != nil {
+			return nil, err
+		}
+		output.Count++
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
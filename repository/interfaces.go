@@ -11,6 +11,19 @@ type RepositoryInterface interface {
 	GetEstateByEstateId(ctx context.Context, input *GetEstateByEstateIdInput) (output *GetEstateByEstateIdOutput, err error)
 	IsTreeExist(ctx context.Context, input *IsTreeExistInput) (output *IsTreeExistOutput, err error)
 	CreateTree(ctx context.Context, input *CreateTreeInput) (output *CreateTreeOutput, err error)
+	GetTreeByTreeId(ctx context.Context, input *GetTreeByTreeIdInput) (output *GetTreeByTreeIdOutput, err error)
 	GetEstateStatsByEstateId(ctx context.Context, input *GetEstateStatsByEstateIdInput) (output *GetEstateStatsByEstateIdOutput, err error)
+	GetEstateStatsSeriesByEstateId(ctx context.Context, input *GetEstateStatsSeriesByEstateIdInput) (output *GetEstateStatsSeriesByEstateIdOutput, err error)
+	GetPortfolioStats(ctx context.Context, input *GetPortfolioStatsInput) (output *GetPortfolioStatsOutput, err error)
+	GetEstateGroupedStatsByEstateId(ctx context.Context, input *GetEstateGroupedStatsByEstateIdInput) (output *GetEstateGroupedStatsByEstateIdOutput, err error)
+	GetDronePlan(ctx context.Context, input *GetDronePlanInput) (output *GetDronePlanOutput, err error)
+	SaveDronePlan(ctx context.Context, input *SaveDronePlanInput) (output *SaveDronePlanOutput, err error)
 	GetEstateTreesByEstateId(ctx context.Context, input *GetEstateTreesByEstateIdInput) (output *GetEstateTreesByEstateIdOutput, err error)
+	CreateJob(ctx context.Context, input *CreateJobInput) (output *CreateJobOutput, err error)
+	GetJobByJobId(ctx context.Context, input *GetJobByJobIdInput) (output *GetJobByJobIdOutput, err error)
+	ClaimNextJob(ctx context.Context, input *ClaimNextJobInput) (output *ClaimNextJobOutput, err error)
+	UpdateJobProgress(ctx context.Context, input *UpdateJobProgressInput) (output *UpdateJobProgressOutput, err error)
+	RequestJobCancellation(ctx context.Context, input *RequestJobCancellationInput) (output *RequestJobCancellationOutput, err error)
+	RequeueStaleJobs(ctx context.Context, input *RequeueStaleJobsInput) (output *RequeueStaleJobsOutput, err error)
+	ExportEstateTrees(ctx context.Context, input *ExportEstateTreesInput) (output *ExportEstateTreesOutput, err error)
 }
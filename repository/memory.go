@@ -0,0 +1,502 @@
+// This file contains the in-memory implementation of the repository layer.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository implements RepositoryInterface without a database, e.g. for local development
+// and tests. It follows the semantics of Repository, including the constraints of the tables, and
+// is safe for concurrent use. The data is lost when the process stops.
+type MemoryRepository struct {
+	mu sync.RWMutex
+	// now is the clock of the created_at and updated_at columns.
+	now func() time.Time
+
+	estates map[string]*memoryEstate
+	// estatesByDimensions enforces the unique length and width of the estates.
+	estatesByDimensions map[[2]int]*memoryEstate
+	trees               map[string]*memoryTree
+	plots               map[memoryPlot]bool
+	// dronePlans holds the drone plans by estate ID, then by planner parameters.
+	dronePlans map[string]map[string]*memoryDronePlan
+	jobs       map[string]*memoryJob
+	// jobSequence orders the jobs created at the same time.
+	jobSequence int64
+	// dronePlanSequence orders the drone plans saved at the same time.
+	dronePlanSequence int64
+}
+
+type memoryEstate struct {
+	id            string
+	length, width int
+	createdAt     time.Time
+	revision      int64
+	// trees are kept in the order they were created.
+	trees []*memoryTree
+}
+
+type memoryTree struct {
+	id, estateId string
+	x, y, height int
+	createdAt    time.Time
+}
+
+type memoryPlot struct {
+	estateId string
+	x, y     int
+}
+
+type memoryDronePlan struct {
+	revision int64
+	plan     CalculateDroneDistanceOutput
+	sequence int64
+}
+
+type memoryJob struct {
+	job      Job
+	sequence int64
+}
+
+type NewMemoryRepositoryOptions struct {
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewMemoryRepository creates a new, empty MemoryRepository with the provided options.
+func NewMemoryRepository(opts NewMemoryRepositoryOptions) *MemoryRepository {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryRepository{
+		now:                 now,
+		estates:             map[string]*memoryEstate{},
+		estatesByDimensions: map[[2]int]*memoryEstate{},
+		trees:               map[string]*memoryTree{},
+		plots:               map[memoryPlot]bool{},
+		dronePlans:          map[string]map[string]*memoryDronePlan{},
+		jobs:                map[string]*memoryJob{},
+	}
+}
+
+// CreateEstate creates a new estate. Like Repository, creating an estate with the length and the width of an
+// existing estate refreshes the creation time and the revision of the existing estate, and returns its ID.
+func (r *MemoryRepository) CreateEstate(ctx context.Context, input *CreateEstateInput) (output *CreateEstateOutput, err error) {
+	length, width := int(input.Length), int(input.Width)
+	if length < 1 || length > MaxEstateDimension || width < 1 || width > MaxEstateDimension {
+		return nil, fmt.Errorf("err estate of %d x %d plots violates the bounds of the estates table", length, width)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if estate, ok := r.estatesByDimensions[[2]int{length, width}]; ok {
+		estate.createdAt = r.now()
+		estate.revision++
+		return &CreateEstateOutput{Id: estate.id}, nil
+	}
+	if _, ok := r.estates[input.Id]; ok {
+		return nil, fmt.Errorf("err estate %s already exists", input.Id)
+	}
+
+	estate := &memoryEstate{id: input.Id, length: length, width: width, createdAt: r.now()}
+	r.estates[estate.id] = estate
+	r.estatesByDimensions[[2]int{length, width}] = estate
+	return &CreateEstateOutput{Id: estate.id}, nil
+}
+
+// snapshot returns the Estate of e, the caller must hold the lock.
+func (e *memoryEstate) snapshot() Estate {
+	lastModified := e.createdAt
+	for _, tree := range e.trees {
+		if tree.createdAt.After(lastModified) {
+			lastModified = tree.createdAt
+		}
+	}
+	return Estate{Length: e.length, Width: e.width, Revision: e.revision, LastModified: lastModified}
+}
+
+// GetEstateByEstateId retrieves an estate by its ID. If no estate is found, both the output and the error are nil.
+func (r *MemoryRepository) GetEstateByEstateId(ctx context.Context, input *GetEstateByEstateIdInput) (output *GetEstateByEstateIdOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	estate, ok := r.estates[input.Id]
+	if !ok {
+		return nil, nil
+	}
+	return &GetEstateByEstateIdOutput{Estate: estate.snapshot()}, nil
+}
+
+// IsTreeExist checks if a tree is planted at the given plot of an estate.
+func (r *MemoryRepository) IsTreeExist(ctx context.Context, input *IsTreeExistInput) (output *IsTreeExistOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &IsTreeExistOutput{IsExist: r.plots[memoryPlot{estateId: input.EstateId, x: input.X, y: input.Y}]}, nil
+}
+
+// CreateTree creates a new tree and bumps the revision of its estate.
+// Like Repository, the estate must exist and the height must be between MinTreeHeight and MaxTreeHeight.
+func (r *MemoryRepository) CreateTree(ctx context.Context, input *CreateTreeInput) (output *CreateTreeOutput, err error) {
+	if input.Height < MinTreeHeight || input.Height > MaxTreeHeight {
+		return nil, fmt.Errorf("err tree height %d violates the bounds of the trees table", input.Height)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	estate, ok := r.estates[input.EstateId]
+	if !ok {
+		return nil, fmt.Errorf("err estate %s of the tree does not exist", input.EstateId)
+	}
+	if _, ok := r.trees[input.Id]; ok {
+		return nil, fmt.Errorf("err tree %s already exists", input.Id)
+	}
+
+	tree := &memoryTree{id: input.Id, estateId: input.EstateId, x: input.X, y: input.Y, height: input.Height, createdAt: r.now()}
+	r.trees[tree.id] = tree
+	r.plots[memoryPlot{estateId: tree.estateId, x: tree.x, y: tree.y}] = true
+	estate.trees = append(estate.trees, tree)
+	estate.revision++
+	return &CreateTreeOutput{Id: tree.id}, nil
+}
+
+// GetTreeByTreeId retrieves a tree of an estate. It returns nil when the tree does not exist or belongs to another estate.
+func (r *MemoryRepository) GetTreeByTreeId(ctx context.Context, input *GetTreeByTreeIdInput) (output *GetTreeByTreeIdOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tree, ok := r.trees[input.Id]
+	if !ok || tree.estateId != input.EstateId {
+		return nil, nil
+	}
+	return &GetTreeByTreeIdOutput{Tree: Tree{X: tree.x, Y: tree.y, Height: tree.height}}, nil
+}
+
+// treeHeights returns the heights of the trees planted at or before asOf, when set, the caller must hold the lock.
+func (r *MemoryRepository) treeHeights(estateId string, asOf *time.Time) []int {
+	estate, ok := r.estates[estateId]
+	if !ok {
+		return nil
+	}
+	var heights []int
+	for _, tree := range estate.trees {
+		if asOf == nil || !tree.createdAt.After(*asOf) {
+			heights = append(heights, tree.height)
+		}
+	}
+	return heights
+}
+
+// GetEstateStatsByEstateId computes the statistics of the trees of an estate, see Repository.GetEstateStatsByEstateId.
+func (r *MemoryRepository) GetEstateStatsByEstateId(ctx context.Context, input *GetEstateStatsByEstateIdInput) (output *GetEstateStatsByEstateIdOutput, err error) {
+	r.mu.RLock()
+	heights := r.treeHeights(input.EstateId, input.AsOf)
+	r.mu.RUnlock()
+	return newEstateStatsOutput(heights, input), nil
+}
+
+// GetEstateStatsSeriesByEstateId buckets the trees of an estate by the period they were planted in, see
+// Repository.GetEstateStatsSeriesByEstateId. The periods are computed in UTC.
+func (r *MemoryRepository) GetEstateStatsSeriesByEstateId(ctx context.Context, input *GetEstateStatsSeriesByEstateIdInput) (output *GetEstateStatsSeriesByEstateIdOutput, err error) {
+	var trees []datedHeight
+	r.mu.RLock()
+	if estate, ok := r.estates[input.EstateId]; ok {
+		for _, tree := range estate.trees {
+			if !tree.createdAt.After(input.AsOf) {
+				trees = append(trees, datedHeight{createdAt: tree.createdAt, height: tree.height})
+			}
+		}
+	}
+	r.mu.RUnlock()
+	sort.SliceStable(trees, func(i, j int) bool { return trees[i].createdAt.Before(trees[j].createdAt) })
+	return newEstateStatsSeries(trees, input)
+}
+
+// GetPortfolioStats computes the statistics of all the trees of the estates matching the filter, and ranks
+// these estates by median height or by density, see Repository.GetPortfolioStats.
+func (r *MemoryRepository) GetPortfolioStats(ctx context.Context, input *GetPortfolioStatsInput) (output *GetPortfolioStatsOutput, err error) {
+	filter := input.Filter
+	var estates []portfolioEstate
+	r.mu.RLock()
+	for _, estate := range r.estates {
+		switch {
+		case filter.MinLength != nil && estate.length < *filter.MinLength,
+			filter.MaxLength != nil && estate.length > *filter.MaxLength,
+			filter.MinWidth != nil && estate.width < *filter.MinWidth,
+			filter.MaxWidth != nil && estate.width > *filter.MaxWidth,
+			filter.CreatedAfter != nil && estate.createdAt.Before(*filter.CreatedAfter),
+			filter.CreatedBefore != nil && !estate.createdAt.Before(*filter.CreatedBefore):
+			continue
+		}
+		estates = append(estates, portfolioEstate{id: estate.id, length: estate.length, width: estate.width, heights: r.treeHeights(estate.id, nil)})
+	}
+	r.mu.RUnlock()
+	return newPortfolioStatsOutput(estates, input), nil
+}
+
+// GetEstateGroupedStatsByEstateId partitions an estate into blocks of BlockLength x BlockWidth plots, see
+// Repository.GetEstateGroupedStatsByEstateId. If the estate does not exist, no group is returned.
+func (r *MemoryRepository) GetEstateGroupedStatsByEstateId(ctx context.Context, input *GetEstateGroupedStatsByEstateIdInput) (output *GetEstateGroupedStatsByEstateIdOutput, err error) {
+	r.mu.RLock()
+	estate, ok := r.estates[input.EstateId]
+	var length, width int
+	var trees []Tree
+	if ok {
+		length, width = estate.length, estate.width
+		for _, tree := range estate.trees {
+			trees = append(trees, Tree{X: tree.x, Y: tree.y, Height: tree.height})
+		}
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return &GetEstateGroupedStatsByEstateIdOutput{}, nil
+	}
+	return newEstateGroupedStats(length, width, trees, input)
+}
+
+// GetEstateTreesByEstateId retrieves the trees of an estate, in the order they were created, together with the estate.
+// If no estate is found, both the output and the error are nil.
+func (r *MemoryRepository) GetEstateTreesByEstateId(ctx context.Context, input *GetEstateTreesByEstateIdInput) (output *GetEstateTreesByEstateIdOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	estate, ok := r.estates[input.EstateId]
+	if !ok {
+		return nil, nil
+	}
+	output = &GetEstateTreesByEstateIdOutput{Estate: estate.snapshot()}
+	for _, tree := range estate.trees {
+		output.Trees = append(output.Trees, Tree{X: tree.x, Y: tree.y, Height: tree.height})
+	}
+	return output, nil
+}
+
+// GetDronePlan retrieves the drone plan stored for an estate and a set of planner parameters.
+// If no plan is stored for the given revision of the estate, both the output and the error are nil.
+func (r *MemoryRepository) GetDronePlan(ctx context.Context, input *GetDronePlanInput) (output *GetDronePlanOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.dronePlans[input.EstateId][input.ParamsKey]
+	if !ok || stored.revision != input.Revision {
+		return nil, nil
+	}
+	return &GetDronePlanOutput{Plan: stored.plan}, nil
+}
+
+// SaveDronePlan stores the drone plan of an estate for a set of planner parameters, replacing the plan
+// of an earlier revision. A plan of a later revision is never replaced. The plans stored per estate are
+// bounded, see MaxDronePlansPerEstate.
+func (r *MemoryRepository) SaveDronePlan(ctx context.Context, input *SaveDronePlanInput) (output *SaveDronePlanOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.estates[input.EstateId]; !ok {
+		return nil, fmt.Errorf("err estate %s of the drone plan does not exist", input.EstateId)
+	}
+	plans := r.dronePlans[input.EstateId]
+	if plans == nil {
+		plans = map[string]*memoryDronePlan{}
+		r.dronePlans[input.EstateId] = plans
+	}
+	if stored, ok := plans[input.ParamsKey]; ok && stored.revision >= input.Revision {
+		return &SaveDronePlanOutput{Saved: false}, nil
+	}
+	r.dronePlanSequence++
+	plans[input.ParamsKey] = &memoryDronePlan{revision: input.Revision, plan: input.Plan, sequence: r.dronePlanSequence}
+
+	// Remove the plans of the earlier revisions, then the least recently saved plans above the bound.
+	for paramsKey, stored := range plans {
+		if stored.revision < input.Revision {
+			delete(plans, paramsKey)
+		}
+	}
+	for len(plans) > MaxDronePlansPerEstate {
+		var oldestKey string
+		for paramsKey, stored := range plans {
+			if oldestKey == "" || stored.sequence < plans[oldestKey].sequence {
+				oldestKey = paramsKey
+			}
+		}
+		delete(plans, oldestKey)
+	}
+	return &SaveDronePlanOutput{Saved: true}, nil
+}
+
+// copyJob returns a copy of job which does not share its error samples. Like the other backends, the copy only
+// holds the payload when withPayload is set.
+func copyJob(job Job, withPayload bool) Job {
+	if withPayload {
+		job.Payload = append([]byte{}, job.Payload...)
+	} else {
+		job.Payload = nil
+	}
+	job.ErrorSamples = append([]JobError{}, job.ErrorSamples...)
+	return job
+}
+
+// CreateJob stores a new job in the queued state, together with the payload it has to process.
+func (r *MemoryRepository) CreateJob(ctx context.Context, input *CreateJobInput) (output *CreateJobOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.estates[input.EstateId]; !ok {
+		return nil, fmt.Errorf("err estate %s of the job does not exist", input.EstateId)
+	}
+	if _, ok := r.jobs[input.Id]; ok {
+		return nil, fmt.Errorf("err job %s already exists", input.Id)
+	}
+
+	now := r.now()
+	r.jobSequence++
+	stored := &memoryJob{
+		job: copyJob(Job{
+			Id:          input.Id,
+			Kind:        input.Kind,
+			State:       JobStateQueued,
+			EstateId:    input.EstateId,
+			ContentType: input.ContentType,
+			Payload:     input.Payload,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}, true),
+		sequence: r.jobSequence,
+	}
+	r.jobs[input.Id] = stored
+	return &CreateJobOutput{Job: copyJob(stored.job, false)}, nil
+}
+
+// GetJobByJobId retrieves a job by its ID. If no job is found, both the output and the error are nil.
+func (r *MemoryRepository) GetJobByJobId(ctx context.Context, input *GetJobByJobIdInput) (output *GetJobByJobIdOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.jobs[input.Id]
+	if !ok {
+		return nil, nil
+	}
+	return &GetJobByJobIdOutput{Job: copyJob(stored.job, false)}, nil
+}
+
+// ClaimNextJob moves the oldest queued job of the given kind to the running state and returns it.
+// If there is nothing to claim, both the output and the error are nil.
+func (r *MemoryRepository) ClaimNextJob(ctx context.Context, input *ClaimNextJobInput) (output *ClaimNextJobOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var next *memoryJob
+	for _, stored := range r.jobs {
+		if stored.job.Kind != input.Kind || stored.job.State != JobStateQueued {
+			continue
+		}
+		if next == nil || stored.job.CreatedAt.Before(next.job.CreatedAt) ||
+			(stored.job.CreatedAt.Equal(next.job.CreatedAt) && stored.sequence < next.sequence) {
+			next = stored
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.job.State = JobStateRunning
+	next.job.UpdatedAt = r.now()
+	return &ClaimNextJobOutput{Job: copyJob(next.job, true)}, nil
+}
+
+// UpdateJobProgress checkpoints the state and the counters of a job, and reports whether a cancellation
+// has been requested in the meantime. Like Repository, it returns sql.ErrNoRows when the job does not exist.
+func (r *MemoryRepository) UpdateJobProgress(ctx context.Context, input *UpdateJobProgressInput) (output *UpdateJobProgressOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.jobs[input.Id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	stored.job.State = input.State
+	stored.job.TotalRows, stored.job.ProcessedRows = input.TotalRows, input.ProcessedRows
+	stored.job.SucceededRows, stored.job.FailedRows = input.SucceededRows, input.FailedRows
+	stored.job.ErrorSamples = append([]JobError{}, input.ErrorSamples...)
+	stored.job.UpdatedAt = r.now()
+	return &UpdateJobProgressOutput{CancelRequested: stored.job.CancelRequested}, nil
+}
+
+// RequestJobCancellation flags a job for cancellation.
+// A queued job is cancelled right away, while a running job is cancelled by its worker.
+// Finished jobs are left untouched. If no job is found, both the output and the error are nil.
+func (r *MemoryRepository) RequestJobCancellation(ctx context.Context, input *RequestJobCancellationInput) (output *RequestJobCancellationOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.jobs[input.Id]
+	if !ok {
+		return nil, nil
+	}
+	stored.job.CancelRequested = stored.job.State == JobStateQueued || stored.job.State == JobStateRunning
+	if stored.job.State == JobStateQueued {
+		stored.job.State = JobStateCancelled
+	}
+	stored.job.UpdatedAt = r.now()
+	return &RequestJobCancellationOutput{Job: copyJob(stored.job, false)}, nil
+}
+
+// RequeueStaleJobs moves running jobs that have not been checkpointed since StaleBefore back to the queue.
+func (r *MemoryRepository) RequeueStaleJobs(ctx context.Context, input *RequeueStaleJobsInput) (output *RequeueStaleJobsOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output = &RequeueStaleJobsOutput{}
+	for _, stored := range r.jobs {
+		if stored.job.State == JobStateRunning && stored.job.UpdatedAt.Before(input.StaleBefore) {
+			stored.job.State = JobStateQueued
+			stored.job.UpdatedAt = r.now()
+			output.Count++
+		}
+	}
+	return output, nil
+}
+
+// ExportEstateTrees reads the trees of one estate, or of all estates, joined with their estate, in the order
+// of Repository.ExportEstateTrees. The rows are copied before they are handed to input.OnRow, so that a slow
+// reader does not block the writers.
+func (r *MemoryRepository) ExportEstateTrees(ctx context.Context, input *ExportEstateTreesInput) (output *ExportEstateTreesOutput, err error) {
+	var rows []ExportRow
+	r.mu.RLock()
+	estates := make([]*memoryEstate, 0, len(r.estates))
+	for _, estate := range r.estates {
+		if input.EstateId == "" || estate.id == input.EstateId {
+			estates = append(estates, estate)
+		}
+	}
+	sort.Slice(estates, func(i, j int) bool {
+		if !estates[i].createdAt.Equal(estates[j].createdAt) {
+			return estates[i].createdAt.Before(estates[j].createdAt)
+		}
+		return estates[i].id < estates[j].id
+	})
+	for _, estate := range estates {
+		if len(estate.trees) == 0 {
+			rows = append(rows, ExportRow{EstateId: estate.id, Length: estate.length, Width: estate.width})
+			continue
+		}
+		trees := append([]*memoryTree{}, estate.trees...)
+		sort.SliceStable(trees, func(i, j int) bool {
+			if trees[i].y != trees[j].y {
+				return trees[i].y < trees[j].y
+			}
+			return trees[i].x < trees[j].x
+		})
+		for _, tree := range trees {
+			rows = append(rows, ExportRow{
+				EstateId: estate.id, Length: estate.length, Width: estate.width,
+				TreeId: tree.id, X: tree.x, Y: tree.y, Height: tree.height, TreeCreatedAt: tree.createdAt,
+			})
+		}
+	}
+	r.mu.RUnlock()
+
+	output = &ExportEstateTreesOutput{}
+	for i := range rows {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err = input.OnRow(&rows[i]); err != nil {
+			return nil, err
+		}
+		output.Count++
+	}
+	return output, nil
+}
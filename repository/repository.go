@@ -2,18 +2,55 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/config"
 	_ "github.com/lib/pq"
 )
 
+// Backends of RepositoryInterface, selected by the configuration.
+const (
+	// BackendPostgres stores the data in PostgreSQL, see Repository.
+	BackendPostgres = "postgres"
+	// BackendMemory keeps the data in the memory of the process, see MemoryRepository.
+	BackendMemory = "memory"
+	// BackendSQLite stores the data in an SQLite database file, see SQLiteRepository.
+	BackendSQLite = "sqlite"
+)
+
+// Pinger is implemented by the repositories which depend on a database, to tell whether it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 type Repository struct {
 	Db *sql.DB
 }
 
 type NewRepositoryOptions struct {
 	Dsn string
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime size the pool of connections, the defaults of database/sql
+	// apply when they are 0.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// configurePool applies the pool settings of opts to db.
+func configurePool(db *sql.DB, opts NewRepositoryOptions) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
 }
 
 // NewRepository creates a new Repository instance with the provided options.
@@ -25,23 +62,63 @@ type NewRepositoryOptions struct {
 func NewRepository(opts NewRepositoryOptions) *Repository {
 	db, err := sql.Open("postgres", opts.Dsn)
 	if err != nil {
-		log.Printf("error init postgres %s", err.Error())
+		slog.Error("error init postgres", "error", err)
 		panic(err)
 	} else {
-		log.Printf("successfully init postgres")
+		slog.Info("successfully init postgres")
 	}
 
 	if err = db.Ping(); err != nil {
-		log.Printf("error ping postgres %s", err.Error())
+		slog.Error("error ping postgres", "error", err)
 		panic(err)
 	} else {
-		log.Printf("successfully ping postgres")
+		slog.Info("successfully ping postgres")
 	}
 
 	if db != nil {
-		log.Printf("successfully connect to postgres")
+		slog.Info("successfully connect to postgres")
 	}
+	configurePool(db, opts)
 	return &Repository{
 		Db: db,
 	}
 }
+
+// Backoff of the retries of Connect.
+const (
+	minConnectDelay = 100 * time.Millisecond
+	maxConnectDelay = 5 * time.Second
+)
+
+// Connect is NewRepository for the services which start alongside their database: instead of panicking, it
+// retries the connection with an exponential backoff until the database answers, and returns an error when
+// ctx is done first.
+func Connect(ctx context.Context, opts NewRepositoryOptions) (*Repository, error) {
+	slog.InfoContext(ctx, "connecting to postgres", "dsn", config.RedactDSN(opts.Dsn))
+	db, err := sql.Open("postgres", opts.Dsn)
+	if err != nil {
+		return nil, fmt.Errorf("err init postgres: %w", err)
+	}
+	configurePool(db, opts)
+
+	delay := minConnectDelay
+	for attempt := 1; ; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			slog.InfoContext(ctx, "successfully connect to postgres", "attempts", attempt)
+			return &Repository{Db: db}, nil
+		}
+		slog.WarnContext(ctx, "error ping postgres, retrying", "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("err connecting to postgres after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxConnectDelay)
+	}
+}
+
+// Ping tells whether the database is reachable.
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.Db.PingContext(ctx)
+}
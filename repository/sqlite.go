@@ -0,0 +1,750 @@
+// This file contains the SQLite implementation of the repository layer.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite backend when they do not exist.
+//
+//go:embed sqlite.sql
+var sqliteSchema string
+
+// SQLiteRepository implements RepositoryInterface on an SQLite database, for the single node deployments
+// without PostgreSQL. It follows the semantics of Repository, the statistics which PostgreSQL computes
+// with PERCENTILE_CONT are computed in Go from the heights read from the database.
+// Its statements have no trailing semicolon, as the driver rejects the whitespace which would follow it.
+type SQLiteRepository struct {
+	Db *sql.DB
+}
+
+type NewSQLiteRepositoryOptions struct {
+	// Path is the file of the database, which is created when it does not exist, or :memory: for a
+	// database which is lost when the process stops.
+	Path string
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository instance with the provided options.
+// It opens the database with the foreign keys enforced, and creates the schema when needed.
+// Writes take the lock of the database when their transaction begins, so that concurrent writers wait
+// for each other instead of failing, while the write-ahead log lets the readers run alongside them.
+func NewSQLiteRepository(opts NewSQLiteRepositoryOptions) (*SQLiteRepository, error) {
+	db, err := sql.Open("sqlite", opts.Path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("err init sqlite: %w", err)
+	}
+	if opts.Path == ":memory:" {
+		// Every connection to :memory: opens a distinct database.
+		db.SetMaxOpenConns(1)
+	}
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("err creating the sqlite schema of %s: %w", opts.Path, err)
+	}
+	slog.Info("successfully init sqlite", "path", opts.Path)
+	return &SQLiteRepository{
+		Db: db,
+	}, nil
+}
+
+// Ping tells whether the database is reachable.
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	return r.Db.PingContext(ctx)
+}
+
+// sqliteNow returns the current time as stored in the database, see sqlite.sql.
+func sqliteNow() int64 {
+	return time.Now().UnixMicro()
+}
+
+// sqliteTimeArg returns t as stored in the database, or nil when t is not set.
+func sqliteTimeArg(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+// CreateEstate creates a new estate. Creating an estate with the length and the width of an existing estate
+// refreshes the creation time and the revision of the existing estate, and returns its ID.
+func (r *SQLiteRepository) CreateEstate(ctx context.Context, input *CreateEstateInput) (output *CreateEstateOutput, err error) {
+	sqlStatement := `
+		INSERT INTO estates (
+			id
+			,length
+			,width
+			,created_at
+		)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (length, width)
+		DO UPDATE SET
+			created_at = excluded.created_at
+			,revision = estates.revision + 1
+		RETURNING id
+   `
+	output = &CreateEstateOutput{}
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.Length, input.Width, sqliteNow()).Scan(&output.Id)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to create estate", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// sqliteEstateColumns selects the estate, with the time of the newest change of the estate or of its trees.
+const sqliteEstateColumns = `
+			estates.length
+			,estates.width
+			,estates.revision
+			,MAX(estates.created_at, COALESCE((
+				SELECT MAX(trees.created_at)
+				FROM trees
+				WHERE trees.estate_id = estates.id
+			), 0)) AS last_modified`
+
+func scanSQLiteEstate(row *sql.Row) (*Estate, error) {
+	var estate Estate
+	var lastModified int64
+	if err := row.Scan(&estate.Length, &estate.Width, &estate.Revision, &lastModified); err != nil {
+		return nil, err
+	}
+	estate.LastModified = time.UnixMicro(lastModified)
+	return &estate, nil
+}
+
+// GetEstateByEstateId retrieves an estate by its ID. If no estate is found, both the output and the error are nil.
+func (r *SQLiteRepository) GetEstateByEstateId(ctx context.Context, input *GetEstateByEstateIdInput) (output *GetEstateByEstateIdOutput, err error) {
+	sqlStatement := `
+		SELECT` + sqliteEstateColumns + `
+		FROM
+			estates
+		WHERE estates.id = ?
+   `
+	estate, err := scanSQLiteEstate(r.Db.QueryRowContext(ctx, sqlStatement, input.Id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to select the length and the width of the estate", "error", err)
+		return nil, err
+	}
+	return &GetEstateByEstateIdOutput{Estate: *estate}, nil
+}
+
+// IsTreeExist checks if a tree is planted at the given plot of an estate.
+func (r *SQLiteRepository) IsTreeExist(ctx context.Context, input *IsTreeExistInput) (output *IsTreeExistOutput, err error) {
+	sqlStatement := `
+		SELECT EXISTS(
+			SELECT 1
+			FROM
+				trees
+			WHERE trees.estate_id = ? AND trees.x = ? AND trees.y = ?
+		)
+   `
+	output = &IsTreeExistOutput{}
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId, input.X, input.Y).Scan(&output.IsExist)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to check whether a certain tree exist or not", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// GetTreeByTreeId retrieves a tree of an estate. It returns nil when the tree does not exist or belongs to another estate.
+func (r *SQLiteRepository) GetTreeByTreeId(ctx context.Context, input *GetTreeByTreeIdInput) (output *GetTreeByTreeIdOutput, err error) {
+	sqlStatement := `
+		SELECT
+			trees.x
+			,trees.y
+			,trees.height
+		FROM
+			trees
+		WHERE trees.id = ? AND trees.estate_id = ?
+   `
+	output = &GetTreeByTreeIdOutput{}
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.EstateId).Scan(&output.Tree.X, &output.Tree.Y, &output.Tree.Height)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to select the tree", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// CreateTree creates a new tree and bumps the revision of its estate in the same transaction.
+func (r *SQLiteRepository) CreateTree(ctx context.Context, input *CreateTreeInput) (output *CreateTreeOutput, err error) {
+	sqlStatement := `
+		INSERT INTO trees (
+			id
+			,estate_id
+			,x
+			,y
+			,height
+			,created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+   `
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "err starting transaction to create tree", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+	output = &CreateTreeOutput{}
+	err = tx.QueryRowContext(ctx, sqlStatement, input.Id, input.EstateId, input.X, input.Y, input.Height, sqliteNow()).Scan(&output.Id)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to create tree", "error", err)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE estates SET revision = estates.revision + 1 WHERE estates.id = ?`, input.EstateId)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to bump the estate revision", "error", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "err committing transaction to create tree", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// queryHeights reads the heights selected by sqlStatement.
+func (r *SQLiteRepository) queryHeights(ctx context.Context, sqlStatement string, args ...any) ([]int, error) {
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the tree heights", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heights []int
+	for rows.Next() {
+		var height int
+		if err = rows.Scan(&height); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+	return heights, rows.Err()
+}
+
+// GetEstateStatsByEstateId computes the statistics of the trees of an estate, see Repository.GetEstateStatsByEstateId.
+func (r *SQLiteRepository) GetEstateStatsByEstateId(ctx context.Context, input *GetEstateStatsByEstateIdInput) (output *GetEstateStatsByEstateIdOutput, err error) {
+	sqlStatement := `
+		SELECT
+			trees.height
+		FROM
+			trees
+		WHERE trees.estate_id = ? AND (?2 IS NULL OR trees.created_at <= ?2)
+   `
+	heights, err := r.queryHeights(ctx, sqlStatement, input.EstateId, sqliteTimeArg(input.AsOf))
+	if err != nil {
+		return nil, err
+	}
+	return newEstateStatsOutput(heights, input), nil
+}
+
+// GetEstateStatsSeriesByEstateId buckets the trees of an estate by the period they were planted in, see
+// Repository.GetEstateStatsSeriesByEstateId. The periods are computed in UTC.
+func (r *SQLiteRepository) GetEstateStatsSeriesByEstateId(ctx context.Context, input *GetEstateStatsSeriesByEstateIdInput) (output *GetEstateStatsSeriesByEstateIdOutput, err error) {
+	sqlStatement := `
+		SELECT
+			trees.created_at
+			,trees.height
+		FROM
+			trees
+		WHERE trees.estate_id = ? AND trees.created_at <= ?
+		ORDER BY trees.created_at
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId, input.AsOf.UnixMicro())
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get estate stats series by estate id", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trees []datedHeight
+	for rows.Next() {
+		var createdAt int64
+		var tree datedHeight
+		if err = rows.Scan(&createdAt, &tree.height); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		tree.createdAt = time.UnixMicro(createdAt)
+		trees = append(trees, tree)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return newEstateStatsSeries(trees, input)
+}
+
+// GetPortfolioStats computes the statistics of all the trees of the estates matching the filter, and ranks
+// these estates by median height or by density, see Repository.GetPortfolioStats.
+func (r *SQLiteRepository) GetPortfolioStats(ctx context.Context, input *GetPortfolioStatsInput) (output *GetPortfolioStatsOutput, err error) {
+	sqlStatement := `
+		SELECT
+			estates.id
+			,estates.length
+			,estates.width
+			,trees.height
+		FROM
+			estates
+			LEFT JOIN trees ON trees.estate_id = estates.id
+		WHERE (?1 IS NULL OR estates.length >= ?1)
+			AND (?2 IS NULL OR estates.length <= ?2)
+			AND (?3 IS NULL OR estates.width >= ?3)
+			AND (?4 IS NULL OR estates.width <= ?4)
+			AND (?5 IS NULL OR estates.created_at >= ?5)
+			AND (?6 IS NULL OR estates.created_at < ?6)
+		ORDER BY estates.id
+   `
+	filter := input.Filter
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, filter.MinLength, filter.MaxLength, filter.MinWidth, filter.MaxWidth,
+		sqliteTimeArg(filter.CreatedAfter), sqliteTimeArg(filter.CreatedBefore))
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get portfolio stats", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var estates []portfolioEstate
+	for rows.Next() {
+		var estate portfolioEstate
+		var height sql.NullInt64
+		if err = rows.Scan(&estate.id, &estate.length, &estate.width, &height); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		if len(estates) == 0 || estates[len(estates)-1].id != estate.id {
+			estates = append(estates, estate)
+		}
+		if height.Valid {
+			last := &estates[len(estates)-1]
+			last.heights = append(last.heights, int(height.Int64))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return newPortfolioStatsOutput(estates, input), nil
+}
+
+// GetEstateGroupedStatsByEstateId partitions an estate into blocks of BlockLength x BlockWidth plots, see
+// Repository.GetEstateGroupedStatsByEstateId. If the estate does not exist, no group is returned.
+func (r *SQLiteRepository) GetEstateGroupedStatsByEstateId(ctx context.Context, input *GetEstateGroupedStatsByEstateIdInput) (output *GetEstateGroupedStatsByEstateIdOutput, err error) {
+	trees, err := r.GetEstateTreesByEstateId(ctx, &GetEstateTreesByEstateIdInput{EstateId: input.EstateId})
+	if err != nil {
+		return nil, err
+	}
+	if trees == nil {
+		return &GetEstateGroupedStatsByEstateIdOutput{}, nil
+	}
+	return newEstateGroupedStats(trees.Estate.Length, trees.Estate.Width, trees.Trees, input)
+}
+
+// GetEstateTreesByEstateId retrieves the trees of an estate, together with the estate.
+// If no estate is found, both the output and the error are nil.
+func (r *SQLiteRepository) GetEstateTreesByEstateId(ctx context.Context, input *GetEstateTreesByEstateIdInput) (output *GetEstateTreesByEstateIdOutput, err error) {
+	sqlStatement := `
+		SELECT` + sqliteEstateColumns + `
+		FROM
+			estates
+		WHERE estates.id = ?
+   `
+	estate, err := scanSQLiteEstate(r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the estate length and the estate width", "error", err)
+		return nil, err
+	}
+
+	sqlStatement = `
+		SELECT
+			trees.x
+			,trees.y
+			,trees.height
+		FROM
+			trees
+		WHERE trees.estate_id = ?
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the trees belonging to a certain estate id", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	output = &GetEstateTreesByEstateIdOutput{Estate: *estate}
+	for rows.Next() {
+		var tree Tree
+		if err = rows.Scan(&tree.X, &tree.Y, &tree.Height); err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		output.Trees = append(output.Trees, tree)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// GetDronePlan retrieves the drone plan stored for an estate and a set of planner parameters.
+// If no plan is stored for the given revision of the estate, both the output and the error are nil.
+func (r *SQLiteRepository) GetDronePlan(ctx context.Context, input *GetDronePlanInput) (output *GetDronePlanOutput, err error) {
+	sqlStatement := `
+		SELECT
+			drone_plans.total_distance
+			,drone_plans.total_vertical_distance
+			,drone_plans.total_horizontal_distance
+			,drone_plans.last_x
+			,drone_plans.last_y
+		FROM
+			drone_plans
+		WHERE drone_plans.estate_id = ? AND drone_plans.params_key = ? AND drone_plans.revision = ?
+   `
+	output = &GetDronePlanOutput{}
+	plan := &output.Plan
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision).
+		Scan(&plan.TotalDistance, &plan.TotalVerticalDistance, &plan.TotalHorizontalDistance, &plan.LastAchievableXCoordinate, &plan.LastAchievableYCoordinate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get the drone plan", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// SaveDronePlan stores the drone plan of an estate for a set of planner parameters, replacing the plan
+// of an earlier revision. A plan of a later revision is never replaced. The plans stored per estate are
+// bounded, see MaxDronePlansPerEstate.
+func (r *SQLiteRepository) SaveDronePlan(ctx context.Context, input *SaveDronePlanInput) (output *SaveDronePlanOutput, err error) {
+	sqlStatement := `
+		INSERT INTO drone_plans (
+			estate_id
+			,params_key
+			,revision
+			,total_distance
+			,total_vertical_distance
+			,total_horizontal_distance
+			,last_x
+			,last_y
+			,created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (estate_id, params_key)
+		DO UPDATE SET
+			revision = excluded.revision
+			,total_distance = excluded.total_distance
+			,total_vertical_distance = excluded.total_vertical_distance
+			,total_horizontal_distance = excluded.total_horizontal_distance
+			,last_x = excluded.last_x
+			,last_y = excluded.last_y
+			,created_at = excluded.created_at
+		WHERE drone_plans.revision < excluded.revision
+   `
+	plan := input.Plan
+	result, err := r.Db.ExecContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision,
+		plan.TotalDistance, plan.TotalVerticalDistance, plan.TotalHorizontalDistance, plan.LastAchievableXCoordinate, plan.LastAchievableYCoordinate, sqliteNow())
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to save the drone plan", "error", err)
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "err reading the number of saved drone plans", "error", err)
+		return nil, err
+	}
+	if affected == 0 {
+		return &SaveDronePlanOutput{Saved: false}, nil
+	}
+
+	// Remove the plans of the earlier revisions, which are never read again, and the least recently saved
+	// plans above MaxDronePlansPerEstate, since every max distance requested has its own plan.
+	sqlStatement = `
+		DELETE FROM drone_plans
+		WHERE drone_plans.estate_id = ?1 AND drone_plans.params_key <> ?2 AND (
+			drone_plans.revision < ?3
+			OR drone_plans.params_key NOT IN (
+				SELECT kept.params_key
+				FROM drone_plans AS kept
+				WHERE kept.estate_id = ?1 AND kept.params_key <> ?2
+				ORDER BY kept.created_at DESC, kept.params_key
+				LIMIT ?4
+			)
+		)
+   `
+	_, err = r.Db.ExecContext(ctx, sqlStatement, input.EstateId, input.ParamsKey, input.Revision, MaxDronePlansPerEstate-1)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to remove the outdated drone plans", "error", err)
+		return nil, err
+	}
+	return &SaveDronePlanOutput{Saved: true}, nil
+}
+
+// sqliteJobColumns lists the columns of the jobs table in the order expected by scanSQLiteJob, but the payload, which
+// is only read by ClaimNextJob since it holds up to the whole import file.
+const sqliteJobColumns = `
+			jobs.id
+			,jobs.kind
+			,jobs.state
+			,jobs.estate_id
+			,jobs.content_type
+			,jobs.total_rows
+			,jobs.processed_rows
+			,jobs.succeeded_rows
+			,jobs.failed_rows
+			,jobs.error_samples
+			,jobs.cancel_requested
+			,jobs.created_at
+			,jobs.updated_at`
+
+// scanSQLiteJob reads a single job row selected with sqliteJobColumns, followed by the payload when withPayload is set.
+func scanSQLiteJob(row *sql.Row, withPayload bool) (*Job, error) {
+	var job Job
+	var errorSamples string
+	var createdAt, updatedAt int64
+	dest := []any{&job.Id, &job.Kind, &job.State, &job.EstateId, &job.ContentType,
+		&job.TotalRows, &job.ProcessedRows, &job.SucceededRows, &job.FailedRows,
+		&errorSamples, &job.CancelRequested, &createdAt, &updatedAt}
+	if withPayload {
+		dest = append(dest, &job.Payload)
+	}
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(errorSamples), &job.ErrorSamples); err != nil {
+		return nil, err
+	}
+	job.CreatedAt, job.UpdatedAt = time.UnixMicro(createdAt), time.UnixMicro(updatedAt)
+	return &job, nil
+}
+
+// CreateJob stores a new job in the queued state, together with the payload it has to process.
+func (r *SQLiteRepository) CreateJob(ctx context.Context, input *CreateJobInput) (output *CreateJobOutput, err error) {
+	sqlStatement := `
+		INSERT INTO jobs (
+			id
+			,kind
+			,state
+			,estate_id
+			,content_type
+			,payload
+			,created_at
+			,updated_at
+		)
+		VALUES (?1, ?2, 'queued', ?3, ?4, ?5, ?6, ?6)
+		RETURNING` + sqliteJobColumns + `
+   `
+	payload := input.Payload
+	if payload == nil {
+		// A nil slice is stored as NULL.
+		payload = []byte{}
+	}
+	job, err := scanSQLiteJob(r.Db.QueryRowContext(ctx, sqlStatement, input.Id, input.Kind, input.EstateId, input.ContentType, payload, sqliteNow()), false)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to create job", "error", err)
+		return nil, err
+	}
+	return &CreateJobOutput{Job: *job}, nil
+}
+
+// GetJobByJobId retrieves a job by its ID. If no job is found, both the output and the error are nil.
+func (r *SQLiteRepository) GetJobByJobId(ctx context.Context, input *GetJobByJobIdInput) (output *GetJobByJobIdOutput, err error) {
+	sqlStatement := `
+		SELECT` + sqliteJobColumns + `
+		FROM
+			jobs
+		WHERE jobs.id = ?
+   `
+	job, err := scanSQLiteJob(r.Db.QueryRowContext(ctx, sqlStatement, input.Id), false)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to get job by job id", "error", err)
+		return nil, err
+	}
+	return &GetJobByJobIdOutput{Job: *job}, nil
+}
+
+// ClaimNextJob moves the oldest queued job of the given kind to the running state and returns it.
+// The writes to the database are serialized, so no two callers claim the same job.
+// If there is nothing to claim, both the output and the error are nil.
+func (r *SQLiteRepository) ClaimNextJob(ctx context.Context, input *ClaimNextJobInput) (output *ClaimNextJobOutput, err error) {
+	sqlStatement := `
+		UPDATE jobs
+		SET
+			state = 'running'
+			,updated_at = ?
+		WHERE jobs.id = (
+			SELECT queued.id
+			FROM jobs AS queued
+			WHERE queued.kind = ? AND queued.state = 'queued'
+			ORDER BY queued.created_at, queued.rowid
+			LIMIT 1
+		)
+		RETURNING` + sqliteJobColumns + `
+			,jobs.payload
+   `
+	job, err := scanSQLiteJob(r.Db.QueryRowContext(ctx, sqlStatement, sqliteNow(), input.Kind), true)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to claim the next job", "error", err)
+		return nil, err
+	}
+	return &ClaimNextJobOutput{Job: *job}, nil
+}
+
+// UpdateJobProgress checkpoints the state and the counters of a job, and reports whether a cancellation
+// has been requested in the meantime. Like Repository, it returns sql.ErrNoRows when the job does not exist.
+func (r *SQLiteRepository) UpdateJobProgress(ctx context.Context, input *UpdateJobProgressInput) (output *UpdateJobProgressOutput, err error) {
+	sqlStatement := `
+		UPDATE jobs
+		SET
+			state = ?
+			,total_rows = ?
+			,processed_rows = ?
+			,succeeded_rows = ?
+			,failed_rows = ?
+			,error_samples = ?
+			,updated_at = ?
+		WHERE jobs.id = ?
+		RETURNING jobs.cancel_requested
+   `
+	errorSamples := input.ErrorSamples
+	if errorSamples == nil {
+		errorSamples = []JobError{}
+	}
+	errorSamplesJson, err := json.Marshal(errorSamples)
+	if err != nil {
+		return nil, err
+	}
+	output = &UpdateJobProgressOutput{}
+	err = r.Db.QueryRowContext(ctx, sqlStatement, input.State, input.TotalRows, input.ProcessedRows,
+		input.SucceededRows, input.FailedRows, string(errorSamplesJson), sqliteNow(), input.Id).Scan(&output.CancelRequested)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to update job progress", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
+
+// RequestJobCancellation flags a job for cancellation.
+// A queued job is cancelled right away, while a running job is cancelled by its worker.
+// Finished jobs are left untouched. If no job is found, both the output and the error are nil.
+func (r *SQLiteRepository) RequestJobCancellation(ctx context.Context, input *RequestJobCancellationInput) (output *RequestJobCancellationOutput, err error) {
+	sqlStatement := `
+		UPDATE jobs
+		SET
+			cancel_requested = jobs.state IN ('queued', 'running')
+			,state = CASE WHEN jobs.state = 'queued' THEN 'cancelled' ELSE jobs.state END
+			,updated_at = ?
+		WHERE jobs.id = ?
+		RETURNING` + sqliteJobColumns + `
+   `
+	job, err := scanSQLiteJob(r.Db.QueryRowContext(ctx, sqlStatement, sqliteNow(), input.Id), false)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "err executing query to request job cancellation", "error", err)
+		return nil, err
+	}
+	return &RequestJobCancellationOutput{Job: *job}, nil
+}
+
+// RequeueStaleJobs moves running jobs that have not been checkpointed since StaleBefore back to the queue.
+func (r *SQLiteRepository) RequeueStaleJobs(ctx context.Context, input *RequeueStaleJobsInput) (output *RequeueStaleJobsOutput, err error) {
+	sqlStatement := `
+		UPDATE jobs
+		SET
+			state = 'queued'
+			,updated_at = ?
+		WHERE jobs.state = 'running' AND jobs.updated_at < ?
+   `
+	result, err := r.Db.ExecContext(ctx, sqlStatement, sqliteNow(), input.StaleBefore.UnixMicro())
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to requeue stale jobs", "error", err)
+		return nil, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	return &RequeueStaleJobsOutput{Count: int(count)}, nil
+}
+
+// ExportEstateTrees reads the trees of one estate, or of all estates, joined with their estate, in the order
+// of Repository.ExportEstateTrees. Rows are handed to input.OnRow while the cursor is read.
+func (r *SQLiteRepository) ExportEstateTrees(ctx context.Context, input *ExportEstateTreesInput) (output *ExportEstateTreesOutput, err error) {
+	sqlStatement := `
+		SELECT
+			estates.id
+			,estates.length
+			,estates.width
+			,trees.id
+			,trees.x
+			,trees.y
+			,trees.height
+			,trees.created_at
+		FROM
+			estates
+			LEFT JOIN trees ON trees.estate_id = estates.id
+		WHERE ?1 = '' OR estates.id = ?1
+		ORDER BY estates.created_at, estates.id, trees.y, trees.x
+   `
+	rows, err := r.Db.QueryContext(ctx, sqlStatement, input.EstateId)
+	if err != nil {
+		slog.ErrorContext(ctx, "err executing query to export estate trees", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	output = &ExportEstateTreesOutput{}
+	for rows.Next() {
+		var row ExportRow
+		var treeId sql.NullString
+		var x, y, height, treeCreatedAt sql.NullInt64
+		err = rows.Scan(&row.EstateId, &row.Length, &row.Width, &treeId, &x, &y, &height, &treeCreatedAt)
+		if err != nil {
+			slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+			return nil, err
+		}
+		row.TreeId = treeId.String
+		row.X, row.Y, row.Height = int(x.Int64), int(y.Int64), int(height.Int64)
+		if treeCreatedAt.Valid {
+			row.TreeCreatedAt = time.UnixMicro(treeCreatedAt.Int64)
+		}
+
+		if err = input.OnRow(&row); err != nil {
+			return nil, err
+		}
+		output.Count++
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "err when reading the rows as result from the query", "error", err)
+		return nil, err
+	}
+	return output, nil
+}
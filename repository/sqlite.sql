@@ -0,0 +1,65 @@
+-- This is the SQL script that initializes the schema of the SQLite backend, see the migration package for PostgreSQL.
+-- SQLite has no UUID, TIMESTAMPTZ nor JSONB types, so the IDs are stored as TEXT, the times as INTEGER
+-- microseconds since the Unix epoch, which compare and sort like the times, and the JSON as TEXT.
+
+CREATE TABLE IF NOT EXISTS estates (
+	id TEXT NOT NULL,
+	length INTEGER NOT NULL CHECK (length BETWEEN 1 AND 50000),
+	width INTEGER NOT NULL CHECK (width BETWEEN 1 AND 50000),
+	created_at INTEGER NOT NULL,
+	revision INTEGER NOT NULL DEFAULT 0,
+
+	CONSTRAINT estate_pk PRIMARY KEY (id),
+	CONSTRAINT estates_unique_keys UNIQUE (length, width)
+);
+
+CREATE TABLE IF NOT EXISTS trees (
+	id TEXT NOT NULL,
+	estate_id TEXT NOT NULL,
+	x INTEGER NOT NULL,
+	y INTEGER NOT NULL,
+	height INTEGER NOT NULL CHECK (height BETWEEN 1 AND 30),
+	created_at INTEGER NOT NULL,
+
+	CONSTRAINT tree_pk PRIMARY KEY (id),
+	CONSTRAINT trees_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES estates(id)
+);
+
+CREATE INDEX IF NOT EXISTS trees_estate_id_y_x_idx ON trees (estate_id, y, x);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT NOT NULL,
+	kind TEXT NOT NULL CHECK (length(kind) <= 32),
+	state TEXT NOT NULL CHECK (state IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+	estate_id TEXT NOT NULL,
+	content_type TEXT NOT NULL CHECK (length(content_type) <= 64),
+	payload BLOB NOT NULL,
+	total_rows INTEGER NOT NULL DEFAULT 0,
+	processed_rows INTEGER NOT NULL DEFAULT 0,
+	succeeded_rows INTEGER NOT NULL DEFAULT 0,
+	failed_rows INTEGER NOT NULL DEFAULT 0,
+	error_samples TEXT NOT NULL DEFAULT '[]',
+	cancel_requested INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+
+	CONSTRAINT job_pk PRIMARY KEY (id),
+	CONSTRAINT jobs_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES estates(id)
+);
+
+CREATE INDEX IF NOT EXISTS jobs_state_created_at_idx ON jobs (state, created_at);
+
+CREATE TABLE IF NOT EXISTS drone_plans (
+	estate_id TEXT NOT NULL,
+	params_key TEXT NOT NULL CHECK (length(params_key) <= 64),
+	revision INTEGER NOT NULL,
+	total_distance INTEGER NOT NULL,
+	total_vertical_distance INTEGER NOT NULL,
+	total_horizontal_distance INTEGER NOT NULL,
+	last_x INTEGER NOT NULL,
+	last_y INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+
+	CONSTRAINT drone_plan_pk PRIMARY KEY (estate_id, params_key),
+	CONSTRAINT drone_plans_estate_id_fk_estates_estate_id FOREIGN KEY(estate_id) REFERENCES estates(id)
+);
@@ -0,0 +1,265 @@
+// This file contains the statistics computed in Go by the backends without PERCENTILE_CONT.
+package repository
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// heightStats holds the aggregates computed by the queries of Repository over a set of tree heights.
+type heightStats struct {
+	count, max, min int
+	mean, stdDev    float64
+	// sorted holds the heights in ascending order.
+	sorted []int
+}
+
+func newHeightStats(heights []int) heightStats {
+	stats := heightStats{count: len(heights), sorted: append([]int{}, heights...)}
+	if stats.count == 0 {
+		return stats
+	}
+	sort.Ints(stats.sorted)
+	stats.min, stats.max = stats.sorted[0], stats.sorted[stats.count-1]
+
+	sum := 0
+	for _, height := range heights {
+		sum += height
+	}
+	stats.mean = float64(sum) / float64(stats.count)
+	var squares float64
+	for _, height := range heights {
+		squares += (float64(height) - stats.mean) * (float64(height) - stats.mean)
+	}
+	stats.stdDev = math.Sqrt(squares / float64(stats.count))
+	return stats
+}
+
+// percentile interpolates between the two closest heights like PERCENTILE_CONT, fraction is between 0 and 1.
+// It returns 0 without heights.
+func (s heightStats) percentile(fraction float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	position := fraction * float64(s.count-1)
+	lower := int(math.Floor(position))
+	if lower >= s.count-1 {
+		return float64(s.sorted[s.count-1])
+	}
+	return float64(s.sorted[lower]) + (position-float64(lower))*float64(s.sorted[lower+1]-s.sorted[lower])
+}
+
+// newEstateStatsOutput computes the statistics of Repository.GetEstateStatsByEstateId from the heights of the
+// trees of the estate planted at or before input.AsOf.
+func newEstateStatsOutput(heights []int, input *GetEstateStatsByEstateIdInput) *GetEstateStatsByEstateIdOutput {
+	stats := newHeightStats(heights)
+	output := &GetEstateStatsByEstateIdOutput{
+		Count:  stats.count,
+		Max:    stats.max,
+		Min:    stats.min,
+		Median: float32(stats.percentile(0.5)),
+	}
+	if input.IncludeDistribution {
+		output.Mean, output.StdDev = stats.mean, stats.stdDev
+		output.Percentiles = make([]float64, len(input.Percentiles))
+		for i, percentile := range input.Percentiles {
+			output.Percentiles[i] = stats.percentile(percentile)
+		}
+	}
+	if input.HistogramBuckets > 0 {
+		output.Histogram = NewHistogramBuckets(input.HistogramBuckets)
+		heightCount := MaxTreeHeight - MinTreeHeight + 1
+		for _, height := range heights {
+			bucket := ((height - MinTreeHeight) * input.HistogramBuckets) / heightCount
+			if bucket >= 0 && bucket < input.HistogramBuckets {
+				output.Histogram[bucket].Count++
+			}
+		}
+	}
+	return output
+}
+
+// truncatePeriod returns the start of the period of the interval containing t, like date_trunc in UTC.
+func truncatePeriod(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	year, month, day := t.Date()
+	switch interval {
+	case StatsIntervalDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case StatsIntervalWeek:
+		// Weeks start on Monday.
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-weekday, 0, 0, 0, 0, time.UTC)
+	case StatsIntervalMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case StatsIntervalQuarter:
+		return time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// nextPeriod returns the start of the period following the period starting at start.
+func nextPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case StatsIntervalDay:
+		return start.AddDate(0, 0, 1)
+	case StatsIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsIntervalMonth:
+		return start.AddDate(0, 1, 0)
+	case StatsIntervalQuarter:
+		return start.AddDate(0, 3, 0)
+	}
+	return start.AddDate(1, 0, 0)
+}
+
+// datedHeight is the height of a tree together with the time it was planted.
+type datedHeight struct {
+	createdAt time.Time
+	height    int
+}
+
+// newEstateStatsSeries computes the series of Repository.GetEstateStatsSeriesByEstateId from the trees of
+// the estate planted at or before input.AsOf, sorted by the time they were planted. The periods are computed in UTC.
+func newEstateStatsSeries(trees []datedHeight, input *GetEstateStatsSeriesByEstateIdInput) (*GetEstateStatsSeriesByEstateIdOutput, error) {
+	if _, ok := statsIntervals[input.Interval]; !ok {
+		return nil, fmt.Errorf("err unknown stats interval %q", input.Interval)
+	}
+
+	output := &GetEstateStatsSeriesByEstateIdOutput{}
+	var first time.Time
+	switch {
+	case input.Since != nil:
+		first = *input.Since
+	case len(trees) > 0:
+		first = trees[0].createdAt
+	default:
+		return output, nil
+	}
+
+	for start := truncatePeriod(first, input.Interval); !start.After(input.AsOf) && len(output.Points) < input.MaxPoints; start = nextPeriod(start, input.Interval) {
+		next := nextPeriod(start, input.Interval)
+		point := EstateStatsPoint{PeriodStart: start, PeriodEnd: next}
+		if input.AsOf.Before(next) {
+			point.PeriodEnd = input.AsOf
+		}
+		var heights []int
+		for _, tree := range trees {
+			if !tree.createdAt.Before(next) {
+				break
+			}
+			if !tree.createdAt.Before(start) {
+				point.NewTrees++
+			}
+			heights = append(heights, tree.height)
+		}
+		stats := newHeightStats(heights)
+		point.Count, point.Median, point.Mean = stats.count, float32(stats.percentile(0.5)), stats.mean
+		output.Points = append(output.Points, point)
+	}
+	return output, nil
+}
+
+// portfolioEstate is an estate matching the filter of GetPortfolioStats, with the heights of its trees.
+type portfolioEstate struct {
+	id            string
+	length, width int
+	heights       []int
+}
+
+// newPortfolioStatsOutput computes the statistics and the rankings of Repository.GetPortfolioStats from the
+// estates matching the filter.
+func newPortfolioStatsOutput(estates []portfolioEstate, input *GetPortfolioStatsInput) *GetPortfolioStatsOutput {
+	type rankedEstate struct {
+		rank  EstateRank
+		value float64
+	}
+
+	output := &GetPortfolioStatsOutput{Estates: len(estates)}
+	var heights []int
+	var ranked []rankedEstate
+	for _, estate := range estates {
+		output.Plots += estate.length * estate.width
+		heights = append(heights, estate.heights...)
+
+		stats := newHeightStats(estate.heights)
+		rank := EstateRank{EstateId: estate.id, Length: estate.length, Width: estate.width, Count: stats.count, Median: float32(stats.percentile(0.5))}
+		switch {
+		case input.RankBy == PortfolioRankByDensity:
+			ranked = append(ranked, rankedEstate{rank: rank, value: float64(stats.count) / float64(estate.length*estate.width)})
+		case stats.count > 0:
+			// Estates without trees have no median height, so they are only ranked by density.
+			ranked = append(ranked, rankedEstate{rank: rank, value: stats.percentile(0.5)})
+		}
+	}
+
+	stats := newHeightStats(heights)
+	output.Count, output.Max, output.Min = stats.count, stats.max, stats.min
+	output.Median, output.Mean, output.StdDev = float32(stats.percentile(0.5)), stats.mean, stats.stdDev
+	output.Percentiles = make([]float64, len(input.Percentiles))
+	for i, percentile := range input.Percentiles {
+		output.Percentiles[i] = stats.percentile(percentile)
+	}
+
+	// Ties are broken by estate id, like Repository, the bottom ranking lists the selected estates worst first.
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].value != ranked[j].value {
+			return ranked[i].value > ranked[j].value
+		}
+		return ranked[i].rank.EstateId < ranked[j].rank.EstateId
+	})
+	bottomRanked := make([]rankedEstate, len(ranked))
+	copy(bottomRanked, ranked)
+	sort.SliceStable(bottomRanked, func(i, j int) bool {
+		if bottomRanked[i].value != bottomRanked[j].value {
+			return bottomRanked[i].value < bottomRanked[j].value
+		}
+		return bottomRanked[i].rank.EstateId < bottomRanked[j].rank.EstateId
+	})
+	inBottom := map[string]bool{}
+	for i := 0; i < len(bottomRanked) && i < input.RankLimit; i++ {
+		inBottom[bottomRanked[i].rank.EstateId] = true
+	}
+
+	output.Top, output.Bottom = []EstateRank{}, []EstateRank{}
+	for i, estate := range ranked {
+		if i < input.RankLimit {
+			output.Top = append(output.Top, estate.rank)
+		}
+		if inBottom[estate.rank.EstateId] {
+			output.Bottom = append([]EstateRank{estate.rank}, output.Bottom...)
+		}
+	}
+	return output
+}
+
+// newEstateGroupedStats computes the groups of Repository.GetEstateGroupedStatsByEstateId from the dimensions
+// and the trees of the estate.
+func newEstateGroupedStats(length, width int, trees []Tree, input *GetEstateGroupedStatsByEstateIdInput) (*GetEstateGroupedStatsByEstateIdOutput, error) {
+	if input.BlockLength < 1 || input.BlockWidth < 1 {
+		return nil, fmt.Errorf("err invalid block of %d x %d plots", input.BlockLength, input.BlockWidth)
+	}
+
+	output := &GetEstateGroupedStatsByEstateIdOutput{}
+	blocksX, blocksY := (length-1)/input.BlockLength+1, (width-1)/input.BlockWidth+1
+	heights := make([][]int, blocksX*blocksY)
+	for _, tree := range trees {
+		blockX, blockY := (tree.X-1)/input.BlockLength, (tree.Y-1)/input.BlockWidth
+		if blockX < blocksX && blockY < blocksY {
+			heights[blockY*blocksX+blockX] = append(heights[blockY*blocksX+blockX], tree.Height)
+		}
+	}
+	for blockY := 0; blockY < blocksY; blockY++ {
+		for blockX := 0; blockX < blocksX; blockX++ {
+			stats := newHeightStats(heights[blockY*blocksX+blockX])
+			output.Groups = append(output.Groups, EstateStatsGroup{
+				BlockX: blockX, BlockY: blockY,
+				Count: stats.count, Max: stats.max, Min: stats.min,
+				Median: float32(stats.percentile(0.5)), Mean: stats.mean,
+			})
+		}
+	}
+	return output, nil
+}
@@ -1,6 +1,8 @@
 // This file contains types that are used in the repository layer.
 package repository
 
+import "time"
+
 type CreateEstateInput struct {
 	Id            string
 	Length, Width uint16
@@ -36,6 +38,14 @@ type CreateTreeOutput struct {
 	Id string
 }
 
+type GetTreeByTreeIdInput struct {
+	Id, EstateId string
+}
+
+type GetTreeByTreeIdOutput struct {
+	Tree Tree
+}
+
 type GetEstateTreesByEstateIdInput struct {
 	EstateId string
 }
@@ -51,6 +61,10 @@ type Tree struct {
 
 type Estate struct {
 	Length, Width int
+	// Revision is bumped by every mutation of the estate or of its trees.
+	Revision int64
+	// LastModified is the time of the newest change of the estate or of its trees.
+	LastModified time.Time
 }
 
 type CalculateDroneDistanceInput struct {
@@ -66,11 +80,253 @@ type CalculateDroneDistanceOutput struct {
 	LastAchievableYCoordinate int
 }
 
+type GetDronePlanInput struct {
+	EstateId string
+	// ParamsKey identifies the planner parameters the plan is computed with.
+	ParamsKey string
+	Revision  int64
+}
+
+type GetDronePlanOutput struct {
+	Plan CalculateDroneDistanceOutput
+}
+
+// MaxDronePlansPerEstate bounds the drone plans stored per estate, one per set of planner parameters.
+// SaveDronePlan removes the plans of the earlier revisions of the estate, then the least recently saved plans
+// above the bound.
+const MaxDronePlansPerEstate = 64
+
+type SaveDronePlanInput struct {
+	EstateId  string
+	ParamsKey string
+	Revision  int64
+	Plan      CalculateDroneDistanceOutput
+}
+
+type SaveDronePlanOutput struct {
+	// Saved is false when a plan of a later revision is stored already.
+	Saved bool
+}
+
 type GetEstateStatsByEstateIdInput struct {
 	EstateId string
+	// IncludeDistribution adds the mean, the standard deviation and the requested percentiles.
+	IncludeDistribution bool
+	// Percentiles are fractions between 0 and 1, e.g. 0.9 for the 90th percentile.
+	Percentiles []float64
+	// HistogramBuckets is the number of equally wide height buckets, no histogram is computed when it is 0.
+	HistogramBuckets int
+	// AsOf restricts the statistics to the trees planted at or before this time, when set.
+	AsOf *time.Time
 }
 
 type GetEstateStatsByEstateIdOutput struct {
 	Count, Max, Min int
 	Median          float32
+	Mean, StdDev    float64
+	// Percentiles holds the values of the requested percentiles, in the order of the input.
+	Percentiles []float64
+	Histogram   []HistogramBucket
+}
+
+type GetEstateGroupedStatsByEstateIdInput struct {
+	EstateId string
+	// BlockLength and BlockWidth are the number of plots of a group along the X and the Y axis.
+	BlockLength, BlockWidth int
+}
+
+type GetEstateGroupedStatsByEstateIdOutput struct {
+	Groups []EstateStatsGroup
+}
+
+// EstateStatsGroup holds the statistics of the trees of a block, whose plots go from
+// (BlockX*BlockLength + 1, BlockY*BlockWidth + 1) up to the next block or the edge of the estate.
+type EstateStatsGroup struct {
+	BlockX, BlockY  int
+	Count, Max, Min int
+	Median          float32
+	Mean            float64
+}
+
+const (
+	StatsIntervalDay     = "day"
+	StatsIntervalWeek    = "week"
+	StatsIntervalMonth   = "month"
+	StatsIntervalQuarter = "quarter"
+	StatsIntervalYear    = "year"
+)
+
+type GetEstateStatsSeriesByEstateIdInput struct {
+	EstateId string
+	// Interval is one of the StatsInterval constants.
+	Interval string
+	// AsOf is the end of the series, inclusive.
+	AsOf time.Time
+	// Since starts the series at the period containing it instead of the period of the first tree, when set.
+	Since *time.Time
+	// MaxPoints caps the number of points, the earliest periods are returned first.
+	MaxPoints int
+}
+
+type GetEstateStatsSeriesByEstateIdOutput struct {
+	Points []EstateStatsPoint
+}
+
+// EstateStatsPoint holds the statistics of a period of a series. NewTrees counts the trees planted during the
+// period, while Count, Median and Mean describe all the trees planted up to the end of the period.
+type EstateStatsPoint struct {
+	PeriodStart, PeriodEnd time.Time
+	NewTrees, Count        int
+	Median                 float32
+	Mean                   float64
+}
+
+const (
+	PortfolioRankByMedian  = "median"
+	PortfolioRankByDensity = "density"
+)
+
+// EstateFilter selects estates by their attributes. Unset fields do not filter.
+type EstateFilter struct {
+	MinLength, MaxLength *int
+	MinWidth, MaxWidth   *int
+	// CreatedAfter is inclusive, CreatedBefore is exclusive.
+	CreatedAfter, CreatedBefore *time.Time
+}
+
+type GetPortfolioStatsInput struct {
+	Filter EstateFilter
+	// Percentiles are fractions between 0 and 1.
+	Percentiles []float64
+	// RankBy is one of the PortfolioRankBy constants.
+	RankBy string
+	// RankLimit is the number of estates in the top and in the bottom rankings.
+	RankLimit int
+}
+
+type GetPortfolioStatsOutput struct {
+	Estates, Plots  int
+	Count, Max, Min int
+	Median          float32
+	Mean, StdDev    float64
+	Percentiles     []float64
+	// Top holds the best ranked estates first, Bottom holds the worst ranked estates first.
+	Top, Bottom []EstateRank
+}
+
+// EstateRank holds the figures used to rank an estate in the portfolio.
+type EstateRank struct {
+	EstateId      string
+	Length, Width int
+	Count         int
+	Median        float32
+}
+
+// HistogramBucket counts the trees whose height is between Min and Max, both inclusive.
+type HistogramBucket struct {
+	Min, Max, Count int
+}
+
+const (
+	// MinTreeHeight and MaxTreeHeight bound the height of a tree, as enforced by the trees table.
+	MinTreeHeight = 1
+	MaxTreeHeight = 30
+	// MaxEstateDimension bounds the length and the width of an estate, as enforced by the estates table.
+	MaxEstateDimension = 50000
+)
+
+const (
+	JobKindTreeImport = "tree_import"
+
+	JobStateQueued    = "queued"
+	JobStateRunning   = "running"
+	JobStateSucceeded = "succeeded"
+	JobStateFailed    = "failed"
+	JobStateCancelled = "cancelled"
+)
+
+type Job struct {
+	Id, Kind, State, EstateId, ContentType string
+	// Payload is only set by ClaimNextJob, the other methods leave it out since it holds the whole import file.
+	Payload                                             []byte
+	TotalRows, ProcessedRows, SucceededRows, FailedRows int
+	ErrorSamples                                        []JobError
+	CancelRequested                                     bool
+	CreatedAt, UpdatedAt                                time.Time
+}
+
+type JobError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type CreateJobInput struct {
+	Id, Kind, EstateId, ContentType string
+	Payload                         []byte
+}
+
+type CreateJobOutput struct {
+	Job Job
+}
+
+type GetJobByJobIdInput struct {
+	Id string
+}
+
+type GetJobByJobIdOutput struct {
+	Job Job
+}
+
+type ClaimNextJobInput struct {
+	Kind string
+}
+
+type ClaimNextJobOutput struct {
+	Job Job
+}
+
+type UpdateJobProgressInput struct {
+	Id, State                                           string
+	TotalRows, ProcessedRows, SucceededRows, FailedRows int
+	ErrorSamples                                        []JobError
+}
+
+type UpdateJobProgressOutput struct {
+	CancelRequested bool
+}
+
+type RequestJobCancellationInput struct {
+	Id string
+}
+
+type RequestJobCancellationOutput struct {
+	Job Job
+}
+
+type RequeueStaleJobsInput struct {
+	StaleBefore time.Time
+}
+
+type RequeueStaleJobsOutput struct {
+	Count int
+}
+
+type ExportRow struct {
+	EstateId      string
+	Length, Width int
+	// TreeId is empty when the row stands for an estate without trees.
+	TreeId        string
+	X, Y, Height  int
+	TreeCreatedAt time.Time
+}
+
+type ExportEstateTreesInput struct {
+	// EstateId restricts the export to a single estate. All estates are exported when it is empty.
+	EstateId string
+	// OnRow is called for every row as soon as it is read. Returning an error stops the export.
+	OnRow func(row *ExportRow) error
+}
+
+type ExportEstateTreesOutput struct {
+	Count int
 }
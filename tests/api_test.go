@@ -244,7 +244,8 @@ func ExpectGetDronePlanOk(distance int) ExpectFunc {
 }
 
 func RequireReturnIsUUID(t *testing.T, resp *http.Response, data map[string]any) {
-	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Location"))
 	RequireIsUUID(t, data["id"].(string))
 }
 
@@ -0,0 +1,221 @@
+// This file contains the decorator of the repository, which traces its methods.
+package tracing
+
+import (
+	"context"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// operation is the main SQL statement of a repository method, with the table it works on.
+type operation struct {
+	Name  string
+	Table string
+}
+
+// operations of the methods of repository.RepositoryInterface. A few methods also read or update other tables,
+// e.g. CreateTree updates the revision of its estate.
+var operations = map[string]operation{
+	"CreateEstate":                    {Name: "INSERT", Table: "estates"},
+	"GetEstateByEstateId":             {Name: "SELECT", Table: "estates"},
+	"IsTreeExist":                     {Name: "SELECT", Table: "trees"},
+	"CreateTree":                      {Name: "INSERT", Table: "trees"},
+	"GetTreeByTreeId":                 {Name: "SELECT", Table: "trees"},
+	"GetEstateStatsByEstateId":        {Name: "SELECT", Table: "trees"},
+	"GetEstateStatsSeriesByEstateId":  {Name: "SELECT", Table: "trees"},
+	"GetPortfolioStats":               {Name: "SELECT", Table: "estates"},
+	"GetEstateGroupedStatsByEstateId": {Name: "SELECT", Table: "trees"},
+	"GetDronePlan":                    {Name: "SELECT", Table: "drone_plans"},
+	"SaveDronePlan":                   {Name: "INSERT", Table: "drone_plans"},
+	"GetEstateTreesByEstateId":        {Name: "SELECT", Table: "trees"},
+	"CreateJob":                       {Name: "INSERT", Table: "jobs"},
+	"GetJobByJobId":                   {Name: "SELECT", Table: "jobs"},
+	"ClaimNextJob":                    {Name: "UPDATE", Table: "jobs"},
+	"UpdateJobProgress":               {Name: "UPDATE", Table: "jobs"},
+	"RequestJobCancellation":          {Name: "UPDATE", Table: "jobs"},
+	"RequeueStaleJobs":                {Name: "UPDATE", Table: "jobs"},
+	"ExportEstateTrees":               {Name: "SELECT", Table: "trees"},
+}
+
+// Repository starts a child span of the span of the context for every method of the wrapped repository, so that
+// the time spent in the database shows up in the trace of the request.
+type Repository struct {
+	Next    repository.RepositoryInterface
+	Tracing *Tracing
+	// system is the db.system attribute of the spans, empty for the in-memory repository.
+	system attribute.KeyValue
+}
+
+type NewRepositoryOptions struct {
+	Repository repository.RepositoryInterface
+	Tracing    *Tracing
+	// Backend is the repository.Backend constant of Repository.
+	Backend string
+}
+
+func NewRepository(opts NewRepositoryOptions) *Repository {
+	r := &Repository{
+		Next:    opts.Repository,
+		Tracing: opts.Tracing,
+	}
+	switch opts.Backend {
+	case "", repository.BackendPostgres:
+		r.system = semconv.DBSystemPostgreSQL
+	case repository.BackendSQLite:
+		r.system = semconv.DBSystemSqlite
+	}
+	return r
+}
+
+// start starts the span of method, named like the method, with the attributes of its SQL operation.
+func (r *Repository) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	op := operations[method]
+	attributes := []attribute.KeyValue{
+		semconv.DBOperation(op.Name),
+		semconv.DBSQLTable(op.Table),
+		semconv.CodeFunction(method),
+	}
+	if r.system.Valid() {
+		attributes = append(attributes, r.system)
+	}
+	return r.Tracing.tracer.Start(ctx, "repository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+func (r *Repository) CreateEstate(ctx context.Context, input *repository.CreateEstateInput) (*repository.CreateEstateOutput, error) {
+	ctx, span := r.start(ctx, "CreateEstate")
+	output, err := r.Next.CreateEstate(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateByEstateId(ctx context.Context, input *repository.GetEstateByEstateIdInput) (*repository.GetEstateByEstateIdOutput, error) {
+	ctx, span := r.start(ctx, "GetEstateByEstateId")
+	output, err := r.Next.GetEstateByEstateId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) IsTreeExist(ctx context.Context, input *repository.IsTreeExistInput) (*repository.IsTreeExistOutput, error) {
+	ctx, span := r.start(ctx, "IsTreeExist")
+	output, err := r.Next.IsTreeExist(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) CreateTree(ctx context.Context, input *repository.CreateTreeInput) (*repository.CreateTreeOutput, error) {
+	ctx, span := r.start(ctx, "CreateTree")
+	output, err := r.Next.CreateTree(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetTreeByTreeId(ctx context.Context, input *repository.GetTreeByTreeIdInput) (*repository.GetTreeByTreeIdOutput, error) {
+	ctx, span := r.start(ctx, "GetTreeByTreeId")
+	output, err := r.Next.GetTreeByTreeId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateStatsByEstateId(ctx context.Context, input *repository.GetEstateStatsByEstateIdInput) (*repository.GetEstateStatsByEstateIdOutput, error) {
+	ctx, span := r.start(ctx, "GetEstateStatsByEstateId")
+	output, err := r.Next.GetEstateStatsByEstateId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateStatsSeriesByEstateId(ctx context.Context, input *repository.GetEstateStatsSeriesByEstateIdInput) (*repository.GetEstateStatsSeriesByEstateIdOutput, error) {
+	ctx, span := r.start(ctx, "GetEstateStatsSeriesByEstateId")
+	output, err := r.Next.GetEstateStatsSeriesByEstateId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetPortfolioStats(ctx context.Context, input *repository.GetPortfolioStatsInput) (*repository.GetPortfolioStatsOutput, error) {
+	ctx, span := r.start(ctx, "GetPortfolioStats")
+	output, err := r.Next.GetPortfolioStats(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateGroupedStatsByEstateId(ctx context.Context, input *repository.GetEstateGroupedStatsByEstateIdInput) (*repository.GetEstateGroupedStatsByEstateIdOutput, error) {
+	ctx, span := r.start(ctx, "GetEstateGroupedStatsByEstateId")
+	output, err := r.Next.GetEstateGroupedStatsByEstateId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetDronePlan(ctx context.Context, input *repository.GetDronePlanInput) (*repository.GetDronePlanOutput, error) {
+	ctx, span := r.start(ctx, "GetDronePlan")
+	output, err := r.Next.GetDronePlan(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) SaveDronePlan(ctx context.Context, input *repository.SaveDronePlanInput) (*repository.SaveDronePlanOutput, error) {
+	ctx, span := r.start(ctx, "SaveDronePlan")
+	output, err := r.Next.SaveDronePlan(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetEstateTreesByEstateId(ctx context.Context, input *repository.GetEstateTreesByEstateIdInput) (*repository.GetEstateTreesByEstateIdOutput, error) {
+	ctx, span := r.start(ctx, "GetEstateTreesByEstateId")
+	output, err := r.Next.GetEstateTreesByEstateId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) CreateJob(ctx context.Context, input *repository.CreateJobInput) (*repository.CreateJobOutput, error) {
+	ctx, span := r.start(ctx, "CreateJob")
+	output, err := r.Next.CreateJob(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) GetJobByJobId(ctx context.Context, input *repository.GetJobByJobIdInput) (*repository.GetJobByJobIdOutput, error) {
+	ctx, span := r.start(ctx, "GetJobByJobId")
+	output, err := r.Next.GetJobByJobId(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) ClaimNextJob(ctx context.Context, input *repository.ClaimNextJobInput) (*repository.ClaimNextJobOutput, error) {
+	ctx, span := r.start(ctx, "ClaimNextJob")
+	output, err := r.Next.ClaimNextJob(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) UpdateJobProgress(ctx context.Context, input *repository.UpdateJobProgressInput) (*repository.UpdateJobProgressOutput, error) {
+	ctx, span := r.start(ctx, "UpdateJobProgress")
+	output, err := r.Next.UpdateJobProgress(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) RequestJobCancellation(ctx context.Context, input *repository.RequestJobCancellationInput) (*repository.RequestJobCancellationOutput, error) {
+	ctx, span := r.start(ctx, "RequestJobCancellation")
+	output, err := r.Next.RequestJobCancellation(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) RequeueStaleJobs(ctx context.Context, input *repository.RequeueStaleJobsInput) (*repository.RequeueStaleJobsOutput, error) {
+	ctx, span := r.start(ctx, "RequeueStaleJobs")
+	output, err := r.Next.RequeueStaleJobs(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
+
+func (r *Repository) ExportEstateTrees(ctx context.Context, input *repository.ExportEstateTreesInput) (*repository.ExportEstateTreesOutput, error) {
+	ctx, span := r.start(ctx, "ExportEstateTrees")
+	output, err := r.Next.ExportEstateTrees(ctx, input)
+	endSpan(span, err)
+	return output, err
+}
@@ -0,0 +1,176 @@
+// Package tracing traces the requests of the service with OpenTelemetry, and propagates their trace context in
+// the W3C format.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Exporters of the spans.
+const (
+	// ExporterNone turns the tracing off, the trace context of the requests is still propagated.
+	ExporterNone = "none"
+	// ExporterStdout writes the spans as JSON lines, for debugging.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends the spans to an OpenTelemetry collector over HTTP.
+	ExporterOTLP = "otlp"
+)
+
+const (
+	// instrumentationName names the tracer of the service.
+	instrumentationName = "github.com/hartono-wen/sawitpro-technical-interview-software-architect"
+	// defaultEndpoint is the OTLP over HTTP receiver of a collector running next to the service.
+	defaultEndpoint = "http://localhost:4318"
+	// unmatchedRoute is the route of the requests which match no route, like the route label of the metrics.
+	unmatchedRoute = "unmatched"
+)
+
+var ErrUnsupportedExporter = errors.New("unsupported tracing exporter")
+
+type Tracing struct {
+	Provider   trace.TracerProvider
+	Propagator propagation.TextMapPropagator
+
+	tracer   trace.Tracer
+	shutdown func(ctx context.Context) error
+}
+
+type NewTracingOptions struct {
+	// Exporter is one of the Exporter constants, defaults to ExporterNone.
+	Exporter string
+	// Endpoint is the URL of the collector of ExporterOTLP, defaults to http://localhost:4318.
+	Endpoint string
+	// ServiceName defaults to plantation-management-service.
+	ServiceName string
+	// Writer receives the spans of ExporterStdout, defaults to the standard output.
+	Writer io.Writer
+}
+
+func NewTracing(opts NewTracingOptions) (*Tracing, error) {
+	t := &Tracing{
+		Propagator: propagation.TraceContext{},
+		shutdown:   func(ctx context.Context) error { return nil },
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+		t.Provider = noop.NewTracerProvider()
+		t.tracer = t.Provider.Tracer(instrumentationName)
+		return t, nil
+	case ExporterStdout:
+		writer := opts.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	case ExporterOTLP:
+		endpoint := opts.Endpoint
+		if endpoint == "" {
+			endpoint = defaultEndpoint
+		}
+		// The exporter only connects when it sends the first spans, so that the service starts without its collector.
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	default:
+		return nil, fmt.Errorf("%w %q, expected one of %s, %s or %s", ErrUnsupportedExporter, opts.Exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("err creating %s exporter: %w", opts.Exporter, err)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = "plantation-management-service"
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	t.Provider, t.tracer, t.shutdown = provider, provider.Tracer(instrumentationName), provider.Shutdown
+	return t, nil
+}
+
+// Tracer creates the spans of the service.
+func (t *Tracing) Tracer() trace.Tracer {
+	return t.tracer
+}
+
+// Shutdown exports the spans which are still buffered, before the service exits.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// Middleware starts a server span per request, as a child of the span of the traceparent header of the request
+// if any. The span is named after the path template of the matched route, e.g. GET /estate/:estate_id/stats.
+// The error returned by the next handler is recorded on the span and handled there: the middleware returns nil,
+// so the middlewares registered before it do not see the error.
+func (t *Tracing) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := t.Propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+			ctx, span := t.tracer.Start(ctx, request.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(request.Method),
+					semconv.URLPath(request.URL.Path),
+					semconv.UserAgentOriginal(request.UserAgent()),
+				),
+			)
+			defer span.End()
+			c.SetRequest(request.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+				// Write the error response now, so that its status is known.
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" || c.Response().Status == http.StatusNotFound && route == "/*" {
+				route = unmatchedRoute
+			} else {
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			span.SetName(request.Method + " " + route)
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			// The client errors are the failures of the client, not of the server.
+			if status >= http.StatusInternalServerError {
+				description := http.StatusText(status)
+				if err != nil {
+					description = err.Error()
+				}
+				span.SetStatus(codes.Error, description)
+			}
+			return nil
+		}
+	}
+}
+
+// endSpan ends span, recording err as its failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,186 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hartono-wen/sawitpro-technical-interview-software-architect/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+)
+
+// newTestTracing returns a Tracing recording its ended spans.
+func newTestTracing() (*Tracing, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return &Tracing{
+		Provider:   provider,
+		Propagator: propagation.TraceContext{},
+		tracer:     provider.Tracer(instrumentationName),
+		shutdown:   provider.Shutdown,
+	}, recorder
+}
+
+// attributes returns the attributes of span by key.
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestNewTracing(t *testing.T) {
+	t.Run("Off by default", func(t *testing.T) {
+		tracing, err := NewTracing(NewTracingOptions{})
+		require.NoError(t, err)
+		_, span := tracing.Tracer().Start(context.Background(), "span")
+		assert.False(t, span.IsRecording())
+		assert.NoError(t, tracing.Shutdown(context.Background()))
+	})
+
+	t.Run("Stdout", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tracing, err := NewTracing(NewTracingOptions{Exporter: ExporterStdout, Writer: out})
+		require.NoError(t, err)
+		_, span := tracing.Tracer().Start(context.Background(), "span")
+		span.End()
+		// The spans are exported in batches, at the latest on shutdown.
+		require.NoError(t, tracing.Shutdown(context.Background()))
+		assert.Contains(t, out.String(), `"Name":"span"`)
+		assert.Contains(t, out.String(), `"Value":"plantation-management-service"`)
+	})
+
+	t.Run("OTLP", func(t *testing.T) {
+		// The collector is only reached when the spans are exported.
+		tracing, err := NewTracing(NewTracingOptions{Exporter: ExporterOTLP, Endpoint: "http://127.0.0.1:1"})
+		require.NoError(t, err)
+		_, span := tracing.Tracer().Start(context.Background(), "span")
+		assert.True(t, span.IsRecording())
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := NewTracing(NewTracingOptions{Exporter: "zipkin"})
+		assert.ErrorIs(t, err, ErrUnsupportedExporter)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	tracing, recorder := newTestTracing()
+	e := echo.New()
+	e.Use(tracing.Middleware())
+	e.GET("/estate/:estate_id/stats", func(c echo.Context) error {
+		// The handlers see the server span in the context of the request.
+		assert.True(t, trace.SpanFromContext(c.Request().Context()).IsRecording())
+		if c.Param("estate_id") == "broken" {
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	request := httptest.NewRequest(http.MethodGet, "/estate/a/stats", nil)
+	request.Header.Set("traceparent", traceparent)
+	e.ServeHTTP(httptest.NewRecorder(), request)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/estate/broken/stats", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	// The span continues the trace of the caller.
+	assert.Equal(t, "GET /estate/:estate_id/stats", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.True(t, spans[0].Parent().IsRemote())
+	assert.Equal(t, "/estate/:estate_id/stats", attributes(spans[0])["http.route"].AsString())
+	assert.Equal(t, int64(http.StatusOK), attributes(spans[0])["http.response.status_code"].AsInt64())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.False(t, spans[1].Parent().IsValid())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "code=500, message=Internal Server Error", spans[1].Status().Description)
+	// The error of the handler is recorded on the span.
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+
+	assert.Equal(t, "GET unmatched", spans[2].Name())
+	assert.NotContains(t, attributes(spans[2]), attribute.Key("http.route"))
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+}
+
+func TestRepository(t *testing.T) {
+	tracing, recorder := newTestTracing()
+	repo := NewRepository(NewRepositoryOptions{
+		Repository: repository.NewMemoryRepository(repository.NewMemoryRepositoryOptions{}),
+		Tracing:    tracing,
+		Backend:    repository.BackendMemory,
+	})
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "request")
+	estate, err := repo.CreateEstate(ctx, &repository.CreateEstateInput{Id: "8d5a0a55-8b1f-4c9b-9d31-bd1d8f0b3f47", Length: 10, Width: 10})
+	require.NoError(t, err)
+	_, err = repo.GetEstateTreesByEstateId(ctx, &repository.GetEstateTreesByEstateIdInput{EstateId: estate.Id})
+	require.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for i, want := range []struct {
+		name      string
+		operation string
+		table     string
+	}{
+		{name: "repository.CreateEstate", operation: "INSERT", table: "estates"},
+		{name: "repository.GetEstateTreesByEstateId", operation: "SELECT", table: "trees"},
+	} {
+		assert.Equal(t, want.name, spans[i].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[i].Parent().SpanID())
+		assert.Equal(t, want.operation, attributes(spans[i])["db.operation"].AsString())
+		assert.Equal(t, want.table, attributes(spans[i])["db.sql.table"].AsString())
+		// The in-memory repository is no database system.
+		assert.NotContains(t, attributes(spans[i]), attribute.Key("db.system"))
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		tracing.Provider.(*sdktrace.TracerProvider).RegisterSpanProcessor(recorder)
+		ctrl := gomock.NewController(t)
+		mockRepo := repository.NewMockRepositoryInterface(ctrl)
+		mockRepo.EXPECT().ClaimNextJob(gomock.Any(), gomock.Any()).Return(nil, errors.New("db down"))
+		repo := NewRepository(NewRepositoryOptions{Repository: mockRepo, Tracing: tracing})
+
+		_, err := repo.ClaimNextJob(context.Background(), &repository.ClaimNextJobInput{})
+		assert.EqualError(t, err, "db down")
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, "db down", spans[0].Status().Description)
+		assert.Equal(t, "postgresql", attributes(spans[0])["db.system"].AsString())
+		assert.Equal(t, "UPDATE", attributes(spans[0])["db.operation"].AsString())
+	})
+}
+
+func TestOperations(t *testing.T) {
+	// Every method of the interface has its operation.
+	methods := reflect.TypeOf((*repository.RepositoryInterface)(nil)).Elem()
+	for i := 0; i < methods.NumMethod(); i++ {
+		method := methods.Method(i).Name
+		assert.NotEmpty(t, operations[method].Name, method)
+		assert.NotEmpty(t, operations[method].Table, method)
+	}
+	assert.Len(t, operations, methods.NumMethod())
+}
@@ -1,6 +1,9 @@
 package validator
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -18,8 +21,21 @@ func (cv *RequestValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
 
+// NewRequestValidator creates a RequestValidator that reports the fields by their JSON name,
+// so that validation errors can be shown to clients as is.
 func NewRequestValidator() *RequestValidator {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
 	return &RequestValidator{
-		validator: validator.New(),
+		validator: v,
 	}
 }